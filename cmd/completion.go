@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Completion scripts of the supported shells. They run domain-recon with GO_FLAGS_COMPLETION set, which makes go-flags
+// print the completions of the command line instead of running it.
+var completionScripts = map[string]string{
+	"bash": `_domain_recon() {
+    local args=("${COMP_WORDS[@]:1:$COMP_CWORD}")
+    local IFS=$'\n'
+    COMPREPLY=($(GO_FLAGS_COMPLETION=1 ${COMP_WORDS[0]} "${args[@]}"))
+    return 0
+}
+complete -o default -F _domain_recon domain-recon
+`,
+	"zsh": `autoload -U +X bashcompinit && bashcompinit
+_domain_recon() {
+    local args=("${COMP_WORDS[@]:1:$COMP_CWORD}")
+    local IFS=$'\n'
+    COMPREPLY=($(GO_FLAGS_COMPLETION=1 ${COMP_WORDS[0]} "${args[@]}"))
+    return 0
+}
+complete -o default -F _domain_recon domain-recon
+`,
+	"fish": `complete -c domain-recon \
+    -a '(env GO_FLAGS_COMPLETION=1 domain-recon (commandline -cop)[2..-1] (commandline -ct))'
+`,
+	"powershell": `Register-ArgumentCompleter -Native -CommandName domain-recon -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $arguments = @($commandAst.CommandElements | Select-Object -Skip 1 | ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') { $arguments += '' }
+    $env:GO_FLAGS_COMPLETION = 1
+    $completions = & domain-recon @arguments
+    Remove-Item Env:GO_FLAGS_COMPLETION
+    $completions | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`,
+}
+
+// Run the completion subcommand, printing the completion script of the shell named by the arguments.
+func completion(args []string) {
+	if len(args) != 1 || completionScripts[args[0]] == "" {
+		fmt.Println("usage: domain-recon completion bash|zsh|fish|powershell")
+		os.Exit(exitError)
+	}
+	fmt.Print(completionScripts[args[0]])
+}
@@ -1,35 +1,549 @@
 package main
 
 import (
+	"context"
 	"domain-recon/internal"
+	"errors"
 	"fmt"
 	"github.com/jessevdk/go-flags"
+	"log/slog"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 // Opts struct used to store command line arguments after parsing.
 type Opts struct {
-	Plain  bool   `short:"p" long:"plain" description:"Show plain domains"`
-	Domain string `short:"d" long:"domain" description:"Domain name" required:"true"`
-	File   string `short:"f" long:"file" description:"File with words for extending wildcards" value-name:"FILE"`
+	Plain    bool          `short:"p" long:"plain" description:"Show plain domains"`
+	Verbose  []bool        `short:"v" long:"verbose" description:"Show more details, such as certificates (repeatable)"`
+	Domain   []string      `short:"d" long:"domain" description:"Target domain; repeat or comma-separate for several"`
+	DomainF  string        `long:"domain-file" description:"File with target domains; '-' is stdin" value-name:"FILE"`
+	DomainsF string        `long:"domains-file" description:"Same as --domain-file" value-name:"FILE"`
+	JSONL    string        `long:"jsonl-input" description:"JSON lines with a domain or host key" value-name:"FILE"`
+	Org      string        `long:"org" description:"Organization name used instead of the domain to find certificates"`
+	File     string        `short:"f" long:"file" description:"Words file for extending wildcards" value-name:"FILE"`
+	Permute  int           `long:"permute-labels" description:"Also combine up to N words, as api-dev" value-name:"N"`
+	Numbers  numberRange   `long:"number-suffixes" description:"Also try numbered names, as api1" value-name:"MIN-MAX"`
+	Fuzz     bool          `long:"fuzz" description:"Also try common prefixes and suffixes on each label, as dev-api"`
+	Dedup    bool          `long:"wordlist-dedup" description:"Remove repeated words from the words file"`
+	SNI      bool          `long:"sni" description:"Check whether the certificate served for each domain covers it"`
+	Tmpl     string        `long:"template" description:"Domain template, as '{{.Name}} {{join .IPv4 \",\"}}'"`
+	TmplF    string        `long:"template-file" description:"Go template file rendering the report" value-name:"FILE"`
+	Source   string        `long:"source-ip" description:"Local IP address of DNS and crt.sh traffic" value-name:"IP"`
+	Iface    string        `long:"interface" description:"Interface of the DNS and crt.sh traffic" value-name:"NAME"`
+	Slow     time.Duration `long:"slow-threshold" description:"With -vv, report lookups slower than this" default:"1s"`
+	Bogus    string        `long:"bogus-ips" description:"CIDR and sinkholed or parked, per line" value-name:"FILE"`
+	Hide     bool          `long:"hide-sinkholed" description:"Leave out sinkholed and parked domains"`
+	Export   string        `long:"export" description:"Export the results for another system" choice:"elastic"`
+	Output   string        `short:"o" long:"output" description:"Output file or format name, as json" value-name:"FILE"`
+	OutputF  string        `long:"output-file" description:"Same as --output" value-name:"FILE"`
+	ESIndex  string        `long:"elastic-index" description:"Elasticsearch index of the export" default:"domain-recon"`
+	ESURL    string        `long:"elastic-url" description:"Elasticsearch URL the export is posted to" value-name:"URL"`
+	Splunk   string        `long:"splunk-url" description:"Splunk HTTP Event Collector URL" value-name:"URL"`
+	SplunkTk string        `long:"splunk-token" description:"Splunk token" value-name:"TOKEN" env:"SPLUNK_HEC_TOKEN"`
+	NATS     string        `long:"nats" description:"NATS server, such as nats://broker:4222" value-name:"URL"`
+	NATSSubj string        `long:"nats-subject" description:"Subject" default:"recon.subdomains" value-name:"SUBJECT"`
+	Syslog   bool          `long:"syslog" description:"Send an RFC 5424 syslog message for each finding"`
+	SyslogAd string        `long:"syslog-addr" description:"Remote syslog receiver, tcp://host:514" value-name:"ADDR"`
+	AllRecs  bool          `long:"all-records" description:"Also look up CNAME, MX, NS, TXT, CAA and SOA records"`
+	FollowCN bool          `long:"follow-cname-to-domain" description:"Also scan the domains CNAME records point into"`
+	MinDoms  int           `long:"min-domains" description:"Exit with code 2 if fewer domains resolve" value-name:"N"`
+	MaxCands int           `long:"max-candidates" description:"Name limit; 0 disables" default:"100000" value-name:"N"`
+	SkipPre  bool          `long:"skip-preflight" description:"Skip the reachability checks before the run"`
+	Servers  string        `long:"dns-server-list" description:"DNS servers compared for split DNS" value-name:"ADDRS"`
+	ServersF string        `long:"dns-server-file" description:"File of DNS servers, one per line" value-name:"FILE"`
+	Hosts    string        `long:"hosts-file" description:"Hosts file overriding DNS for its names" value-name:"FILE"`
+	Record   string        `long:"record" description:"Record crt.sh and DNS answers to a tar file" value-name:"FILE"`
+	Replay   string        `long:"replay" description:"Replay a --record archive offline" value-name:"FILE"`
+	ResRetry int           `long:"resolve-retries" description:"Retries of empty answers" default:"2" value-name:"N"`
+	SOA      bool          `long:"soa-check" description:"Show the SOA serial served by each nameserver of the domain"`
+	Concur   int           `long:"concurrency" description:"Parallel lookups; 0: no limit" default:"50" value-name:"N"`
+	Workers  int           `long:"workers" description:"Same as --concurrency" value-name:"N"`
+	Timeout  time.Duration `long:"timeout" description:"Time limit of the whole run" default:"0" value-name:"DURATION"`
+	MaxScan  time.Duration `long:"max-scan-time" description:"Same as --timeout" value-name:"DURATION"`
+	Resolver string        `long:"resolver" description:"DNS server to use, such as 8.8.8.8:53" value-name:"ADDR"`
+	NoFallbk bool          `long:"no-fallback" description:"Do not switch to public resolvers if the system one fails"`
+	Compare  string        `long:"compare-to-domain" description:"List IPs shared with this domain" value-name:"DOMAIN"`
+	TagIn    string        `long:"tag-filter" description:"Report only domains with one of the tags" value-name:"TAGS"`
+	TagOut   string        `long:"tag-exclude" description:"Leave out domains with any of the tags" value-name:"TAGS"`
+	TLSOnly  bool          `long:"tls-only" description:"Report only domains accepting TLS on port 443 (implies --sni)"`
+	NoTLS    bool          `long:"no-tls" description:"Report only domains with port 80 open and no TLS on port 443"`
+	Ports    string        `long:"ports" description:"TCP ports checked on the first IP of a domain" value-name:"PORTS"`
+	OpenOnly bool          `long:"open-ports-only" description:"Report only domains with at least one of --ports open"`
+	Typos    bool          `long:"typosquat-check" description:"Report resolvable names one typo away from a subdomain"`
+	AnonIPs  bool          `long:"anonymize-ips" description:"Redact the host part of the IP addresses in the output"`
+	Strip    bool          `long:"domain-strip" description:"Print domains relative to their target, for wordlists"`
+	Stamps   bool          `long:"timestamps" description:"Prefix each domain with the UTC time it was resolved"`
+	CrtField string        `long:"crt-fields" description:"Certificate fields shown with -v" value-name:"FIELDS"`
+	Headers  string        `long:"output-headers" description:"Write a header row naming the fields; on by default for the table and CSV formats" choice:"true" choice:"false" optional:"true" optional-value:"true"`
+	Wide     bool          `long:"wide" description:"Do not truncate the cells of the table format"`
+	Httpx    bool          `long:"httpx-compatible" description:"Print an http:// and an https:// URL of each domain"`
+	Fields   string        `long:"fields" description:"Fields to print; 'help' lists them" value-name:"FIELDS"`
+	Format   string        `long:"format" description:"Output format" choice:"text" choice:"json" choice:"yaml" choice:"sarif" choice:"dnsx" choice:"csv" choice:"table" default:"text"`
+	JSON     bool          `long:"json" description:"Shorthand for --format json"`
+	UniqIPs  bool          `long:"unique-ips-only" description:"Print only the distinct IP addresses, sorted"`
+	Diff     string        `long:"diff" description:"Print only domains missing from this baseline" value-name:"FILE"`
+	FailNew  bool          `long:"fail-on-new" description:"Exit with code 4 if domains missing from --diff are found"`
+	Allow    string        `long:"allowlist" description:"Patterns of domains expected to be new" value-name:"FILE"`
+	BySubnet bool          `long:"group-by-subnet" description:"Group domains by the /24 or /64 subnet of their IPs"`
+	Hash     bool          `long:"print-hash-only" description:"Print only a hash of the domains and their IPs"`
+	SANs     bool          `long:"dedupe-san" description:"Report how many certificates list each SAN"`
+	PEM      string        `long:"pem-file" description:"Read the certificates from a PEM file" value-name:"FILE"`
+	Match    string        `long:"match-type" description:"crt.sh matching" choice:"ilike" choice:"like" choice:"exact"`
+	Deep     bool          `long:"deep-certs" description:"Download full certificates whose SAN list looks truncated"`
+	DeepMax  int           `long:"deep-certs-max" description:"Maximum full certificates per run" default:"50"`
+	NoDedup  bool          `long:"no-deduplicate" description:"Keep both the precertificate and the leaf certificate"`
+	CrtURL   string        `long:"crtsh-url" description:"crt.sh base URLs" value-name:"URLS" default:"https://crt.sh"`
+	Retry    int           `long:"retry" description:"Retries of crt.sh requests on 429, 5xx or HTML" default:"3"`
+	// Declared as a string since go-flags does not allow boolean flags to default to true.
+	RetryOnHTML string `long:"retry-on-html" description:"Retry 5 seconds after crt.sh returns an HTML error page" choice:"true" choice:"false" default:"true" optional:"true" optional-value:"true"`
+
+	// Set by the doctor subcommand, which only checks the components used by a run.
+	Doctor bool `no-flag:"true"`
+
+	Args struct {
+		Domain string `positional-arg-name:"DOMAIN" description:"Domain name, the same as -d, --domain"`
+	} `positional-args:"yes"`
+
+	HTTP    HTTPOpts    `group:"HTTP Options"`
+	Log     LogOpts     `group:"Logging Options"`
+	Profile ProfileOpts `group:"Profiling Options"`
+}
+
+// HTTPOpts struct used to store the command line arguments controlling the HTTP client used to query crt.sh.
+type HTTPOpts struct {
+	CACert     string        `long:"ca-cert" description:"PEM file of extra CA certificates to trust" value-name:"FILE"`
+	CrtTimeout time.Duration `long:"crt-timeout" description:"Time limit of each crt.sh request" default:"60s"`
+	APIKey     string        `long:"api-key" description:"Key sent as a bearer token to crt.sh" value-name:"KEY"`
+	APIKeyHdr  string        `long:"api-key-header" description:"Header carrying the key" value-name:"\"NAME: VALUE\""`
+	Headers    []string      `long:"user-header" description:"Extra crt.sh request header" value-name:"\"NAME: VALUE\""`
+	ClientCert string        `long:"client-cert" description:"PEM client certificate for mutual TLS" value-name:"FILE"`
+	ClientKey  string        `long:"client-key" description:"PEM key of the client certificate" value-name:"FILE"`
+	ClientP12  string        `long:"client-cert-p12" description:"PKCS#12 client certificate and key" value-name:"FILE"`
+	ClientPass string        `long:"client-cert-password" description:"PKCS#12 file password" value-name:"PASSWORD"`
+	TrustStore string        `long:"trust-store" description:"PEM bundle replacing the system roots" value-name:"FILE"`
+	Insecure   bool          `long:"insecure" description:"DANGEROUS: do not verify the TLS certificate of crt.sh"`
+}
+
+// ProfileOpts struct used to store the command line arguments controlling profiling.
+type ProfileOpts struct {
+	Kind   string `long:"profile" description:"Write a CPU or heap profile of the run" choice:"cpu" choice:"mem"`
+	Output string `long:"profile-output" description:"Profile file (default: cpu.prof or mem.prof)" value-name:"FILE"`
+	Mem    string `long:"profile-mem" description:"Heap profile file, same as --profile mem" value-name:"FILE"`
+}
+
+// LogOpts struct used to store the command line arguments controlling the diagnostic messages written to stderr.
+type LogOpts struct {
+	Format string `long:"log-format" description:"Format of the diagnostics" choice:"text" choice:"json" default:"text"`
+	Level  string `long:"log-level" description:"Minimum level of the diagnostic messages" choice:"debug" choice:"info" choice:"warn" choice:"error" default:"info"`
+}
+
+// BenchOpts struct used to store the command line arguments of the bench-dns subcommand.
+type BenchOpts struct {
+	Resolvers string `short:"r" long:"resolvers" description:"Resolvers to compare" value-name:"ADDRS" required:"true"`
+	Domain    string `short:"d" long:"domain" description:"Domain of the NXDOMAIN test names" default:"example.com"`
+
+	Log LogOpts `group:"Logging Options"`
+}
+
+// Exit codes of the program.
+const (
+	exitError     = 1
+	exitNoResults = 2
+	// Most DNS lookups failed for the same reason or the run timed out, the results are likely incomplete.
+	exitIncomplete = 3
+	// Domains missing from the --diff baseline were found with --fail-on-new. Distinct from the errors, so pipelines
+	// can tell a new asset from a failed run.
+	exitNewDomains = 4
+	// The run was interrupted, the results are partial. 130 is what shells report for a program killed by SIGINT.
+	exitInterrupted = 130
+)
+
+// Values accepted by the --match-type option and the crt.sh match types they stand for.
+var matchTypes = map[string]string{
+	"ilike": internal.MatchILike,
+	"like":  internal.MatchLike,
+	"exact": internal.MatchExact,
 }
 
 // Main entry point.
 func main() {
-	opts, err := parseArgs(os.Args)
+	if len(os.Args) > 1 && os.Args[1] == "bench-dns" {
+		benchDNS(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "completion" {
+		completion(os.Args[2:])
+		return
+	}
+
+	opts, err := parseArgs(os.Args[1:])
 	if err != nil {
 		fmt.Println(err)
 		_, usage := parseArgs([]string{"-h"})
 		fmt.Println(usage)
 		return
 	}
-	if err := internal.Execute(&internal.Flags{
-		Domain:      opts.Domain,
-		PlainOutput: opts.Plain,
-		WordsFile:   opts.File}); err != nil {
-		panic(err)
+	if opts.Fields == internal.FieldsHelp {
+		_ = internal.WriteFieldsHelp(os.Stdout)
 		return
 	}
+	handler := newLogHandler(opts.Log)
+	if opts.DomainF != "" {
+		if err := readDomainFile(opts, handler); err != nil {
+			fail(handler, err)
+		}
+	}
+	var domainFields map[string]map[string]any
+	if opts.JSONL != "" {
+		if domainFields, err = readJSONLInput(opts, handler); err != nil {
+			fail(handler, err)
+		}
+	}
+	stopProfile, err := startProfile(opts.Profile)
+	if err != nil {
+		fail(handler, err)
+	}
+	// The output file receives the results, unless an export is written to it. They are written to a temporary file
+	// next to it, which replaces it once the run has written them, so runs failing early keep the previous results.
+	output := os.Stdout
+	if opts.Output != "" && opts.Export == "" {
+		if output, err = createOutput(opts.Output); err != nil {
+			fail(handler, err)
+		}
+	}
+	// The first interrupt stops the run gracefully, a second one kills the program.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	// The table and CSV formats name their columns unless the header row is turned off.
+	headers := opts.Headers == "true" ||
+		(opts.Headers == "" && (opts.Format == internal.FormatTable || opts.Format == internal.FormatCSV))
+	err = internal.Execute(ctx, &internal.Config{
+		Writer:            output,
+		Domains:           opts.Domain,
+		DomainFields:      domainFields,
+		PlainOutput:       opts.Plain,
+		Verbosity:         len(opts.Verbose),
+		WordsFile:         opts.File,
+		WordlistDedup:     opts.Dedup,
+		SNI:               opts.SNI,
+		Template:          opts.Tmpl,
+		TemplateFile:      opts.TmplF,
+		SourceIP:          opts.Source,
+		Interface:         opts.Iface,
+		SlowThreshold:     opts.Slow,
+		CertificateFields: splitList(opts.CrtField),
+		OutputHeaders:     headers,
+		Wide:              opts.Wide,
+		HttpxCompatible:   opts.Httpx,
+		Fields:            splitList(opts.Fields),
+		Format:            opts.Format,
+		UniqueIPsOnly:     opts.UniqIPs,
+		GroupBySubnet:     opts.BySubnet,
+		Diff:              opts.Diff,
+		FailOnNew:         opts.FailNew,
+		Allowlist:         opts.Allow,
+		PrintHashOnly:     opts.Hash,
+		DedupeSAN:         opts.SANs,
+		PEMFile:           opts.PEM,
+		Org:               opts.Org,
+		MatchType:         matchTypes[opts.Match],
+		DeepCerts:         opts.Deep,
+		DeepCertsMax:      opts.DeepMax,
+		Deduplicate:       !opts.NoDedup,
+		Retries:           opts.Retry,
+		RetryOnHTML:       opts.RetryOnHTML == "true",
+		CrtShURLs:         splitList(opts.CrtURL),
+		PermuteLabels:     opts.Permute,
+		AnonymizeIPs:      opts.AnonIPs,
+		StripDomain:       opts.Strip,
+		Timestamps:        opts.Stamps,
+		BogusIPsFile:      opts.Bogus,
+		HideSinkholed:     opts.Hide,
+		TLSOnly:           opts.TLSOnly,
+		NoTLS:             opts.NoTLS,
+		TyposquatCheck:    opts.Typos,
+		TagFilter:         splitList(opts.TagIn),
+		CompareDomain:     opts.Compare,
+		MinDomains:        opts.MinDoms,
+		MaxCandidates:     opts.MaxCands,
+		Doctor:            opts.Doctor,
+		SkipPreflight:     opts.SkipPre,
+		DNSServers:        splitList(opts.Servers),
+		DNSServerFile:     opts.ServersF,
+		Record:            opts.Record,
+		Replay:            opts.Replay,
+		HostsFile:         opts.Hosts,
+		ResolveRetries:    opts.ResRetry,
+		SOACheck:          opts.SOA,
+		MaxConcurrency:    opts.Concur,
+		Timeout:           opts.Timeout,
+		NoFallback:        opts.NoFallbk,
+		Resolver:          opts.Resolver,
+		NATSURL:           opts.NATS,
+		NATSSubject:       opts.NATSSubj,
+		Syslog:            opts.Syslog || opts.SyslogAd != "",
+		SyslogAddr:        opts.SyslogAd,
+		AllRecords:        opts.AllRecs,
+		FollowCNAME:       opts.FollowCN,
+		SplunkURL:         opts.Splunk,
+		SplunkToken:       opts.SplunkTk,
+		Export:            opts.Export,
+		Output:            opts.Output,
+		ElasticIndex:      opts.ESIndex,
+		ElasticURL:        opts.ESURL,
+		TagExclude:        splitList(opts.TagOut),
+		Fuzz:              opts.Fuzz,
+		Ports:             splitList(opts.Ports),
+		OpenPortsOnly:     opts.OpenOnly,
+		NumberSuffixMin:   opts.Numbers.Min,
+		NumberSuffixMax:   opts.Numbers.Max,
+		HTTP: internal.HTTPOpts{
+			CACertFile:        opts.HTTP.CACert,
+			TrustStoreFile:    opts.HTTP.TrustStore,
+			ClientCertFile:    opts.HTTP.ClientCert,
+			ClientKeyFile:     opts.HTTP.ClientKey,
+			ClientP12File:     opts.HTTP.ClientP12,
+			ClientP12Password: opts.HTTP.ClientPass,
+			Insecure:          opts.HTTP.Insecure,
+			Timeout:           opts.HTTP.CrtTimeout,
+			Headers:           opts.HTTP.Headers,
+			APIKey:            opts.HTTP.APIKey,
+			APIKeyHeader:      opts.HTTP.APIKeyHdr,
+		},
+		LogHandler: handler})
+	if profileErr := stopProfile(); err == nil {
+		err = profileErr
+	}
+	if output != os.Stdout {
+		if closeErr := closeOutput(output, opts.Output, err); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			slog.New(handler).Info("wrote the results", "file", opts.Output)
+		}
+	}
+	if err != nil {
+		fail(handler, err)
+	}
+}
+
+// Create the temporary file the results are written to before they replace the file at the path.
+func createOutput(path string) (*os.File, error) {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Chmod(0644); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// Close the temporary output file and move it to the path if the run wrote its results, which runs cut short, with
+// too few results or with new domains also do. After other errors, it is removed and the file at the path is left
+// untouched.
+func closeOutput(f *os.File, path string, runErr error) error {
+	err := f.Close()
+	wrote := runErr == nil || errors.Is(runErr, internal.ErrInterrupted) || errors.Is(runErr, internal.ErrTimedOut) ||
+		errors.Is(runErr, internal.ErrNoResults) || errors.Is(runErr, internal.ErrIncompleteResults) ||
+		errors.Is(runErr, internal.ErrNewDomains)
+	if err == nil && wrote {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil || !wrote {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// Start profiling the program as requested by the options. The returned function stops the profiling and writes the
+// profile; it has to be called before the program exits.
+func startProfile(opts ProfileOpts) (func() error, error) {
+	if opts.Kind == "" {
+		return func() error { return nil }, nil
+	}
+	path := opts.Output
+	if path == "" {
+		path = opts.Kind + ".prof"
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Kind == "cpu" {
+		if err := pprof.StartCPUProfile(f); err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return func() error {
+			pprof.StopCPUProfile()
+			return f.Close()
+		}, nil
+	}
+
+	return func() error {
+		// Run a garbage collection first, so the profile reflects the live heap.
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			_ = f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+// Run the bench-dns subcommand with the arguments following the subcommand name.
+func benchDNS(args []string) {
+	opts := BenchOpts{}
+	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
+	parser.Name = "domain-recon bench-dns"
+	if _, err := parser.ParseArgs(args); err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	handler := newLogHandler(opts.Log)
+	if err := internal.BenchDNS(&internal.BenchFlags{
+		Resolvers:  splitList(opts.Resolvers),
+		Domain:     opts.Domain,
+		LogHandler: handler}); err != nil {
+		fail(handler, err)
+	}
+}
+
+// Add the domains of the domain file, or of the standard input if the file is "-", to the target domains.
+func readDomainFile(opts *Opts, handler slog.Handler) error {
+	input, name, err := openInput(opts.DomainF)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	domains, err := internal.ReadDomains(input, name, handler)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if len(domains) == 0 {
+		return fmt.Errorf("%s: no domains to scan", name)
+	}
+	for _, domain := range domains {
+		if !containsString(opts.Domain, domain) {
+			opts.Domain = append(opts.Domain, domain)
+		}
+	}
+	return nil
+}
+
+// Add the domains of the JSONL input to the target domains. Returns the other fields of each line by domain.
+func readJSONLInput(opts *Opts, handler slog.Handler) (map[string]map[string]any, error) {
+	input, name, err := openInput(opts.JSONL)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+	targets, err := internal.ReadJSONLTargets(input, name, handler)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s: no domains to scan", name)
+	}
+	fields := make(map[string]map[string]any)
+	for _, target := range targets {
+		if !containsString(opts.Domain, target.Domain) {
+			opts.Domain = append(opts.Domain, target.Domain)
+		}
+		if target.Fields != nil {
+			fields[target.Domain] = target.Fields
+		}
+	}
+	return fields, nil
+}
+
+// Open the file, or the standard input if the path is "-". Returns the name used in messages about the input.
+func openInput(path string) (*os.File, string, error) {
+	if path == "-" {
+		return os.Stdin, "stdin", nil
+	}
+	file, err := os.Open(path)
+	return file, path, err
+}
+
+// Check whether the standard input is a pipe, as in "cat targets.txt | domain-recon".
+func stdinIsPipe() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
+
+// Check whether the list contains the value.
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Split a comma-separated list, dropping the blank items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Create the handler writing diagnostic messages to stderr. The values are validated by go-flags, so errors cannot
+// happen here.
+func newLogHandler(opts LogOpts) slog.Handler {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(opts.Level))
+	handler, _ := internal.NewLogHandler(os.Stderr, opts.Format, level)
+	return handler
+}
+
+// Log the error which stopped the program and exit with a non-zero status code. Finding nothing is not logged as an
+// error, since it has already been explained to the user, but it has its own exit code.
+func fail(handler slog.Handler, err error) {
+	// Checked first, the run may also have found nothing before the deadline. The results are as incomplete as when
+	// the lookups fail.
+	if errors.Is(err, internal.ErrTimedOut) {
+		slog.New(handler).Warn("timed out, partial results", "error", err)
+		os.Exit(exitIncomplete)
+	}
+	if errors.Is(err, internal.ErrNoResults) {
+		os.Exit(exitNoResults)
+	}
+	// The reason has already been logged as a warning.
+	if errors.Is(err, internal.ErrIncompleteResults) {
+		os.Exit(exitIncomplete)
+	}
+	// The new domains have already been written.
+	if errors.Is(err, internal.ErrNewDomains) {
+		os.Exit(exitNewDomains)
+	}
+	if errors.Is(err, internal.ErrInterrupted) {
+		slog.New(handler).Warn("interrupted, partial results")
+		os.Exit(exitInterrupted)
+	}
+	slog.New(handler).Error("domain-recon failed", "error", err)
+	os.Exit(exitError)
 }
 
 // Parse input arguments. Returns an object type of Opts with the result of the parsing. The secondary return argument
@@ -37,11 +551,129 @@ func main() {
 // return value is nil
 func parseArgs(args []string) (*Opts, error) {
 	opts := Opts{}
+	if len(args) > 0 && args[0] == "doctor" {
+		opts.Doctor = true
+		args = args[1:]
+	}
 
 	parser := flags.NewParser(&opts, flags.HelpFlag|flags.PassDoubleDash)
-	if _, err := parser.ParseArgs(args); err != nil {
+	rest, err := parser.ParseArgs(args)
+	if err != nil {
 		return nil, err
 	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(rest, " "))
+	}
+	// Each -d value may hold a comma-separated list of targets.
+	var domains []string
+	for _, value := range opts.Domain {
+		for _, domain := range splitList(value) {
+			if !containsString(domains, domain) {
+				domains = append(domains, domain)
+			}
+		}
+	}
+	opts.Domain = domains
+	// The domain given as argument may repeat one given with -d, but a different one is most likely a mistake.
+	if positional := opts.Args.Domain; positional != "" && !containsString(opts.Domain, positional) {
+		if len(opts.Domain) > 0 {
+			return nil, fmt.Errorf("the domain argument '%s' conflicts with `--domain'", positional)
+		}
+		opts.Domain = append(opts.Domain, positional)
+	}
+	if option := parser.FindOptionByLongName("workers"); option.IsSet() {
+		if concur := parser.FindOptionByLongName("concurrency"); concur.IsSet() && !concur.IsSetDefault() &&
+			opts.Concur != opts.Workers {
+			return nil, errors.New("`--workers' conflicts with `--concurrency'")
+		}
+		opts.Concur = opts.Workers
+	}
+	if opts.DomainsF != "" {
+		if opts.DomainF != "" && opts.DomainF != opts.DomainsF {
+			return nil, errors.New("`--domains-file' conflicts with `--domain-file'")
+		}
+		opts.DomainF = opts.DomainsF
+	}
+	if opts.MaxScan != 0 {
+		if opts.Timeout != 0 && opts.Timeout != opts.MaxScan {
+			return nil, errors.New("`--max-scan-time' conflicts with `--timeout'")
+		}
+		opts.Timeout = opts.MaxScan
+	}
+	// -o chose the output format before it named the output file. A bare format name still does, a file with such a
+	// name can be written as ./json.
+	if format := parser.FindOptionByLongName("format"); containsString(format.Choices, opts.Output) {
+		if format.IsSet() && !format.IsSetDefault() && opts.Format != opts.Output {
+			return nil, fmt.Errorf("`-o %s' conflicts with `--format %s'", opts.Output, opts.Format)
+		}
+		opts.Format, opts.Output = opts.Output, ""
+	}
+	if opts.OutputF != "" {
+		if opts.Output != "" && opts.Output != opts.OutputF {
+			return nil, errors.New("`--output-file' conflicts with `--output'")
+		}
+		opts.Output = opts.OutputF
+	}
+	if opts.JSON {
+		if opts.Format != internal.FormatText && opts.Format != internal.FormatJSON {
+			return nil, fmt.Errorf("`--json' conflicts with `--format %s'", opts.Format)
+		}
+		opts.Format = internal.FormatJSON
+	}
+	if opts.Profile.Mem != "" {
+		if opts.Profile.Kind == "cpu" {
+			return nil, errors.New("`--profile-mem' conflicts with `--profile cpu'")
+		}
+		if opts.Profile.Output != "" && opts.Profile.Output != opts.Profile.Mem {
+			return nil, errors.New("`--profile-mem' conflicts with `--profile-output'")
+		}
+		opts.Profile.Kind, opts.Profile.Output = "mem", opts.Profile.Mem
+	}
+
+	// Listing the fields and checking the components need no domain.
+	if opts.Fields == internal.FieldsHelp || opts.Doctor {
+		return &opts, nil
+	}
+
+	// Without a target, the domains are read from the standard input if something is piped to it.
+	if len(opts.Domain) == 0 && opts.DomainF == "" && opts.JSONL == "" && opts.Org == "" && opts.PEM == "" &&
+		stdinIsPipe() {
+		opts.DomainF = "-"
+	}
+	sources := 0
+	for _, source := range []string{strings.Join(opts.Domain, ",") + opts.DomainF + opts.JSONL, opts.Org, opts.PEM} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, errors.New("exactly one of a domain, `--org' or `--pem-file' has to be specified")
+	}
 
 	return &opts, nil
 }
+
+// numberRange type used to parse a range of numbers given as "MIN-MAX" or as "MAX", which starts from 1.
+type numberRange struct {
+	Min int
+	Max int
+}
+
+// UnmarshalFlag parses the range from the command line argument.
+func (r *numberRange) UnmarshalFlag(value string) error {
+	minText, maxText, found := strings.Cut(value, "-")
+	if !found {
+		minText, maxText = "1", value
+	}
+	var err error
+	if r.Min, err = strconv.Atoi(strings.TrimSpace(minText)); err != nil {
+		return fmt.Errorf("invalid range %q", value)
+	}
+	if r.Max, err = strconv.Atoi(strings.TrimSpace(maxText)); err != nil {
+		return fmt.Errorf("invalid range %q", value)
+	}
+	if r.Min < 1 || r.Max < r.Min {
+		return fmt.Errorf("invalid range %q, expected MIN-MAX with 1 <= MIN <= MAX", value)
+	}
+	return nil
+}
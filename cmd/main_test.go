@@ -0,0 +1,184 @@
+package main
+
+import (
+	"domain-recon/internal"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCloseOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		runErr error
+		want   string
+	}{
+		{name: "success", want: "new"},
+		{name: "interrupted", runErr: fmt.Errorf("%w: crt.sh", internal.ErrInterrupted), want: "new"},
+		{name: "too few results", runErr: internal.ErrNoResults, want: "new"},
+		{name: "new domains", runErr: internal.ErrNewDomains, want: "new"},
+		{name: "invalid flags", runErr: errors.New("--record and --replay cannot be used together"), want: "old"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "results.txt")
+			if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			f, err := createOutput(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.WriteString("new"); err != nil {
+				t.Fatal(err)
+			}
+			if err := closeOutput(f, path, test.runErr); err != nil {
+				t.Fatal(err)
+			}
+			if content, _ := os.ReadFile(path); string(content) != test.want {
+				t.Errorf("file holds %q, want %q", content, test.want)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+				t.Errorf("temporary file left behind: %v", entries)
+			}
+		})
+	}
+}
+
+func TestParseArgsDomains(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "positional only", args: []string{"example.com"}, want: []string{"example.com"}},
+		{name: "flag only", args: []string{"-d", "example.com"}, want: []string{"example.com"}},
+		{name: "long flag", args: []string{"--domain=example.com"}, want: []string{"example.com"}},
+		{name: "both matching", args: []string{"-d", "example.com", "example.com"}, want: []string{"example.com"}},
+		{name: "list and positional", args: []string{"-d", "example.com,example.org", "example.org"},
+			want: []string{"example.com", "example.org"}},
+		{name: "positional before flags", args: []string{"example.com", "-p", "--format", "json"},
+			want: []string{"example.com"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts, err := parseArgs(test.args)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(opts.Domain, test.want) {
+				t.Errorf("got %q, want %q", opts.Domain, test.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		// The program name is not part of the arguments, it would be taken for a second positional domain.
+		{name: "program name", args: []string{"domain-recon", "example.com"}, err: "unexpected arguments: example.com"},
+		{name: "two positional domains", args: []string{"example.com", "example.org"},
+			err: "unexpected arguments: example.org"},
+		{name: "both different", args: []string{"-d", "example.com", "example.org"},
+			err: "the domain argument 'example.org' conflicts with `--domain'"},
+		{name: "domain and organization", args: []string{"example.com", "--org", "Example Inc"},
+			err: "exactly one of a domain"},
+		{name: "unknown flag", args: []string{"-d", "example.com", "--no-such-flag"}, err: "unknown flag"},
+		{name: "format with -o and --format", args: []string{"-d", "example.com", "-o", "json", "--format", "yaml"},
+			err: "`-o json' conflicts with `--format yaml'"},
+		{name: "output file twice", args: []string{"-d", "example.com", "-o", "a.txt", "--output-file", "b.txt"},
+			err: "`--output-file' conflicts with `--output'"},
+		{name: "domain file twice", args: []string{"--domain-file", "a.txt", "--domains-file", "b.txt"},
+			err: "`--domains-file' conflicts with `--domain-file'"},
+		{name: "heap and cpu profiles", args: []string{"-d", "example.com", "--profile-mem", "heap.prof", "--profile",
+			"cpu"}, err: "`--profile-mem' conflicts with `--profile cpu'"},
+		{name: "workers and concurrency", args: []string{"-d", "example.com", "--workers", "8", "--concurrency", "16"},
+			err: "`--workers' conflicts with `--concurrency'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseArgs(test.args); err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestParseArgsDomainsFile(t *testing.T) {
+	for _, args := range [][]string{{"--domains-file", "targets.txt"},
+		{"--domains-file", "targets.txt", "--domain-file", "targets.txt"}} {
+		opts, err := parseArgs(args)
+		if err != nil {
+			t.Fatalf("%q: %v", args, err)
+		}
+		if opts.DomainF != "targets.txt" {
+			t.Errorf("%q: got domain file %q, want targets.txt", args, opts.DomainF)
+		}
+	}
+}
+
+func TestParseArgsConcurrency(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{args: []string{"-d", "example.com"}, want: 50},
+		{args: []string{"-d", "example.com", "--concurrency", "8"}, want: 8},
+		{args: []string{"-d", "example.com", "--workers", "0"}, want: 0},
+		{args: []string{"-d", "example.com", "--workers", "8", "--concurrency", "8"}, want: 8},
+	}
+	for _, test := range tests {
+		opts, err := parseArgs(test.args)
+		if err != nil {
+			t.Fatalf("%q: %v", test.args, err)
+		}
+		if opts.Concur != test.want {
+			t.Errorf("%q: got concurrency %d, want %d", test.args, opts.Concur, test.want)
+		}
+	}
+}
+
+func TestParseArgsProfileMem(t *testing.T) {
+	opts, err := parseArgs([]string{"-d", "example.com", "--profile-mem", "heap.prof"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Profile.Kind != "mem" || opts.Profile.Output != "heap.prof" {
+		t.Errorf("got profile %+v, want a heap profile written to heap.prof", opts.Profile)
+	}
+}
+
+func TestParseArgsOutputFormat(t *testing.T) {
+	tests := []struct {
+		args   []string
+		format string
+		output string
+	}{
+		{args: []string{"-o", "json"}, format: internal.FormatJSON},
+		{args: []string{"--output", "yaml"}, format: internal.FormatYAML},
+		{args: []string{"-o", "json", "--format", "json"}, format: internal.FormatJSON},
+		{args: []string{"-o", "./json"}, format: internal.FormatText, output: "./json"},
+		{args: []string{"-o", "results.json", "--json"}, format: internal.FormatJSON, output: "results.json"},
+		{args: []string{"--output-file", "results.txt"}, format: internal.FormatText, output: "results.txt"},
+		{args: []string{"-o", "json", "--output-file", "json"}, format: internal.FormatJSON, output: "json"},
+	}
+	for _, test := range tests {
+		opts, err := parseArgs(append([]string{"-d", "example.com"}, test.args...))
+		if err != nil {
+			t.Fatalf("%q: %v", test.args, err)
+		}
+		if opts.Format != test.format || opts.Output != test.output {
+			t.Errorf("%q: got format %q and output %q, want %q and %q", test.args, opts.Format, opts.Output,
+				test.format, test.output)
+		}
+	}
+}
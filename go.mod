@@ -1,9 +1,11 @@
 module domain-recon
 
-go 1.18
+go 1.21
 
 require (
-	github.com/jessevdk/go-flags v1.5.0 // indirect
-	golang.org/x/exp v0.0.0-20220713135740-79cabaa25d75 // indirect
-	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
+	github.com/jessevdk/go-flags v1.5.0
+	golang.org/x/crypto v0.17.0
+	golang.org/x/exp v0.0.0-20220713135740-79cabaa25d75
 )
+
+require golang.org/x/sys v0.15.0 // indirect
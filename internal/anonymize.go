@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"net"
+	"strings"
+)
+
+// Redact the host part of an IP address for display: the last octet of an IPv4 address is replaced with x, and the
+// last 64 bits of an IPv6 address are cleared, leaving the /64 prefix.
+func anonymizeIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		s := ip4.String()
+		return s[:strings.LastIndexByte(s, '.')+1] + "x"
+	}
+	prefix := ip.Mask(net.CIDRMask(64, 128))
+	return prefix.String() + "/64"
+}
+
+// Clear the host part of an IP address like anonymizeIP, keeping it an address: 192.0.2.7 becomes 192.0.2.0.
+func maskIP(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(64, 128))
+}
+
+// Format an IP address for display, redacted if the result is anonymized.
+func (r DNSLookupResult) displayIP(ip net.IP) string {
+	if r.anonymized {
+		return anonymizeIP(ip)
+	}
+	return ip.String()
+}
+
+// Return every IP address of the domain formatted for display.
+func (r DNSLookupResult) displayIPs() []string {
+	ips := make([]string, 0, len(r.Ips))
+	for _, ip := range r.Ips {
+		ips = append(ips, r.displayIP(ip))
+	}
+	return ips
+}
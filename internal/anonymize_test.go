@@ -0,0 +1,49 @@
+package internal
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := map[string]string{
+		"192.0.2.7":         "192.0.2.x",
+		"2001:db8:1:2:3::4": "2001:db8:1:2::/64",
+	}
+	for ip, want := range tests {
+		if got := anonymizeIP(net.ParseIP(ip)); got != want {
+			t.Errorf("anonymizeIP(%s) = %s, want %s", ip, got, want)
+		}
+	}
+}
+
+func TestHostTemplateAnonymizesIps(t *testing.T) {
+	tmpl, err := parseHostTemplate(`{{.Name}} {{.Ips}} {{join .IPv4 ","}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := DNSLookupResult{Domain: "a.example.com", Ips: []net.IP{net.ParseIP("192.0.2.7")}, anonymized: true}
+	var out bytes.Buffer
+	if err := executeHostTemplate(&out, tmpl, result); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out.String(), "192.0.2.7") {
+		t.Errorf("template output reveals the address: %q", out.String())
+	}
+	if want := "a.example.com [192.0.2.0] 192.0.2.x\n"; out.String() != want {
+		t.Errorf("template output %q, want %q", out.String(), want)
+	}
+}
+
+func TestSharedInfrastructureAnonymized(t *testing.T) {
+	ip := []net.IP{net.ParseIP("192.0.2.7")}
+	var out bytes.Buffer
+	opts := printOpts{out: &out, anonymizeIPs: true}
+	printSharedInfrastructure("example.com", []DNSLookupResult{{Domain: "a.example.com", Ips: ip}},
+		"example.net", []DNSLookupResult{{Domain: "b.example.net", Ips: ip}}, opts)
+	if strings.Contains(out.String(), "192.0.2.7") || !strings.Contains(out.String(), "192.0.2.x") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrNewDomains is returned by Execute when Config.FailOnNew is set and domains missing from the baseline were found.
+// The new domains have been written.
+var ErrNewDomains = errors.New("new domains found")
+
+// Read the domains of a baseline, written by an earlier run with the JSON output or listing one domain per line, such
+// as the --plain output. In the JSON file, every "domain" value of the objects listed at the top level, or in the lists
+// of the top-level report object, is part of the baseline. In the list, blank lines and comment lines starting with "#"
+// are skipped.
+func readBaseline(baselinePath string) (map[string]bool, error) {
+	content, err := os.ReadFile(baselinePath)
+	if err != nil {
+		return nil, err
+	}
+	domains := make(map[string]bool)
+	if trimmed := bytes.TrimSpace(content); bytes.HasPrefix(trimmed, []byte("[")) ||
+		bytes.HasPrefix(trimmed, []byte("{")) {
+		var document any
+		if err := json.Unmarshal(content, &document); err != nil {
+			return nil, fmt.Errorf("%s: %w", baselinePath, err)
+		}
+		lists := []any{document}
+		if object, ok := document.(map[string]any); ok {
+			lists = lists[:0]
+			for _, value := range object {
+				lists = append(lists, value)
+			}
+		}
+		for _, list := range lists {
+			entries, _ := list.([]any)
+			for _, entry := range entries {
+				if object, ok := entry.(map[string]any); ok {
+					if domain, ok := object["domain"].(string); ok {
+						domains[strings.ToLower(domain)] = true
+					}
+				}
+			}
+		}
+		return domains, nil
+	}
+	names, _, err := readWords(baselinePath, false)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		domains[strings.ToLower(name)] = true
+	}
+	return domains, nil
+}
+
+// Return the resolved domains missing from the baseline and matching none of the allowlist patterns, sorted. The
+// patterns are shell patterns, such as *.dev.example.com.
+func newDomains(baseline map[string]bool, allowlist []string, results ...[]DNSLookupResult) []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, list := range results {
+		for _, result := range list {
+			domain := strings.ToLower(result.Domain)
+			if baseline[domain] || seen[domain] || allowed(allowlist, domain) {
+				continue
+			}
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Check whether the domain matches one of the allowlist patterns.
+func allowed(allowlist []string, domain string) bool {
+	for _, pattern := range allowlist {
+		if matched, _ := path.Match(strings.ToLower(pattern), domain); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Read the allowlist of domains expected to be new, one shell pattern per line. Blank lines and comment lines starting
+// with "#" are skipped.
+func readAllowlist(allowlistPath string) ([]string, error) {
+	patterns, _, err := readWords(allowlistPath, true)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%s: invalid pattern '%s': %w", allowlistPath, pattern, err)
+		}
+	}
+	return patterns, nil
+}
@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadBaseline(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"list.txt":   "# example.com\nwww.example.com\n\nAPI.example.com\n",
+		"array.json": `[{"domain": "www.example.com"}, {"domain": "API.example.com", "extended": true}]`,
+		"report.json": `{"certificates": [{"id": 1}], "domains": [{"domain": "www.example.com"}],
+			"extended_domains": [{"domain": "API.example.com"}], "counts": {"domains": 1}}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		baseline, err := readBaseline(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		want := map[string]bool{"www.example.com": true, "api.example.com": true}
+		if !reflect.DeepEqual(baseline, want) {
+			t.Errorf("%s: got %v, want %v", name, baseline, want)
+		}
+	}
+}
+
+func TestNewDomains(t *testing.T) {
+	baseline := map[string]bool{"www.example.com": true}
+	allowlist := []string{"*.preview.example.com"}
+	results := []DNSLookupResult{{Domain: "www.example.com"}, {Domain: "pr-12.preview.example.com"},
+		{Domain: "vpn.example.com"}}
+	extended := []DNSLookupResult{{Domain: "Admin.example.com"}, {Domain: "vpn.example.com"}}
+
+	got := newDomains(baseline, allowlist, results, extended)
+	if want := []string{"admin.example.com", "vpn.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
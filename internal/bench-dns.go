@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// BenchFlags holds the settings of the DNS resolver benchmark.
+type BenchFlags struct {
+	Resolvers []string
+	Domain    string
+	// Handler receiving the diagnostic messages. If nil, the default slog logger is used.
+	LogHandler slog.Handler
+}
+
+// Popular domain names which are expected to be resolvable by any public resolver.
+var benchPopularNames = []string{
+	"google.com", "youtube.com", "facebook.com", "wikipedia.org", "amazon.com",
+	"twitter.com", "instagram.com", "linkedin.com", "microsoft.com", "apple.com",
+	"github.com", "cloudflare.com", "netflix.com", "reddit.com", "yahoo.com",
+	"bing.com", "office.com", "zoom.us", "stackoverflow.com", "mozilla.org",
+}
+
+// Number of guaranteed non-existing names generated under the target domain for each benchmark run.
+const benchNXDomainNames = 20
+
+// Concurrency levels tried against each resolver, in increasing order.
+var benchConcurrencyLevels = []int{1, 10, 25, 50, 100, 200}
+
+// Maximum share of failed queries at a concurrency level which is still considered acceptable.
+const benchMaxErrorRate = 0.01
+
+// benchQuery struct used to store a test query and whether it is expected to return NXDOMAIN.
+type benchQuery struct {
+	Name     string
+	NXDomain bool
+}
+
+// benchLevelResult struct used to store the measurements of one resolver at a given concurrency level.
+type benchLevelResult struct {
+	Concurrency int
+	Queries     int
+	Errors      int
+	ServFails   int
+	P50         time.Duration
+	P90         time.Duration
+	P99         time.Duration
+}
+
+// ErrorRate returns the share of failed queries.
+func (r benchLevelResult) ErrorRate() float64 {
+	if r.Queries == 0 {
+		return 0
+	}
+	return float64(r.Errors) / float64(r.Queries)
+}
+
+// benchResolverResult struct used to store every measurement of a resolver.
+type benchResolverResult struct {
+	Resolver Resolver
+	Levels   []benchLevelResult
+	// Concurrency level at which the first SERVFAIL was seen, 0 if there was none.
+	ServFailAt int
+}
+
+// BenchDNS benchmarks each resolver with a fixed set of queries at increasing concurrency levels, prints the measured
+// latencies and error rates, and recommends the resolver and concurrency to use.
+func BenchDNS(flags *BenchFlags) error {
+	if len(flags.Resolvers) == 0 {
+		return fmt.Errorf("no resolvers to benchmark")
+	}
+
+	logger := newLogger(flags.LogHandler)
+	names := benchQueryNames(flags.Domain)
+
+	var results []benchResolverResult
+	for _, address := range flags.Resolvers {
+		resolver := NewResolver(address, nil)
+		logger.Info("benchmarking resolver", logKeySource, resolver.String())
+		start := time.Now()
+		results = append(results, benchResolver(resolver, names))
+		logger.Debug("finished benchmarking resolver", logKeySource, resolver.String(),
+			logKeyDuration, time.Since(start))
+	}
+
+	printBenchResults(results)
+	return nil
+}
+
+// Build the list of test queries: popular names which should resolve and random names under the target domain which
+// are guaranteed to return NXDOMAIN.
+func benchQueryNames(domain string) []benchQuery {
+	var queries []benchQuery
+	for _, name := range benchPopularNames {
+		queries = append(queries, benchQuery{Name: name})
+	}
+	for i := 0; i < benchNXDomainNames; i++ {
+		queries = append(queries, benchQuery{
+			Name:     fmt.Sprintf("domain-recon-bench-%016x.%s", rand.Uint64(), domain),
+			NXDomain: true,
+		})
+	}
+	return queries
+}
+
+// Run the benchmark against a single resolver. The concurrency is increased until the resolver starts answering with
+// SERVFAIL, after which there is no point in pushing further.
+func benchResolver(resolver Resolver, queries []benchQuery) benchResolverResult {
+	result := benchResolverResult{Resolver: resolver}
+	for _, concurrency := range benchConcurrencyLevels {
+		level := benchLevel(resolver, queries, concurrency)
+		result.Levels = append(result.Levels, level)
+		if level.ServFails > 0 {
+			result.ServFailAt = concurrency
+			break
+		}
+	}
+	return result
+}
+
+// Fire the test queries at a resolver with the given concurrency. Each worker goes through the whole query set, so
+// higher levels put proportionally more load on the resolver.
+func benchLevel(resolver Resolver, queries []benchQuery, concurrency int) benchLevelResult {
+	type sample struct {
+		latency time.Duration
+		class   string
+	}
+
+	jobs := make(chan benchQuery)
+	samples := make(chan sample)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for query := range jobs {
+				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				start := time.Now()
+				_, err := resolver.LookupIP(ctx, query.Name)
+				latency := time.Since(start)
+				cancel()
+
+				var class string
+				if err != nil {
+					class = classifyLookupError(err)
+					if query.NXDomain && class == lookupErrNXDomain {
+						class = ""
+					}
+				}
+				samples <- sample{latency: latency, class: class}
+			}
+		}()
+	}
+
+	go func() {
+		for i := 0; i < concurrency; i++ {
+			for _, query := range queries {
+				jobs <- query
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(samples)
+	}()
+
+	result := benchLevelResult{Concurrency: concurrency}
+	var latencies []time.Duration
+	for s := range samples {
+		result.Queries++
+		latencies = append(latencies, s.latency)
+		if s.class != "" {
+			result.Errors++
+		}
+		if s.class == lookupErrServFail {
+			result.ServFails++
+		}
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	result.P50 = percentile(latencies, 50)
+	result.P90 = percentile(latencies, 90)
+	result.P99 = percentile(latencies, 99)
+	return result
+}
+
+// Return the p-th percentile of a sorted slice of durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := (len(sorted)*p+99)/100 - 1
+	if index < 0 {
+		index = 0
+	}
+	return sorted[index]
+}
+
+// Print the measurements of every resolver followed by a recommendation.
+func printBenchResults(results []benchResolverResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOLVER\tCONCURRENCY\tQUERIES\tERRORS\tSERVFAIL\tP50\tP90\tP99")
+	for _, result := range results {
+		for _, level := range result.Levels {
+			fmt.Fprintf(w, "%s\t%d\t%d\t%.1f%%\t%d\t%s\t%s\t%s\n",
+				result.Resolver, level.Concurrency, level.Queries, level.ErrorRate()*100, level.ServFails,
+				level.P50.Round(time.Millisecond), level.P90.Round(time.Millisecond),
+				level.P99.Round(time.Millisecond))
+		}
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+	for _, result := range results {
+		if result.ServFailAt > 0 {
+			fmt.Printf("%s started returning SERVFAIL at concurrency %d\n", result.Resolver, result.ServFailAt)
+		}
+	}
+
+	best, level, ok := recommend(results)
+	if !ok {
+		fmt.Println("Recommendation: none of the resolvers answered reliably, even without concurrency")
+		return
+	}
+	fmt.Printf("Recommendation: use resolver %s with a concurrency of at most %d (p50 %s)\n",
+		best.Resolver, level.Concurrency, level.P50.Round(time.Millisecond))
+}
+
+// Pick the resolver with the lowest median latency at its highest reliable concurrency level. A level is reliable if
+// its error rate does not exceed benchMaxErrorRate and it produced no SERVFAIL answers.
+func recommend(results []benchResolverResult) (benchResolverResult, benchLevelResult, bool) {
+	var best benchResolverResult
+	var bestLevel benchLevelResult
+	found := false
+	for _, result := range results {
+		var reliable *benchLevelResult
+		for i, level := range result.Levels {
+			if level.ServFails > 0 || level.ErrorRate() > benchMaxErrorRate {
+				break
+			}
+			reliable = &result.Levels[i]
+		}
+		if reliable == nil {
+			continue
+		}
+		if !found || reliable.P50 < bestLevel.P50 {
+			best, bestLevel, found = result, *reliable, true
+		}
+	}
+	return best, bestLevel, found
+}
@@ -0,0 +1,39 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Check that the number of names to resolve does not exceed flags.MaxCandidates. Above the limit, interactive runs ask
+// for confirmation, the others and library runs are stopped with an error explaining how to proceed.
+func checkCandidateCount(flags *Config, count int) error {
+	if flags.MaxCandidates <= 0 || count <= flags.MaxCandidates {
+		return nil
+	}
+	message := fmt.Sprintf("%d names to resolve, more than the limit of %d", count, flags.MaxCandidates)
+	if !flags.noPrompt && isTerminal(os.Stdin) && isTerminal(os.Stderr) {
+		if confirm(os.Stdin, os.Stderr, message+". Continue?") {
+			return nil
+		}
+		return fmt.Errorf("stopped: %s", message)
+	}
+	return fmt.Errorf("%s; raise it with --max-candidates %d, or disable it with --max-candidates 0", message, count)
+}
+
+// Check whether the file is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Ask a yes or no question, answered with no by default.
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
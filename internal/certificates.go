@@ -0,0 +1,174 @@
+package internal
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// OID of the poison extension which marks a certificate as a precertificate (RFC 6962, section 3.1).
+var precertificatePoisonOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+
+// certificateKey struct used to identify a certificate across its CT log entries. A precertificate and the leaf
+// certificate issued from it have the same issuer and serial number.
+type certificateKey struct {
+	issuer int
+	serial string
+}
+
+// Return the key identifying the certificate across its CT log entries.
+func keyOf(cert Certificate) certificateKey {
+	return certificateKey{issuer: cert.IssuerCaId, serial: strings.ToLower(cert.SerialNumber)}
+}
+
+// Mark the precertificates among the entries returned by crt.sh. Since the search results do not say which entry is
+// a precertificate, entries sharing their issuer and serial number with a later logged entry are taken to be
+// precertificates: CAs log the precertificate before issuing the leaf certificate.
+func markPrecertificates(certificates []Certificate) {
+	latest := make(map[certificateKey]int)
+	for i, cert := range certificates {
+		if cert.SerialNumber == "" {
+			continue
+		}
+		k := keyOf(cert)
+		if j, exists := latest[k]; !exists || loggedBefore(certificates[j], cert) {
+			latest[k] = i
+		}
+	}
+
+	for i, cert := range certificates {
+		if j, exists := latest[keyOf(cert)]; exists && cert.SerialNumber != "" && i != j {
+			certificates[i].Precertificate = true
+		}
+	}
+}
+
+// Collapse certificates with the same issuer and serial number into one, keeping the leaf certificate over the
+// precertificate. Keeping both would count every certificate twice.
+func deduplicateCertificates(certificates []Certificate) []Certificate {
+	positions := make(map[certificateKey]int)
+	var unique []Certificate
+	for _, cert := range certificates {
+		if cert.SerialNumber == "" {
+			unique = append(unique, cert)
+			continue
+		}
+		k := keyOf(cert)
+		if i, seen := positions[k]; seen {
+			if unique[i].Precertificate && !cert.Precertificate {
+				unique[i] = cert
+			}
+			continue
+		}
+		positions[k] = len(unique)
+		unique = append(unique, cert)
+	}
+	return unique
+}
+
+// Check whether the CT log entry of a was created before the entry of b.
+func loggedBefore(a Certificate, b Certificate) bool {
+	if a.EntryTimestamp != b.EntryTimestamp {
+		return a.EntryTimestamp < b.EntryTimestamp
+	}
+	return a.Id < b.Id
+}
+
+// Map each domain name to the certificates issued for it.
+func indexCertificates(certificates []Certificate) map[string][]Certificate {
+	index := make(map[string][]Certificate)
+	for _, cert := range certificates {
+		names := make(map[string]bool)
+		for _, name := range cleanDomainNames(append(strings.Split(cert.NameValue, "\n"), cert.CommonName)) {
+			names[name] = true
+		}
+		for name := range names {
+			index[name] = append(index[name], cert)
+		}
+	}
+	return index
+}
+
+// Count the distinct certificates each domain name appears in. The CT log entries of a precertificate and of its leaf
+// certificate are counted once.
+func countCertificatesPerName(certificates []Certificate) map[string]int {
+	counts := make(map[string]int)
+	for name, certs := range indexCertificates(certificates) {
+		distinct := make(map[certificateKey]bool)
+		for _, cert := range certs {
+			k := keyOf(cert)
+			if cert.SerialNumber == "" {
+				k = certificateKey{issuer: cert.IssuerCaId, serial: fmt.Sprintf("id:%d", cert.Id)}
+			}
+			distinct[k] = true
+		}
+		counts[name] = len(distinct)
+	}
+	return counts
+}
+
+// Check whether all the certificates are precertificates. A domain which appears only on precertificates may never
+// have received a certificate, for example because the issuance was aborted.
+func onlyPrecertificates(certificates []Certificate) bool {
+	for _, cert := range certificates {
+		if !cert.Precertificate {
+			return false
+		}
+	}
+	return len(certificates) > 0
+}
+
+// Format the metadata of a certificate as a single line.
+func formatCertificate(cert Certificate) string {
+	kind := "certificate"
+	if cert.Precertificate {
+		kind = "precertificate"
+	}
+	line := fmt.Sprintf("%s %s, issuer: %s, valid: %s - %s", kind, cert.SerialNumber, cert.Issuer,
+		cert.NotBefore, cert.NotAfter)
+	if cert.QuerySource != "" {
+		line += fmt.Sprintf(" (matched via: %s)", cert.QuerySource)
+	}
+	return line
+}
+
+// Fields of a certificate which can be selected for the verbose output, with their values.
+var certificateFields = map[string]func(cert Certificate) string{
+	"id":              func(cert Certificate) string { return strconv.Itoa(cert.Id) },
+	"serial":          func(cert Certificate) string { return cert.SerialNumber },
+	"issuer":          func(cert Certificate) string { return cert.Issuer.String() },
+	"issuer_name":     func(cert Certificate) string { return cert.IssuerName },
+	"issuer_ca_id":    func(cert Certificate) string { return strconv.Itoa(cert.IssuerCaId) },
+	"common_name":     func(cert Certificate) string { return cert.CommonName },
+	"name_value":      func(cert Certificate) string { return strings.ReplaceAll(cert.NameValue, "\n", ",") },
+	"not_before":      func(cert Certificate) string { return cert.NotBefore },
+	"not_after":       func(cert Certificate) string { return cert.NotAfter },
+	"entry_timestamp": func(cert Certificate) string { return cert.EntryTimestamp },
+	"query_source":    func(cert Certificate) string { return cert.QuerySource },
+	"precertificate":  func(cert Certificate) string { return strconv.FormatBool(cert.Precertificate) },
+}
+
+// Check that every certificate field is known.
+func validateCertificateFields(names []string) error {
+	for _, name := range names {
+		if _, ok := certificateFields[name]; !ok {
+			known := maps.Keys(certificateFields)
+			sort.Strings(known)
+			return fmt.Errorf("unknown certificate field %q, expected one of: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// Format the selected fields of a certificate as a single line, in the given order.
+func formatCertificateFields(cert Certificate, names []string) string {
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+": "+certificateFields[name](cert))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// Return the entries of the fixture: three precertificate and leaf certificate pairs, the entries of one of them
+// listed in reverse order and the serial numbers of another in different cases, and a leaf certificate alone.
+func loadPrecertPairs(t *testing.T) []Certificate {
+	content, err := os.ReadFile("testdata/precert-pairs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var certificates []Certificate
+	if err := json.Unmarshal(content, &certificates); err != nil {
+		t.Fatal(err)
+	}
+	for i := range certificates {
+		certificates[i].Issuer = parseIssuerName(certificates[i].IssuerName)
+	}
+	return certificates
+}
+
+func TestMarkPrecertificates(t *testing.T) {
+	certificates := loadPrecertPairs(t)
+	markPrecertificates(certificates)
+	precertificates := map[int]bool{1001: true, 2001: true, 3001: true}
+	for _, cert := range certificates {
+		if cert.Precertificate != precertificates[cert.Id] {
+			t.Errorf("certificate %d: precertificate = %t", cert.Id, cert.Precertificate)
+		}
+	}
+}
+
+func TestDeduplicateCertificatesHalvesPairs(t *testing.T) {
+	certificates := loadPrecertPairs(t)
+	markPrecertificates(certificates)
+	unique := deduplicateCertificates(certificates)
+	if len(unique) != 4 {
+		t.Fatalf("%d certificates after deduplication, want 4", len(unique))
+	}
+	for _, cert := range unique {
+		if cert.Precertificate {
+			t.Errorf("precertificate %d kept over its leaf certificate", cert.Id)
+		}
+	}
+
+	perIssuer := make(map[string]int)
+	for _, cert := range unique {
+		perIssuer[cert.Issuer.String()]++
+	}
+	want := map[string]int{"Let's Encrypt (R3)": 2, "DigiCert Inc (DigiCert TLS RSA SHA256 2020 CA1)": 2}
+	for issuer, count := range want {
+		if perIssuer[issuer] != count {
+			t.Errorf("%s: %d certificates, want %d", issuer, perIssuer[issuer], count)
+		}
+	}
+}
+
+func TestCountCertificatesPerNameHalvesPairs(t *testing.T) {
+	certificates := loadPrecertPairs(t)
+	index := indexCertificates(certificates)
+	counts := countCertificatesPerName(certificates)
+	want := map[string]int{"example.com": 1, "www.example.com": 2, "api.example.com": 1, "mail.example.com": 1}
+	for name, count := range want {
+		if counts[name] != count {
+			t.Errorf("%s: %d certificates, want %d", name, counts[name], count)
+		}
+		// Every name but mail.example.com appears on both entries of its pairs.
+		if entries := len(index[name]); name != "mail.example.com" && entries != 2*count {
+			t.Errorf("%s: %d entries in the fixture, want %d", name, entries, 2*count)
+		}
+	}
+}
+
+func TestLookupCertificatesDeduplicates(t *testing.T) {
+	content, err := os.ReadFile("testdata/precert-pairs.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deduplicate string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deduplicate = r.URL.Query().Get("deduplicate")
+		_, _ = w.Write(content)
+	}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		deduplicate bool
+		param       string
+		count       int
+	}{
+		{deduplicate: true, param: "Y", count: 4},
+		{deduplicate: false, param: "", count: 7},
+	} {
+		opts := testFetchOpts(server, 0)
+		opts.Deduplicate = test.deduplicate
+		certificates, _, err := LookupCertificates(context.Background(), "example.com", opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deduplicate != test.param || len(certificates) != test.count {
+			t.Errorf("deduplicate %t: sent %q and got %d certificates, want %q and %d", test.deduplicate,
+				deduplicate, len(certificates), test.param, test.count)
+		}
+	}
+}
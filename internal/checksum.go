@@ -0,0 +1,53 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// Compute a SHA-256 hash over the canonical form of the results: the lowercase domain names in alphabetical order,
+// each followed by its sorted IP addresses. Two runs finding the same domains resolving to the same addresses produce
+// the same hash, regardless of the order in which the results arrived.
+func contentHash(results ...[]DNSLookupResult) string {
+	hosts := make(map[string][]string)
+	for _, list := range results {
+		for _, result := range list {
+			name := strings.ToLower(strings.TrimSuffix(result.Domain, "."))
+			for _, ip := range result.Ips {
+				hosts[name] = append(hosts[name], ip.String())
+			}
+			if _, exists := hosts[name]; !exists {
+				hosts[name] = nil
+			}
+		}
+	}
+
+	names := make([]string, 0, len(hosts))
+	for name := range hosts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	hash := sha256.New()
+	for _, name := range names {
+		ips := uniqueSorted(hosts[name])
+		hash.Write([]byte(name + " " + strings.Join(ips, ",") + "\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Return the distinct values of the slice in ascending order.
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var unique []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// Return the sorted registrable domains the CNAME records of the results point into, leaving out the targets in scope
+// and the public suffixes. The records must have been looked up. On shared platforms, such as cloudfront.net, the
+// registrable domain is the subdomain of the customer, so the other customers are not pulled in.
+func cnameDomains(inScope func(string) bool, results ...[]DNSLookupResult) []string {
+	found := make(map[string]bool)
+	for _, list := range results {
+		for _, result := range list {
+			if result.Records == nil || result.Records.CNAME == "" || inScope(result.Records.CNAME) {
+				continue
+			}
+			if domain := registrableDomain(result.Records.CNAME); domain != "" {
+				found[domain] = true
+			}
+		}
+	}
+	domains := make([]string, 0, len(found))
+	for domain := range found {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+	return domains
+}
+
+// Look up the certificates of the domains the CNAME records of the results point into, when they are out of scope,
+// and return the names they list which are not known yet. A domain whose certificates cannot be fetched is skipped
+// with a warning, the names found for the other ones are still returned. The names count towards
+// flags.MaxCandidates with the known ones; above the limit, none is returned.
+func cnameDomainNames(ctx context.Context, flags *Config, fetch FetchOpts, logger *slog.Logger,
+	inScope func(string) bool, known []string, results ...[]DNSLookupResult) []string {
+	seen := make(map[string]bool)
+	for _, name := range known {
+		seen[strings.ToLower(name)] = true
+	}
+
+	var names []string
+	for _, domain := range cnameDomains(inScope, results...) {
+		logger.Info("following CNAME records to "+domain, logKeyDomain, domain)
+		certificates, _, err := LookupCertificates(ctx, domain, fetch)
+		if err != nil {
+			if ctx.Err() != nil {
+				return names
+			}
+			logger.Warn(fmt.Sprintf("cannot look up the certificates of '%s'", domain), logKeyError, err)
+			continue
+		}
+		// The wildcards of the followed domains are not extended, the words are chosen for the targets.
+		found, _, _ := getResolvableDomains(certificates, &Config{})
+		for _, name := range found {
+			if !seen[strings.ToLower(name)] {
+				seen[strings.ToLower(name)] = true
+				names = append(names, name)
+			}
+		}
+	}
+	if err := checkCandidateCount(flags, len(known)+len(names)); err != nil {
+		logger.Warn("not resolving the names found for the CNAME targets", logKeyError, err)
+		return nil
+	}
+	return names
+}
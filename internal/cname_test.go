@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// Return a result of the domain with a CNAME record pointing to the target.
+func cnameResult(domain string, target string) DNSLookupResult {
+	return DNSLookupResult{Domain: domain, Records: &FullDNSRecord{CNAME: target}}
+}
+
+func TestCNAMEDomains(t *testing.T) {
+	inScope := newScope([]string{"example.com"}, nil)
+	results := []DNSLookupResult{
+		cnameResult("a.example.com", "cdn-1234.somecdn.net"),
+		cnameResult("b.example.com", "c.example.com"),
+		cnameResult("c.example.com", "x.host.co.uk"),
+		cnameResult("d.example.com", "d111abcdef8.cloudfront.net"),
+		cnameResult("e.example.com", "co.uk"),
+		{Domain: "f.example.com"},
+	}
+	want := []string{"d111abcdef8.cloudfront.net", "host.co.uk", "somecdn.net"}
+	if got := cnameDomains(inScope, results); !reflect.DeepEqual(got, want) {
+		t.Errorf("cnameDomains() = %v, want %v", got, want)
+	}
+}
+
+func TestCNAMEDomainNamesMaxCandidates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w,
+			`[{"id": 1, "common_name": "somecdn.net", "name_value": "a.somecdn.net\nb.somecdn.net"}]`)
+	}))
+	defer server.Close()
+	fetch := FetchOpts{URLs: []string{server.URL}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	inScope := newScope([]string{"example.com"}, nil)
+	results := []DNSLookupResult{cnameResult("a.example.com", "cdn-1234.somecdn.net")}
+	known := []string{"a.example.com", "A.SOMECDN.NET"}
+
+	names := cnameDomainNames(context.Background(), &Config{}, fetch, logger, inScope, known, results)
+	sort.Strings(names)
+	if want := []string{"b.somecdn.net", "somecdn.net"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("cnameDomainNames() = %v, want %v", names, want)
+	}
+	if names := cnameDomainNames(context.Background(), &Config{MaxCandidates: 3}, fetch, logger, inScope, known,
+		results); names != nil {
+		t.Errorf("expected no names above --max-candidates, got %v", names)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+)
+
+// compareScan struct used to hold the certificates fetched for the comparison domain.
+type compareScan struct {
+	certificates []Certificate
+	err          error
+}
+
+// Fetch the certificates of the comparison domain in the background, so both domains are queried in parallel.
+func startCompareScan(ctx context.Context, domain string, opts FetchOpts) <-chan compareScan {
+	ch := make(chan compareScan, 1)
+	go func() {
+		certificates, _, err := LookupCertificates(ctx, domain, opts)
+		ch <- compareScan{certificates: certificates, err: err}
+	}()
+	return ch
+}
+
+// Map every IP address to the domains resolving to it.
+func domainsByIP(results []DNSLookupResult) map[string][]string {
+	byIP := make(map[string][]string)
+	for _, result := range results {
+		for _, ip := range result.Ips {
+			byIP[ip.String()] = append(byIP[ip.String()], result.Domain)
+		}
+	}
+	return byIP
+}
+
+// Print the IP addresses to which domains of both targets resolve, with the domains of each target. If the "plain"
+// flag is set, only the addresses are printed. The addresses are redacted if they are anonymized.
+func printSharedInfrastructure(domain string, results []DNSLookupResult, otherDomain string,
+	otherResults []DNSLookupResult, opts printOpts) {
+	byIP := domainsByIP(results)
+	otherByIP := domainsByIP(otherResults)
+
+	var shared []string
+	for ip := range byIP {
+		if _, exists := otherByIP[ip]; exists {
+			shared = append(shared, ip)
+		}
+	}
+	sort.Strings(shared)
+
+	if !opts.plain {
+		if len(shared) == 0 {
+			fmt.Fprintf(opts.out, "No IP addresses shared between %s and %s\n", domain, otherDomain)
+			return
+		}
+		fmt.Fprintf(opts.out, "IP addresses shared between %s and %s:\n", domain, otherDomain)
+	}
+	for _, ip := range shared {
+		display := ip
+		if opts.anonymizeIPs {
+			display = anonymizeIP(net.ParseIP(ip))
+		}
+		if opts.plain {
+			fmt.Fprintln(opts.out, display)
+			continue
+		}
+		fmt.Fprintln(opts.out, display)
+		fmt.Fprintf(opts.out, "    %s: %s\n", domain, strings.Join(uniqueSorted(byIP[ip]), ", "))
+		fmt.Fprintf(opts.out, "    %s: %s\n", otherDomain, strings.Join(uniqueSorted(otherByIP[ip]), ", "))
+	}
+}
@@ -0,0 +1,386 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Base URL of crt.sh, used when no other endpoint is configured.
+const defaultCrtShURL = "https://crt.sh"
+
+// Default delay before the first retry of a crt.sh request which was answered with an error. Each further retry of an
+// error status waits twice as long as the previous one, while HTML error pages are always retried after this delay.
+const retryBaseDelay = 5 * time.Second
+
+// Values of the crt.sh match_type query parameter.
+const (
+	// MatchILike matches the query as a case-insensitive pattern.
+	MatchILike = "ILIKE"
+	// MatchLike matches the query as a case-sensitive pattern.
+	MatchLike = "LIKE"
+	// MatchExact matches only identities equal to the query.
+	MatchExact = "="
+	// MatchDefault is recorded for certificates found without a match_type, letting crt.sh pick the matching.
+	MatchDefault = "default"
+)
+
+// FetchOpts holds the settings used when querying crt.sh.
+type FetchOpts struct {
+	// How crt.sh matches the query against certificate identities. If empty, crt.sh decides.
+	MatchType string
+	// Ask crt.sh to drop precertificates which have a matching leaf certificate and collapse the remaining pairs.
+	Deduplicate bool
+	// Number of times a request answered with status 429 or 5xx, or with an HTML error page if RetryOnHTML is set, is
+	// retried.
+	Retries     int
+	RetryOnHTML bool
+	// Delay before the first retry of an error status, doubled for each further one, and before every retry of an HTML
+	// error page. If zero, retryBaseDelay is used.
+	RetryDelay time.Duration
+	// Handler receiving the diagnostic messages. If nil, the default slog logger is used.
+	LogHandler slog.Handler
+	// Client used for the requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// Base URLs of crt.sh-compatible endpoints, tried in order until one of them serves the certificates. If empty,
+	// crt.sh is used.
+	URLs []string
+}
+
+// LookupCertificates returns every non-expired certificate issued for the domain, and the base URL of the endpoint
+// which served them.
+func LookupCertificates(ctx context.Context, domain string, opts FetchOpts) ([]Certificate, string, error) {
+	return fetchCertificates(ctx, domain, opts)
+}
+
+// Look up the certificates of each domain in turn, and merge them. A certificate covering several of the domains is
+// kept once. Returns the base URL of the endpoint which served the certificates of the first domain.
+func lookupDomainsCertificates(ctx context.Context, domains []string, opts FetchOpts,
+	logger *slog.Logger) ([]Certificate, string, error) {
+	var certificates []Certificate
+	var endpoint string
+	seen := make(map[int]bool)
+	for _, domain := range domains {
+		found, served, err := LookupCertificates(ctx, domain, opts)
+		if err != nil {
+			return nil, "", fmt.Errorf("%s: %w", domain, err)
+		}
+		if endpoint == "" {
+			endpoint = served
+		}
+		if len(found) == 0 && len(domains) > 1 {
+			logger.Warn(fmt.Sprintf("no certificates found for '%s'", domain))
+		}
+		for _, cert := range found {
+			if !seen[cert.Id] {
+				seen[cert.Id] = true
+				certificates = append(certificates, cert)
+			}
+		}
+	}
+	return certificates, endpoint, nil
+}
+
+// LookupCertificatesByOrg returns every non-expired certificate with an identity matching the organization name, and
+// the base URL of the endpoint which served them. Unless opts specifies otherwise, the name is matched
+// case-insensitively.
+func LookupCertificatesByOrg(ctx context.Context, orgName string, opts FetchOpts) ([]Certificate, string, error) {
+	if opts.MatchType == "" {
+		opts.MatchType = MatchILike
+	}
+	return fetchCertificates(ctx, orgName, opts)
+}
+
+// Query the endpoints in order for every non-expired certificate matching the query, until one of them answers with
+// the certificates. The next endpoint is only tried if the previous one is unavailable; a request it rejects would be
+// rejected by the mirrors as well. Returns the certificates and the base URL of the endpoint which served them.
+func fetchCertificates(ctx context.Context, query string, opts FetchOpts) ([]Certificate, string, error) {
+	endpoints := opts.URLs
+	if len(endpoints) == 0 {
+		endpoints = []string{defaultCrtShURL}
+	}
+
+	logger := newLogger(opts.LogHandler).With(logKeyDomain, query)
+	var err error
+	for i, endpoint := range endpoints {
+		var certificates []Certificate
+		certificates, err = fetchCertificatesFrom(ctx, endpoint, query, opts)
+		if err == nil {
+			if len(endpoints) > 1 {
+				logger.Info("certificates served by "+endpoint, logKeySource, endpoint)
+			}
+			return certificates, endpoint, nil
+		}
+		if ctx.Err() != nil || !endpointUnavailable(err) {
+			break
+		}
+		if i+1 < len(endpoints) {
+			logger.Warn(fmt.Sprintf("%s failed, falling back to %s", endpoint, endpoints[i+1]),
+				logKeySource, endpoint, logKeyError, err)
+		}
+	}
+	return nil, "", err
+}
+
+// Check whether the error of a query tells that the endpoint is unavailable rather than that the query failed: the
+// connection failed, the endpoint kept answering with status 429 or 5xx or with HTML error pages. Other error statuses
+// and responses which are not valid JSON are not.
+func endpointUnavailable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	return !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr)
+}
+
+// Query a crt.sh-compatible endpoint for every non-expired certificate matching the query. If the endpoint answers
+// with an HTML error page instead of JSON and retrying is enabled, the request is repeated after a fixed delay at most
+// opts.Retries times. Responses with status 429 or 5xx are retried with a growing delay, other error statuses fail at
+// once.
+func fetchCertificatesFrom(ctx context.Context, endpoint string, query string, opts FetchOpts) ([]Certificate, error) {
+	params := map[string]string{
+		"q":        query,
+		"output":   "json",
+		"excluded": "expired",
+	}
+	if opts.MatchType != "" {
+		params["match_type"] = opts.MatchType
+	}
+	if opts.Deduplicate {
+		params["deduplicate"] = "Y"
+	}
+
+	logger := newLogger(opts.LogHandler).With(logKeySource, endpoint, logKeyDomain, query)
+
+	for attempt := 0; ; attempt++ {
+		ch := make(chan []byte)
+		errCh := make(chan error)
+		start := time.Now()
+		go fetchResource(ctx, opts.client(), endpoint, params, ch, errCh)
+
+		select {
+		case resp := <-ch:
+			logger.Debug("fetched certificates", logKeyDuration, time.Since(start))
+			if isHTMLResponse(resp) {
+				if opts.RetryOnHTML && attempt < opts.Retries {
+					// The overload of crt.sh is usually brief, so the page is not retried with a growing delay.
+					delay := opts.htmlRetryDelay()
+					logger.Warn(fmt.Sprintf("crt.sh returned HTML error response, retrying in %s...", delay))
+					if err := sleepContext(ctx, delay); err != nil {
+						return nil, err
+					}
+					continue
+				}
+				return nil, fmt.Errorf("%s returned an HTML error response instead of JSON", endpoint)
+			}
+
+			var certificates []Certificate
+			if err := json.Unmarshal(resp, &certificates); err != nil {
+				logger.Error("unexpected response", logKeyError, err, "body", string(resp))
+				return nil, err
+			}
+			querySource := opts.MatchType
+			if querySource == "" {
+				querySource = MatchDefault
+			}
+			for i := range certificates {
+				certificates[i].Issuer = parseIssuerName(certificates[i].IssuerName)
+				certificates[i].QuerySource = querySource
+			}
+			markPrecertificates(certificates)
+			if opts.Deduplicate {
+				certificates = deduplicateCertificates(certificates)
+			}
+			return certificates, nil
+
+		case e := <-errCh:
+			logger.Debug("request failed", logKeyDuration, time.Since(start), logKeyError, e)
+			var statusErr *statusError
+			if !errors.As(e, &statusErr) || !statusErr.retryable() {
+				return nil, e
+			}
+			if attempt >= opts.Retries {
+				if attempt == 0 {
+					return nil, e
+				}
+				return nil, fmt.Errorf("%s returned %d after %d attempts", endpoint, statusErr.code, attempt+1)
+			}
+			delay := opts.retryDelay(attempt)
+			logger.Warn(fmt.Sprintf("%s returned %d, retrying in %s...", endpoint, statusErr.code,
+				delay.Round(time.Second)))
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// Return the delay before the retry following the attempt, counted from 0. The delay doubles with each attempt and
+// up to half of it is added at random, so runs started together do not retry in step.
+func (opts FetchOpts) retryDelay(attempt int) time.Duration {
+	base := opts.RetryDelay
+	if base <= 0 {
+		base = retryBaseDelay
+	}
+	// Past a few minutes, waiting longer does not help and the shift would eventually overflow.
+	delay := base << min(attempt, 5)
+	return delay + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Return the delay before each retry of a request answered with an HTML error page.
+func (opts FetchOpts) htmlRetryDelay() time.Duration {
+	if opts.RetryDelay <= 0 {
+		return retryBaseDelay
+	}
+	return opts.RetryDelay
+}
+
+// Wait for the delay, or until the context is done.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// statusError is the error of a response with a status code other than 2xx.
+type statusError struct {
+	url  string
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s returned %d %s", e.url, e.code, http.StatusText(e.code))
+}
+
+// Check whether the request can succeed when repeated: the server is rate limiting or failing, rather than rejecting
+// the request.
+func (e *statusError) retryable() bool {
+	return e.code == http.StatusTooManyRequests || e.code >= 500
+}
+
+// Return the client used for the requests.
+func (opts FetchOpts) client() *http.Client {
+	if opts.Client == nil {
+		return http.DefaultClient
+	}
+	return opts.Client
+}
+
+// Download a certificate in PEM format by its crt.sh ID from a crt.sh-compatible endpoint.
+func downloadCertificate(ctx context.Context, client *http.Client, endpoint string, id int) ([]byte, error) {
+	ch := make(chan []byte)
+	errCh := make(chan error)
+	go fetchResource(ctx, client, endpoint, map[string]string{"d": strconv.Itoa(id)}, ch, errCh)
+
+	select {
+	case body := <-ch:
+		return body, nil
+	case err := <-errCh:
+		return nil, err
+	}
+}
+
+// Check whether a response body is an HTML document. crt.sh returns HTML error pages when it is overloaded, even if
+// JSON output was requested.
+func isHTMLResponse(body []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(body), []byte("<"))
+}
+
+// Explain a timeout of a request, which otherwise surfaces as a bare "context deadline exceeded" or a reset
+// connection. Other errors are returned unchanged.
+func describeFetchError(ctx context.Context, client *http.Client, u string, err error) error {
+	var netErr net.Error
+	if !errors.Is(err, context.DeadlineExceeded) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s did not answer before the time limit of the run, raise --timeout if it is just slow: %w",
+			u, err)
+	}
+	if client.Timeout > 0 {
+		return fmt.Errorf("%s did not answer within %s, raise --crt-timeout if it is just slow: %w", u, client.Timeout,
+			err)
+	}
+	return fmt.Errorf("%s did not answer in time: %w", u, err)
+}
+
+// Check that each base URL of a crt.sh-compatible endpoint is an absolute http or https URL, so a mistyped
+// --crtsh-url is reported before the run starts instead of by every request.
+func checkEndpointURLs(urls []string) error {
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("invalid crt.sh URL: %w", err)
+		}
+		if parsed.Scheme != "http" && parsed.Scheme != "https" {
+			return fmt.Errorf("invalid crt.sh URL '%s': the scheme must be http or https", u)
+		}
+		if parsed.Host == "" {
+			return fmt.Errorf("invalid crt.sh URL '%s': no host", u)
+		}
+	}
+	return nil
+}
+
+// Fetch the resource from an url with additional query params
+func fetchResource(ctx context.Context, client *http.Client, u string, params map[string]string, ch chan<- []byte,
+	errorCh chan<- error) {
+	urlValues := url.Values{}
+	for key, value := range params {
+		urlValues.Add(key, value)
+	}
+	var encodedParams string
+	if len(urlValues) > 0 {
+		encodedParams = "?" + urlValues.Encode()
+	}
+
+	q, err := http.NewRequestWithContext(ctx, "GET", u+encodedParams, nil)
+	if err != nil {
+		errorCh <- err
+		return
+	}
+
+	handleError := func(err error) {
+		errorCh <- describeFetchError(ctx, client, u, err)
+	}
+
+	resp, err := client.Do(q)
+	if err != nil {
+		defer handleError(err)
+		return
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		errorCh <- &statusError{url: u, code: resp.StatusCode}
+		return
+	}
+
+	if body, err := io.ReadAll(resp.Body); err == nil {
+		ch <- body
+	} else {
+		defer handleError(err)
+		return
+	}
+
+	if err := resp.Body.Close(); err != nil {
+		defer handleError(err)
+	}
+}
@@ -0,0 +1,206 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Body of a crt.sh search returning a single certificate.
+const testCrtShBody = `[{"issuer_ca_id": 1, "issuer_name": "C=US, O=Test CA, CN=Test CA", "common_name": "example.com",
+	"name_value": "example.com\nwww.example.com", "id": 42, "serial_number": "01"}]`
+
+// Return a crt.sh server failing the first failures requests with the status, then serving testCrtShBody, and the
+// counter of the requests it received.
+func newFlakyCrtSh(t *testing.T, failures int, status int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			w.WriteHeader(status)
+			_, _ = io.WriteString(w, "<html><body>busy</body></html>")
+			return
+		}
+		_, _ = io.WriteString(w, testCrtShBody)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// Return fetch options for the server, retrying quickly.
+func testFetchOpts(server *httptest.Server, retries int) FetchOpts {
+	return FetchOpts{URLs: []string{server.URL}, Retries: retries, RetryDelay: time.Millisecond,
+		LogHandler: slog.NewTextHandler(io.Discard, nil)}
+}
+
+func TestFetchRetriesFailingStatuses(t *testing.T) {
+	for _, status := range []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable} {
+		server, requests := newFlakyCrtSh(t, 2, status)
+		certificates, _, err := LookupCertificates(context.Background(), "example.com", testFetchOpts(server, 3))
+		if err != nil {
+			t.Fatalf("status %d: %v", status, err)
+		}
+		if len(certificates) != 1 || certificates[0].Id != 42 {
+			t.Errorf("status %d: unexpected certificates %+v", status, certificates)
+		}
+		if got := requests.Load(); got != 3 {
+			t.Errorf("status %d: %d requests, want 3", status, got)
+		}
+	}
+}
+
+func TestFetchGivesUpAfterRetries(t *testing.T) {
+	server, requests := newFlakyCrtSh(t, 100, http.StatusServiceUnavailable)
+	_, _, err := LookupCertificates(context.Background(), "example.com", testFetchOpts(server, 3))
+	if err == nil || !strings.Contains(err.Error(), "returned 503 after 4 attempts") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if got := requests.Load(); got != 4 {
+		t.Errorf("%d requests, want 4", got)
+	}
+}
+
+func TestFetchDoesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusBadRequest, http.StatusNotFound} {
+		server, requests := newFlakyCrtSh(t, 1, status)
+		_, _, err := LookupCertificates(context.Background(), "example.com", testFetchOpts(server, 3))
+		if err == nil || !strings.Contains(err.Error(), http.StatusText(status)) {
+			t.Errorf("status %d: unexpected error %v", status, err)
+		}
+		if got := requests.Load(); got != 1 {
+			t.Errorf("status %d: %d requests, want 1", status, got)
+		}
+	}
+}
+
+func TestFetchRetriesHTMLAfterFixedDelay(t *testing.T) {
+	server, requests := newFlakyCrtSh(t, 2, http.StatusOK)
+	var log strings.Builder
+	opts := testFetchOpts(server, 3)
+	opts.RetryOnHTML, opts.LogHandler = true, slog.NewTextHandler(&log, nil)
+	if _, _, err := LookupCertificates(context.Background(), "example.com", opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("%d requests, want 3", got)
+	}
+	if got := strings.Count(log.String(), "crt.sh returned HTML error response, retrying in 1ms..."); got != 2 {
+		t.Errorf("%d retry messages with the fixed delay, want 2 in:\n%s", got, log.String())
+	}
+	if delay := (FetchOpts{}).htmlRetryDelay(); delay != 5*time.Second {
+		t.Errorf("default delay %s, want 5s", delay)
+	}
+}
+
+func TestFetchFallsBackOnlyWhenEndpointUnavailable(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		status   int
+		body     string
+		fallback bool
+	}{
+		{name: "not found", status: http.StatusNotFound, fallback: false},
+		{name: "invalid JSON", status: http.StatusOK, body: `[{"id": "x"}]`, fallback: false},
+		{name: "server error", status: http.StatusInternalServerError, fallback: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, fallback: true},
+	} {
+		first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			_, _ = io.WriteString(w, test.body)
+		}))
+		defer first.Close()
+		second, requests := newFlakyCrtSh(t, 0, http.StatusOK)
+		opts := testFetchOpts(first, 1)
+		opts.URLs = append(opts.URLs, second.URL)
+
+		_, endpoint, err := LookupCertificates(context.Background(), "example.com", opts)
+		if got := requests.Load() > 0; got != test.fallback {
+			t.Errorf("%s: second endpoint queried: %t, want %t", test.name, got, test.fallback)
+		}
+		if test.fallback && (err != nil || endpoint != second.URL) {
+			t.Errorf("%s: got endpoint %q and error %v, want %q", test.name, endpoint, err, second.URL)
+		}
+		if !test.fallback && err == nil {
+			t.Errorf("%s: expected the error of the first endpoint", test.name)
+		}
+	}
+}
+
+func TestRetryDelayDoubles(t *testing.T) {
+	opts := FetchOpts{RetryDelay: time.Second}
+	for attempt, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		if delay := opts.retryDelay(attempt); delay < base || delay > base+base/2 {
+			t.Errorf("attempt %d: delay %s not between %s and %s", attempt, delay, base, base+base/2)
+		}
+	}
+	if delay := (FetchOpts{}).retryDelay(0); delay < retryBaseDelay {
+		t.Errorf("default delay %s shorter than %s", delay, retryBaseDelay)
+	}
+}
+
+// Return a crt.sh server answering only once the request is abandoned by the client.
+func newHangingCrtSh(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchExplainsClientTimeout(t *testing.T) {
+	server := newHangingCrtSh(t)
+	opts := testFetchOpts(server, 0)
+	opts.Client = &http.Client{Timeout: 50 * time.Millisecond}
+	_, _, err := LookupCertificates(context.Background(), "example.com", opts)
+	if err == nil || !strings.Contains(err.Error(), "did not answer within 50ms, raise --crt-timeout") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestFetchExplainsRunDeadline(t *testing.T) {
+	server := newHangingCrtSh(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := LookupCertificates(ctx, "example.com", testFetchOpts(server, 0))
+	if err == nil || !strings.Contains(err.Error(), "raise --timeout") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCheckEndpointURLs(t *testing.T) {
+	tests := []struct {
+		url string
+		err string
+	}{
+		{url: "https://crt.sh"},
+		{url: "http://127.0.0.1:8080/mirror"},
+		{url: "crt.sh", err: "the scheme must be http or https"},
+		{url: "ftp://crt.sh", err: "the scheme must be http or https"},
+		{url: "https://", err: "no host"},
+		{url: "https://crt sh", err: "invalid crt.sh URL"},
+	}
+	for _, test := range tests {
+		err := checkEndpointURLs([]string{"https://crt.sh", test.url})
+		if test.err == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", test.url, err)
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%s: got error %v, want %q", test.url, err, test.err)
+		}
+	}
+}
+
+func TestFetchReportsInvalidURL(t *testing.T) {
+	opts := FetchOpts{URLs: []string{"https://crt sh"}, LogHandler: slog.NewTextHandler(io.Discard, nil)}
+	if _, _, err := LookupCertificates(context.Background(), "example.com", opts); err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"encoding/csv"
+	"strings"
+	"time"
+)
+
+// Columns of the CSV format, written as its header line.
+var csvHeader = []string{"domain", "ip", "source", "first_seen"}
+
+// Values of the source column of the CSV format.
+const (
+	csvSourceCertificate = "cert"
+	csvSourceWildcard    = "wildcard"
+	csvSourceTyposquat   = "typosquat"
+	csvSourceRecord      = "record"
+)
+
+// FormatResultsCSV returns a CSV line for each result, with the domain, its IP addresses separated by "|", where the
+// domain comes from and the time it was resolved. Domains without an address are kept with an empty ip column.
+func FormatResultsCSV(results []DNSLookupResult) string {
+	var b strings.Builder
+	writer := csv.NewWriter(&b)
+	for _, r := range results {
+		ips := make([]string, 0, len(r.Ips))
+		for _, ip := range r.Ips {
+			ips = append(ips, r.displayIP(ip))
+		}
+		var firstSeen string
+		if !r.ObservedAt.IsZero() {
+			firstSeen = r.ObservedAt.Format(time.RFC3339)
+		}
+		_ = writer.Write([]string{r.Domain, strings.Join(ips, "|"), csvSource(r), firstSeen})
+	}
+	writer.Flush()
+	return b.String()
+}
+
+// Return the header line of the CSV format.
+func formatCSVHeader() string {
+	return strings.Join(csvHeader, ",") + "\n"
+}
+
+// Return the value of the source column of the result, telling which step found the domain.
+func csvSource(r DNSLookupResult) string {
+	switch {
+	case r.HasTag(TagExtended):
+		return csvSourceWildcard
+	case r.HasTag(TagTyposquat):
+		return csvSourceTyposquat
+	case r.HasTag(TagMXTarget) || r.HasTag(TagNSTarget):
+		return csvSourceRecord
+	}
+	return csvSourceCertificate
+}
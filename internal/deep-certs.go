@@ -0,0 +1,117 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Number of SAN entries from which the name_value of a search result is assumed to be truncated.
+const deepCertSANThreshold = 100
+
+// Minimum delay between two certificate downloads from crt.sh.
+const deepCertInterval = time.Second
+
+// Check whether the SAN list of a crt.sh search result may be incomplete: either it is long enough to have been cut
+// off, or its last entry does not look like a complete domain name.
+func looksTruncated(cert Certificate) bool {
+	names := strings.Split(strings.TrimSpace(cert.NameValue), "\n")
+	if len(names) >= deepCertSANThreshold {
+		return true
+	}
+	last := strings.TrimSpace(names[len(names)-1])
+	return last != "" && (!strings.Contains(last, ".") || strings.HasSuffix(last, ".") || strings.HasSuffix(last, "-"))
+}
+
+// Download the full certificate of every search result whose SAN list looks truncated and merge all its DNS names into
+// the result. Downloads are cached on disk, rate-limited and at most max certificates are downloaded per run.
+func recoverTruncatedSANs(ctx context.Context, client *http.Client, endpoint string, certificates []Certificate,
+	max int, logger *slog.Logger) {
+	cacheDir := deepCertCacheDir()
+	downloads := 0
+	var lastDownload time.Time
+
+	for i, cert := range certificates {
+		if cert.Id == 0 || !looksTruncated(cert) {
+			continue
+		}
+
+		content, cached := readCachedCertificate(cacheDir, cert.Id)
+		if !cached {
+			if downloads >= max {
+				logger.Warn("reached the limit of full certificate downloads", "limit", max)
+				return
+			}
+			time.Sleep(time.Until(lastDownload.Add(deepCertInterval)))
+			lastDownload = time.Now()
+			downloads++
+
+			var err error
+			if content, err = downloadCertificate(ctx, client, endpoint, cert.Id); err != nil {
+				logger.Warn("failed to download certificate", "id", cert.Id, logKeyError, err)
+				continue
+			}
+		}
+
+		full, err := parsePEMCertificates(content)
+		if err != nil {
+			logger.Warn("failed to parse certificate", "id", cert.Id, logKeyError, err)
+			continue
+		}
+		if !cached {
+			writeCachedCertificate(cacheDir, cert.Id, content, logger)
+		}
+		certificates[i].NameValue = mergeNames(cert.NameValue, full[0].NameValue)
+		certificates[i].Precertificate = full[0].Precertificate
+	}
+}
+
+// Merge two newline-separated lists of names, keeping the order of their first appearance.
+func mergeNames(a string, b string) string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, name := range append(strings.Split(a, "\n"), strings.Split(b, "\n")...) {
+		if name = strings.TrimSpace(name); name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "\n")
+}
+
+// Return the directory where downloaded certificates are cached, or an empty string if there is no cache directory.
+func deepCertCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "domain-recon", "certificates")
+}
+
+// Read a certificate from the cache. The second return value reports whether the certificate was cached.
+func readCachedCertificate(cacheDir string, id int) ([]byte, bool) {
+	if cacheDir == "" {
+		return nil, false
+	}
+	content, err := os.ReadFile(filepath.Join(cacheDir, fmt.Sprintf("%d.pem", id)))
+	return content, err == nil
+}
+
+// Store a downloaded certificate in the cache. Failing to do so only costs a download in a later run.
+func writeCachedCertificate(cacheDir string, id int, content []byte, logger *slog.Logger) {
+	if cacheDir == "" {
+		return
+	}
+	err := os.MkdirAll(cacheDir, 0o755)
+	if err == nil {
+		err = os.WriteFile(filepath.Join(cacheDir, fmt.Sprintf("%d.pem", id)), content, 0o644)
+	}
+	if err != nil {
+		logger.Debug("failed to cache certificate", "id", id, logKeyError, err)
+	}
+}
@@ -0,0 +1,24 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format a resolved domain like dnsx with -resp does, so the output can be fed to tools expecting dnsx output: a line
+// with the domain, the record type and the value of each record, such as "example.com [A] [93.184.216.34]". CNAME
+// records are included if all records were looked up.
+func formatDNSX(r DNSLookupResult) string {
+	var b strings.Builder
+	if r.Records != nil && r.Records.CNAME != "" {
+		fmt.Fprintf(&b, "%s [CNAME] [%s]\n", r.Domain, strings.TrimSuffix(r.Records.CNAME, "."))
+	}
+	for _, ip := range r.Ips {
+		recordType := "AAAA"
+		if ip.To4() != nil {
+			recordType = "A"
+		}
+		fmt.Fprintf(&b, "%s [%s] [%s]\n", r.Domain, recordType, r.displayIP(ip))
+	}
+	return b.String()
+}
@@ -1,17 +1,47 @@
 package internal
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"golang.org/x/exp/maps"
 	"io"
 	"io/ioutil"
+	"log/slog"
 	"net"
 	"net/http"
-	"net/url"
+	"os"
+	"sort"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
+// Output formats.
+const (
+	FormatText  = "text"
+	FormatYAML  = "yaml"
+	FormatJSON  = "json"
+	FormatSARIF = "sarif"
+	FormatDNSX  = "dnsx"
+	FormatCSV   = "csv"
+	FormatTable = "table"
+)
+
+// ErrNoResults is returned by Execute when no certificates were found for the domain, or fewer domains were resolved
+// than required by Config.MinDomains.
+var ErrNoResults = errors.New("no results")
+
+// ErrInterrupted is returned by Execute when its context is canceled before the run is over. The results found until
+// then have been written.
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrTimedOut is returned by Execute when the run takes longer than Config.Timeout, wrapping the error of the step cut
+// short if it failed. The results found until then have been written.
+var ErrTimedOut = errors.New("timed out")
+
 // Certificate struct used to hold the data of each certificate returned from crt.sh .
 type Certificate struct {
 	IssuerCaId     int    `json:"issuer_ca_id"`
@@ -23,89 +53,908 @@ type Certificate struct {
 	NotBefore      string `json:"not_before"`
 	NotAfter       string `json:"not_after"`
 	SerialNumber   string `json:"serial_number"`
+	// Whether the entry is a precertificate. This is not part of the crt.sh output, it is determined after fetching.
+	Precertificate bool `json:"precertificate"`
+	// Structured fields of IssuerName. This is not part of the crt.sh output, it is parsed after fetching.
+	Issuer Issuer `json:"issuer"`
+	// Match type of the crt.sh query which returned the certificate, one of the Match constants or MatchDefault. This
+	// is not part of the crt.sh output, and is empty for certificates read from a file.
+	QuerySource string `json:"query_source,omitempty"`
 }
 
-type Flags struct {
-	Domain      string
-	PlainOutput bool
-	WordsFile   string
+// Config struct used to store the settings of a run, as given on the command line.
+type Config struct {
+	// Target domains. crt.sh is queried for each of them, and the names found for several targets are resolved once.
+	Domains []string
+	// Fields read with some of the target domains, such as tags from a JSONL input, by domain. They are attached to
+	// the results below the domain.
+	DomainFields map[string]map[string]any
+	PlainOutput  bool
+	// Level of detail of the output. From 1 up, the certificates of every domain are shown.
+	Verbosity int
+	WordsFile string
+	// Remove repeated words from the words file before extending wildcards.
+	WordlistDedup bool
+	// Check whether the certificate served over TLS for each domain covers it.
+	SNI bool
+	// Template rendering every resolved domain, and template file rendering the whole report instead.
+	Template     string
+	TemplateFile string
+	// Lookups slower than this are reported when the verbosity is at least 2.
+	SlowThreshold time.Duration
+	// Local IP address, or network interface whose address, DNS queries and HTTP requests are sent from.
+	SourceIP  string
+	Interface string
+	// If at least 2, the words are extended with their permutations of up to this many words, such as "api-dev".
+	PermuteLabels int
+	// If NumberSuffixMax is set, the words and the first label of every subdomain found are extended with the numbers
+	// from NumberSuffixMin to NumberSuffixMax, such as "api1" and "api2".
+	NumberSuffixMin int
+	NumberSuffixMax int
+	// Extend the labels of every subdomain found with common prefixes and suffixes, such as "dev-" and "-v2", without
+	// a wordlist.
+	Fuzz bool
+	// Base URLs of crt.sh-compatible endpoints, tried in order. If empty, crt.sh is used.
+	CrtShURLs []string
+	// File with IP ranges of sinkholes and parking services, in addition to the built-in ones.
+	BogusIPsFile string
+	// Leave the domains resolving to sinkholes or parking services out of the results.
+	HideSinkholed bool
+	// Only domains with at least one of these tags are reported, and those with any of the excluded tags are not.
+	TagFilter  []string
+	TagExclude []string
+	// TCP ports checked on the first IP address of each resolved domain, such as 80 and 8443.
+	Ports []string
+	// Report only the domains with at least one of Ports open.
+	OpenPortsOnly bool
+	// Export format, ExportElastic or empty, and the file the export is written to.
+	Export string
+	Output string
+	// Destination of the results, and of the export if Output is empty. If nil, os.Stdout is used.
+	Writer io.Writer
+	// Elasticsearch index the documents are written to, and the URL of the cluster they are posted to if set.
+	ElasticIndex string
+	ElasticURL   string
+	// URL of the Splunk HTTP Event Collector each finding is sent to, and the token authenticating the events.
+	SplunkURL   string
+	SplunkToken string
+	// URL of the NATS server a message for each finding is published to, and the subject of the messages.
+	NATSURL     string
+	NATSSubject string
+	// Send a syslog message for each finding, to SyslogAddr or to the local syslog socket if it is empty.
+	Syslog     bool
+	SyslogAddr string
+	// Look up the A, AAAA, CNAME, MX, NS, TXT, CAA and SOA records of every resolved domain.
+	AllRecords bool
+	// Look up the certificates of the out-of-scope domains the CNAME records point into and resolve the names they
+	// list. Requires AllRecords.
+	FollowCNAME bool
+	// DNS servers queried for every resolved domain to detect split-horizon DNS, given directly or in a file with one
+	// server per line.
+	DNSServers    []string
+	DNSServerFile string
+	// File in the hosts file format whose addresses take precedence over DNS for the names it lists.
+	HostsFile string
+	// Keep using the system resolver even if it cannot resolve public names.
+	NoFallback bool
+	// Address of the DNS server the domains are resolved with instead of the system resolver, with an optional port,
+	// such as 8.8.8.8:53. It is used as is, without falling back to public resolvers.
+	Resolver string
+	// Maximum number of DNS lookups running at once. 0 means no limit.
+	MaxConcurrency int
+	// Time limit of the whole run. 0 means no limit.
+	Timeout time.Duration
+	// Ask each nameserver of Domain for the SOA record of the zone.
+	SOACheck bool
+	// Number of times a lookup is repeated when the resolver returns no address and no error. Domains still without an
+	// address afterwards are tagged with TagEmptyAnswer.
+	ResolveRetries int
+	// Minimum number of resolved domains for the run to succeed. Below it, Execute returns ErrNoResults.
+	MinDomains int
+	// Maximum number of names a run resolves without confirmation. 0 means no limit.
+	MaxCandidates int
+	// Only check that the crt.sh endpoints, proxies and resolver used by a run are reachable, and print the results.
+	Doctor bool
+	// Do not check the components before the run, for example when they are known to be unreachable.
+	SkipPreflight bool
+	// Tar archive the crt.sh responses and DNS answers of the run are recorded to.
+	Record string
+	// Tar archive of a recorded run whose responses and answers are used instead of the network.
+	Replay string
+	// Second domain whose infrastructure is compared with the infrastructure of Domain.
+	CompareDomain string
+	// Report only the domains accepting a TLS handshake on port 443.
+	TLSOnly bool
+	// Report only the domains with port 80 open and no TLS server on port 443.
+	NoTLS bool
+	// Resolve the names one typo away from each discovered subdomain and report those which exist.
+	TyposquatCheck bool
+	// Redact the last octet of IPv4 addresses and the last 64 bits of IPv6 addresses in the printed domains.
+	AnonymizeIPs bool
+	// Print the domains relative to the target domain they belong to, such as api for api.example.com.
+	StripDomain bool
+	// Prefix each printed domain with the time it was resolved.
+	Timestamps bool
+	// Output format, one of the Format constants. Empty means FormatText.
+	Format string
+	// Fields of the certificates shown in verbose mode, in order. If empty, a default summary is shown.
+	CertificateFields []string
+	// Do not truncate the cells of the table format.
+	Wide bool
+	// Write a header row naming the fields above the table format or the lines selected with Fields.
+	OutputHeaders bool
+	// Print each domain as an HTTP and an HTTPS URL, one per line, as expected by httpx.
+	HttpxCompatible bool
+	// Names of the fields printed for each domain in the text format, in order. If empty, the default line is printed.
+	Fields []string
+	// Print only the content hash of the results.
+	PrintHashOnly bool
+	// Print only the distinct IP addresses of the resolved domains, sorted, one per line.
+	UniqueIPsOnly bool
+	// Print the resolved domains grouped by the /24 IPv4 or /64 IPv6 subnet of their addresses.
+	GroupBySubnet bool
+	// List of the domains found by an earlier run. If set, only the resolved domains missing from it are printed.
+	Diff string
+	// Fail with ErrNewDomains if domains missing from the Diff baseline are found.
+	FailOnNew bool
+	// File of shell patterns, one per line, of the domains expected to be missing from the Diff baseline.
+	Allowlist string
+	// Report the number of certificates each SAN entry appears in instead of resolving the domains.
+	DedupeSAN bool
+	// PEM file with certificates to analyze instead of querying crt.sh.
+	PEMFile string
+	// Organization name whose certificates are analyzed instead of the certificates of Domain.
+	Org string
+	// How crt.sh matches the domain or organization name, one of the Match constants.
+	MatchType string
+	// Download the full certificates of search results whose SAN list looks truncated, at most DeepCertsMax of them.
+	DeepCerts    bool
+	DeepCertsMax int
+	// Ask crt.sh to drop precertificates which have a matching leaf certificate and collapse the remaining pairs.
+	Deduplicate bool
+	Retries     int
+	RetryOnHTML bool
+	// Settings of the HTTP client used to query crt.sh.
+	HTTP HTTPOpts
+	// Handler receiving the diagnostic messages. If nil, the default slog logger is used.
+	LogHandler slog.Handler
+	// If set, the report of the run is passed to this function instead of being written. Set by Recon.
+	collect func(Report)
+	// If set, exceeding MaxCandidates fails the run instead of asking on the terminal whether to go on. Set by Recon.
+	noPrompt bool
+}
+
+// Return the name of the target of the run: the comma-separated domains, the organization or the PEM file.
+func (flags *Config) target() string {
+	switch {
+	case len(flags.Domains) > 0:
+		return strings.Join(flags.Domains, ",")
+	case flags.Org != "":
+		return flags.Org
+	}
+	return flags.PEMFile
+}
+
+// Return the settings used when querying crt.sh with the client.
+func (flags *Config) fetchOpts(client *http.Client) FetchOpts {
+	return FetchOpts{
+		Client:      client,
+		MatchType:   flags.MatchType,
+		Deduplicate: flags.Deduplicate,
+		Retries:     flags.Retries,
+		RetryOnHTML: flags.RetryOnHTML,
+		LogHandler:  flags.LogHandler,
+		URLs:        flags.CrtShURLs,
+	}
 }
 
-// DNSLookupResult struct used to store the domain name and the list of IP address to which this domain name is resolved.
+// DNSLookupResult struct used to store the domain name and the list of IP address to which this domain name is
+// resolved.
 type DNSLookupResult struct {
-	Domain string
-	Ips    []net.IP
+	Domain string   `json:"domain"`
+	Ips    []net.IP `json:"ips"`
+	// Result of the SNI check, one of the SNI constants. Empty if the check was not done or there is no TLS server.
+	SNI string `json:"sni,omitempty"`
+	// Time at which the domain was resolved.
+	ObservedAt time.Time `json:"observed_at"`
+	// Every record of the domain, if all records were requested.
+	Records *FullDNSRecord `json:"records,omitempty"`
+	// Tags attached by the enrichment steps, such as TagSinkholed.
+	Tags []string `json:"tags,omitempty"`
+	// Ports of the first IP address accepting TCP connections, if ports were scanned.
+	OpenPorts []int `json:"open_ports,omitempty"`
+	// If the domain is a typo variant of a discovered subdomain, the name of that subdomain.
+	TyposquatOf string `json:"typosquat_of,omitempty"`
+	// Answers of the DNS servers compared for split-horizon detection, if enabled.
+	ResolverAnswers []ResolverAnswer `json:"resolver_answers,omitempty"`
+	// Fields read with the target domain the domain belongs to, if any.
+	Input map[string]any `json:"input,omitempty"`
+	// Target domain the domain was found for, set when several target domains are scanned in the same run.
+	Target string `json:"target,omitempty"`
+	// IDs of the certificates listing the domain or, for extended domains, the wildcard it was guessed from. Set in
+	// the report of the run.
+	CertificateIds []int `json:"certificate_ids,omitempty"`
+	// Whether the IP addresses are redacted when the result is displayed.
+	anonymized bool
 }
 
-func Execute(flags *Flags) error {
-	ch := make(chan []byte)
-	errCh := make(chan error)
-	params := map[string]string{
-		"q":        flags.Domain,
-		"output":   "json",
-		"excluded": "expired",
+// Check whether the format writes the whole report once every domain is resolved, instead of a line per domain.
+func isReportFormat(format string) bool {
+	return format == FormatYAML || format == FormatSARIF || format == FormatJSON
+}
+
+// runClock struct used to tell the time of a run. Replayed runs use the start time of the recorded run, so their
+// results match the recorded ones.
+type runClock struct {
+	// Time returned instead of the current time, if set.
+	frozen time.Time
+}
+
+// Return the current time in UTC with a precision of seconds, the precision of RFC 3339 timestamps without
+// fractional seconds.
+func (c runClock) now() time.Time {
+	if !c.frozen.IsZero() {
+		return c.frozen
+	}
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// Recon runs the scan described by the flags like Execute, but returns the report of the run instead of writing it, so
+// the scan can be embedded in other programs. The output settings of the flags are ignored. Modes which produce no
+// report, such as Doctor, DedupeSAN and CompareDomain, are rejected.
+func Recon(ctx context.Context, flags *Config) (*Report, error) {
+	if flags.Doctor || flags.DedupeSAN || flags.CompareDomain != "" {
+		return nil, errors.New("Recon does not support the doctor, SAN count and comparison modes")
+	}
+	var report *Report
+	scan := *flags
+	scan.Writer = io.Discard
+	scan.Format, scan.Template, scan.TemplateFile, scan.Fields, scan.Export = "", "", "", nil, ""
+	scan.PrintHashOnly, scan.UniqueIPsOnly, scan.OutputHeaders, scan.AnonymizeIPs = false, false, false, false
+	scan.GroupBySubnet, scan.Diff, scan.FailOnNew, scan.Allowlist = false, "", false, ""
+	scan.StripDomain = false
+	scan.collect = func(r Report) {
+		report = &r
 	}
-	go fetchResource("https://crt.sh", params, ch, errCh)
+	scan.noPrompt = true
+	// The report is also returned with the errors of runs cut short or with failed lookups, it holds their partial
+	// results.
+	err := Execute(ctx, &scan)
+	return report, err
+}
 
-	select {
-	case resp := <-ch:
-		var certificates []Certificate
+// ExecuteAll runs Execute for the given target domains in place of those of the config, without a context of its own.
+// The targets are scanned in a single run: a name found for several of them is resolved and written once, and each
+// result is labeled with its target outside the plain output.
+func ExecuteAll(domains []string, cfg *Config) error {
+	run := *cfg
+	run.Domains = nil
+	seen := make(map[string]bool)
+	for _, domain := range domains {
+		if domain = strings.TrimSpace(domain); domain != "" && !seen[domain] {
+			seen[domain] = true
+			run.Domains = append(run.Domains, domain)
+		}
+	}
+	if len(run.Domains) == 0 {
+		return errors.New("no target domain given")
+	}
+	return Execute(context.Background(), &run)
+}
 
-		if err := json.Unmarshal(resp, &certificates); err != nil {
-			fmt.Println(string(resp))
+// Execute runs the scan described by the flags. If the context is canceled, the scan stops, the results found so far
+// are written and ErrInterrupted is returned. The same happens with ErrTimedOut once Config.Timeout has elapsed.
+func Execute(ctx context.Context, flags *Config) (err error) {
+	if flags.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, flags.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded) && err != nil:
+			// The error tells which step, such as the crt.sh request, was cut short.
+			err = fmt.Errorf("%w: %w", ErrTimedOut, err)
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = ErrTimedOut
+		case ctx.Err() != nil:
+			err = ErrInterrupted
+		}
+	}()
+	var recording *session
+	var clock runClock
+	switch {
+	case flags.Record != "" && flags.Replay != "":
+		return errors.New("--record and --replay cannot be used together")
+	case flags.Replay != "":
+		// The SNI, port and split-horizon checks connect to the hosts directly, their answers are not recorded.
+		if flags.SNI || flags.TLSOnly || flags.NoTLS || flags.SOACheck || len(flags.DNSServers) > 0 ||
+			flags.DNSServerFile != "" || len(flags.Ports) > 0 {
+			return errors.New("--replay cannot be combined with --sni, --tls-only, --no-tls, --soa-check, --ports " +
+				"or a DNS server list")
+		}
+		// Replayed findings would be sent again to the systems which received them from the recorded run.
+		if flags.SplunkURL != "" || flags.Syslog || flags.NATSURL != "" || flags.ElasticURL != "" {
+			return errors.New("--replay cannot be combined with --splunk-url, --syslog, --nats or --elastic-url")
+		}
+		if recording, err = loadSession(flags.Replay); err != nil {
 			return err
 		}
+		clock.frozen = recording.meta.StartedAt
+		defer func() {
+			// A missing answer explains any other failure of the replayed run.
+			if missErr := recording.err(); missErr != nil {
+				err = missErr
+			}
+		}()
+	}
+	startedAt := clock.now()
+	logger := newLogger(flags.LogHandler)
+	if flags.Record != "" {
+		recording = newRecordSession(startedAt)
+		defer func() {
+			if saveErr := recording.save(flags.Record); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}()
+	}
 
-		domains, extendedDomains := getResolvableDomains(certificates, flags)
-		printDomains(domains, extendedDomains, flags.PlainOutput)
+	// Templates are parsed and tried before anything else, so mistakes in them are reported without waiting for the
+	// network.
+	opts := printOpts{plain: flags.PlainOutput, sni: flags.SNI || flags.TLSOnly || flags.NoTLS,
+		http: flags.NoTLS, timestamps: flags.Timestamps, allRecords: flags.AllRecords, out: flags.Writer, ctx: ctx,
+		clock: clock, logger: logger}
+	if opts.out == nil {
+		opts.out = os.Stdout
+	}
+	// The lookups of a replayed run complete in any order, its results are printed sorted to give the same output.
+	opts.sorted = flags.Replay != ""
+	if flags.TLSOnly && flags.NoTLS {
+		return errors.New("--tls-only and --no-tls cannot be used together")
+	}
+	if flags.SOACheck && len(flags.Domains) == 0 {
+		return errors.New("--soa-check requires a domain")
+	}
+	if flags.FollowCNAME && !flags.AllRecords {
+		return errors.New("--follow-cname-to-domain requires --all-records")
+	}
+	var reportTemplate *template.Template
+	if flags.Template != "" {
+		if opts.hostTemplate, err = parseHostTemplate(flags.Template); err != nil {
+			return err
+		}
+		if err = checkHostTemplate(opts.hostTemplate); err != nil {
+			return err
+		}
+	}
+	if flags.TemplateFile != "" {
+		if reportTemplate, err = parseReportTemplate(flags.TemplateFile); err != nil {
+			return err
+		}
+		if err = reportTemplate.Execute(io.Discard, Report{}); err != nil {
+			return err
+		}
+	}
+	if err = validateCertificateFields(flags.CertificateFields); err != nil {
+		return err
+	}
+	opts.certificateFields = flags.CertificateFields
+	opts.anonymizeIPs = flags.AnonymizeIPs
+	if flags.AnonymizeIPs && (flags.TemplateFile != "" || flags.UniqueIPsOnly || flags.GroupBySubnet ||
+		isReportFormat(flags.Format) || flags.Export != "") {
+		return errors.New("--anonymize-ips applies only to the text output")
+	}
+	if flags.GroupBySubnet && ((flags.Format != "" && flags.Format != FormatText) || flags.Template != "" ||
+		flags.TemplateFile != "" || len(flags.Fields) > 0 || flags.UniqueIPsOnly || flags.PrintHashOnly ||
+		flags.Export != "") {
+		return errors.New("--group-by-subnet applies only to the default text output")
+	}
+	var baseline map[string]bool
+	var allowlist []string
+	switch {
+	case flags.Diff != "":
+		if (flags.Format != "" && flags.Format != FormatText) || flags.Template != "" || flags.TemplateFile != "" ||
+			len(flags.Fields) > 0 || flags.UniqueIPsOnly || flags.PrintHashOnly || flags.GroupBySubnet ||
+			flags.Export != "" {
+			return errors.New("--diff prints only the new domains, it cannot be combined with another output")
+		}
+		if baseline, err = readBaseline(flags.Diff); err != nil {
+			return err
+		}
+		if flags.Allowlist != "" {
+			if allowlist, err = readAllowlist(flags.Allowlist); err != nil {
+				return err
+			}
+		}
+	case flags.FailOnNew || flags.Allowlist != "":
+		return errors.New("--fail-on-new and --allowlist require a baseline given with --diff")
+	}
+	opts.stripDomain = flags.StripDomain
+	if flags.StripDomain && (flags.TemplateFile != "" || flags.UniqueIPsOnly || isReportFormat(flags.Format) ||
+		flags.Export != "" || flags.HttpxCompatible || flags.GroupBySubnet || flags.Diff != "") {
+		return errors.New("--domain-strip applies only to the text output")
+	}
+	if flags.Format == FormatDNSX {
+		if flags.Template != "" || len(flags.Fields) > 0 {
+			return errors.New("--format dnsx cannot be combined with --template or --fields")
+		}
+		// Section headers and other decorations would break the line format.
+		opts.plain, opts.dnsx = true, true
+	}
+	if flags.Format == FormatCSV {
+		if flags.Template != "" || len(flags.Fields) > 0 {
+			return errors.New("--format csv cannot be combined with --template or --fields")
+		}
+		opts.plain, opts.csv = true, true
+	}
+	if flags.HttpxCompatible {
+		if (flags.Format != "" && flags.Format != FormatText) || flags.Template != "" || len(flags.Fields) > 0 {
+			return errors.New("--httpx-compatible applies only to the default text output")
+		}
+		opts.plain, opts.httpx = true, true
+	}
+	if len(flags.Fields) > 0 {
+		if isReportFormat(flags.Format) {
+			return errors.New("--fields applies only to the text format")
+		}
+		if opts.fields, err = parseFields(flags.Fields); err != nil {
+			return err
+		}
+	}
+	if flags.Format == FormatTable {
+		if flags.Template != "" {
+			return errors.New("--format table cannot be combined with --template")
+		}
+		// Section headers would break the table, the extended domains are told apart by their tag.
+		opts.plain = true
+		if len(opts.fields) == 0 {
+			opts.fields, _ = parseFields(defaultTableFields)
+		}
+		// Without a terminal to align the columns for, the fields are printed separated by tabs.
+		if file, ok := opts.out.(*os.File); ok && isTerminal(file) {
+			opts.table = newResultTable(opts.out, opts.fields, flags.Wide, flags.OutputHeaders)
+			defer opts.table.flush()
+		}
+	}
+	if flags.OutputHeaders {
+		if len(opts.fields) == 0 && !opts.csv {
+			return errors.New("--output-headers applies only to --fields and the table and CSV formats")
+		}
+		if opts.table == nil {
+			opts.header = new(sync.Once)
+		}
+	}
 
-	case e := <-errCh:
-		return e
+	if err := checkEndpointURLs(flags.CrtShURLs); err != nil {
+		return err
 	}
 
-	return nil
-}
+	sourceIP, err := sourceAddress(flags.SourceIP, flags.Interface)
+	if err != nil {
+		return err
+	}
+	httpOpts := flags.HTTP
+	httpOpts.SourceIP = sourceIP
+	opts.sourceIP = sourceIP
+	if opts.classifier, err = newIPClassifier(flags.BogusIPsFile); err != nil {
+		return err
+	}
+	servers := flags.DNSServers
+	if flags.DNSServerFile != "" {
+		list, _, err := readWords(flags.DNSServerFile, true)
+		if err != nil {
+			return err
+		}
+		servers = append(append([]string{}, servers...), list...)
+	}
+	if len(servers) == 1 {
+		return errors.New("split-horizon detection needs at least two DNS servers to compare")
+	}
+	for _, server := range servers {
+		opts.servers = append(opts.servers, NewResolver(server, sourceIP))
+	}
+	var hosts map[string][]net.IP
+	if flags.HostsFile != "" {
+		if hosts, err = readHostsFile(flags.HostsFile); err != nil {
+			return err
+		}
+	}
+	if err = validateTags(append(append([]string{}, flags.TagFilter...), flags.TagExclude...)); err != nil {
+		return err
+	}
+	opts.filter = tagFilter{include: flags.TagFilter, exclude: flags.TagExclude}
+	if flags.TLSOnly {
+		opts.filter.require = append(opts.filter.require, TagTLS)
+	}
+	if flags.NoTLS {
+		opts.filter.require = append(opts.filter.require, TagHTTP)
+		opts.filter.exclude = append(opts.filter.exclude, TagTLS)
+	}
+	if flags.HideSinkholed {
+		opts.filter.exclude = append(opts.filter.exclude, TagSinkholed, TagParked)
+	}
+	if opts.ports, err = parsePorts(flags.Ports); err != nil {
+		return err
+	}
+	if flags.OpenPortsOnly {
+		if len(opts.ports) == 0 {
+			return errors.New("--open-ports-only requires --ports")
+		}
+		opts.filter.require = append(opts.filter.require, TagOpenPort)
+	}
+	opts.hidden = new(int)
+	defer func() {
+		if *opts.hidden > 0 {
+			logger.Info("hid domains filtered by their tags", "count", *opts.hidden)
+		}
+	}()
+	opts.failures = newLookupFailures(flags.Verbosity >= 1, logger)
+	opts.resolveRetries = flags.ResolveRetries
+	opts.workers = flags.MaxConcurrency
+	opts.domainFields = flags.DomainFields
+	opts.targets = flags.Domains
+	defer func() {
+		if err == nil {
+			err = opts.failures.check()
+		}
+	}()
+
+	client, err := NewHTTPClient(httpOpts)
+	if err != nil {
+		return err
+	}
+	if recording != nil {
+		client = recording.wrapClient(client)
+	}
+	if flags.HTTP.Insecure {
+		logger.Warn("TLS certificate verification is disabled for crt.sh requests")
+	}
+
+	// The preflight check probes the resolver the run uses, after a fallback to the public resolvers if needed.
+	var resolver Resolver = NewResolver(flags.Resolver, sourceIP)
+	if !flags.NoFallback && flags.Resolver == "" {
+		fallback := newFallbackResolver(resolver, sourceIP, logger, flags.Verbosity >= 1)
+		if flags.Verbosity >= 1 {
+			defer fallback.report()
+		}
+		resolver = fallback
+		opts.fallback = fallback
+	}
+
+	if flags.Doctor || (!flags.SkipPreflight && flags.Replay == "") {
+		results, err := runPreflight(ctx, preflightChecks(flags, client, resolver, sourceIP), logger)
+		if flags.Doctor {
+			if tableErr := writePreflightTable(opts.out, results); err == nil {
+				err = tableErr
+			}
+			return err
+		}
+		if err != nil {
+			_ = writePreflightTable(os.Stderr, results)
+			return fmt.Errorf("%w; use --skip-preflight to run anyway", err)
+		}
+	}
 
-// Fetch the resource from an url with additional query params
-func fetchResource(u string, params map[string]string, ch chan<- []byte, errorCh chan<- error) {
-	urlValues := url.Values{}
-	for key, value := range params {
-		urlValues.Add(key, value)
+	var compareScanCh <-chan compareScan
+	if flags.CompareDomain != "" {
+		if len(flags.Domains) != 1 {
+			return errors.New("comparing requires the primary target to be a single domain")
+		}
+		compareScanCh = startCompareScan(ctx, flags.CompareDomain, flags.fetchOpts(client))
 	}
-	var encodedParams string
-	if len(urlValues) > 0 {
-		encodedParams = "?" + urlValues.Encode()
+
+	var certificates []Certificate
+	var endpoint string
+	switch {
+	case flags.PEMFile != "":
+		certificates, err = readPEMCertificates(flags.PEMFile)
+	case flags.Org != "":
+		certificates, endpoint, err = LookupCertificatesByOrg(ctx, flags.Org, flags.fetchOpts(client))
+	default:
+		certificates, endpoint, err = lookupDomainsCertificates(ctx, flags.Domains,
+			flags.fetchOpts(client), logger)
+	}
+	if err != nil {
+		return err
 	}
 
-	q, _ := http.NewRequest("GET", u+encodedParams, nil)
-	client := http.Client{}
+	// The hosts file is applied on top of the recorded answers, so it can be changed between recording and replay.
+	switch {
+	case flags.Replay != "":
+		resolver = &sessionResolver{session: recording}
+	case recording != nil:
+		resolver = &sessionResolver{session: recording, next: resolver}
+	}
+	if hosts != nil {
+		resolver = &hostsResolver{path: flags.HostsFile, hosts: hosts, next: resolver}
+	}
+	if len(certificates) == 0 {
+		if flags.Org != "" {
+			logger.Warn(fmt.Sprintf("no certificates found for the organization '%s'", flags.Org))
+		} else {
+			for _, domain := range flags.Domains {
+				reportNoCertificates(ctx, resolver, domain, logger)
+			}
+		}
+		// The report formats still get a valid report, so the programs reading them can tell that nothing was found.
+		if isReportFormat(flags.Format) && flags.Export == "" && flags.collect == nil {
+			report := Report{Domain: strings.Join(flags.Domains, ","), Endpoint: endpoint, StartedAt: startedAt,
+				FinishedAt: clock.now(), ContentHash: contentHash(), Stats: opts.stats()}
+			report.summarize()
+			if err := writeReport(opts.out, flags, report); err != nil {
+				return err
+			}
+		}
+		return ErrNoResults
+	}
+
+	if flags.DeepCerts && flags.PEMFile == "" {
+		recoverTruncatedSANs(ctx, client, endpoint, certificates, flags.DeepCertsMax, logger)
+	}
 
-	handleError := func(err error) {
-		errorCh <- err
+	if flags.DedupeSAN {
+		printSANCounts(opts.out, countCertificatesPerName(certificates))
+		return nil
 	}
 
-	resp, err := client.Do(q)
+	domains, extendedDomains, err := getResolvableDomains(certificates, flags)
 	if err != nil {
-		defer handleError(err)
-		return
+		return err
 	}
 
-	if body, err := io.ReadAll(resp.Body); err == nil {
-		ch <- body
-	} else {
-		defer handleError(err)
-		return
+	if compareScanCh != nil {
+		scan := <-compareScanCh
+		if scan.err != nil {
+			return fmt.Errorf("%s: %w", flags.CompareDomain, scan.err)
+		}
+		otherDomains, otherExtendedDomains, err := getResolvableDomains(scan.certificates, flags)
+		if err != nil {
+			return err
+		}
+		if err := checkCandidateCount(flags, len(domains)+len(extendedDomains)+len(otherDomains)+
+			len(otherExtendedDomains)); err != nil {
+			return err
+		}
+		results := collectResults(resolver, append(domains, extendedDomains...), opts)
+		otherResults := collectResults(resolver, append(otherDomains, otherExtendedDomains...), opts)
+		printSharedInfrastructure(flags.Domains[0], results, flags.CompareDomain, otherResults, opts)
+		return nil
+	}
+
+	var typosquats []typosquatCandidate
+	if flags.TyposquatCheck {
+		typosquats = typosquatCandidates(domains, append(append([]string{}, domains...), extendedDomains...))
+	}
+	if err := checkCandidateCount(flags, len(domains)+len(extendedDomains)+len(typosquats)); err != nil {
+		return err
+	}
+	opts.homographs = findHomographs(append(append([]string{}, domains...), extendedDomains...), flags.Domains)
+	inScope := newScope(flags.Domains, domains)
+
+	if flags.Verbosity >= 2 {
+		opts.latencies = newLatencyRecorder(flags.SlowThreshold, logger)
+		defer opts.latencies.report()
+	}
+
+	if reportTemplate != nil || flags.PrintHashOnly || flags.UniqueIPsOnly || flags.GroupBySubnet ||
+		baseline != nil || isReportFormat(flags.Format) || flags.Export != "" || flags.collect != nil {
+		report := Report{
+			Domain:          strings.Join(flags.Domains, ","),
+			Endpoint:        endpoint,
+			StartedAt:       startedAt,
+			Certificates:    certificates,
+			Domains:         collectResults(resolver, domains, opts),
+			ExtendedDomains: collectResults(resolver, extendedDomains, opts.withTags(TagExtended)),
+		}
+		resolveTyposquats(resolver, typosquats, opts, func(result DNSLookupResult) {
+			report.TyposquatCandidates = append(report.TyposquatCandidates, result)
+		})
+		if flags.AllRecords {
+			var targets map[string][]string
+			targets, report.RelatedExternalDomains = recordTargets(
+				append(append([]DNSLookupResult{}, report.Domains...), report.ExtendedDomains...),
+				append(append([]string{}, domains...), extendedDomains...), inScope)
+			resolveRecordTargets(resolver, targets, opts, func(result DNSLookupResult) {
+				report.RecordTargets = append(report.RecordTargets, result)
+			})
+		}
+		if flags.FollowCNAME {
+			names := cnameDomainNames(ctx, flags, flags.fetchOpts(client), logger, inScope,
+				append(append([]string{}, domains...), extendedDomains...), report.Domains, report.ExtendedDomains)
+			resolveDomains(resolver, names, opts.withTags(TagCNAMEDomain), func(result DNSLookupResult) {
+				report.CNAMEDomains = append(report.CNAMEDomains, result)
+			})
+		}
+		if flags.SOACheck {
+			query := nameserverOpts{resolver: resolver, localIP: sourceIP}
+			for _, domain := range flags.Domains {
+				report.SOA = append(report.SOA, lookupSOA(ctx, query, domain)...)
+			}
+		}
+		report.FinishedAt = clock.now()
+		report.ContentHash = contentHash(report.Domains, report.ExtendedDomains)
+		report.Stats = opts.stats()
+		report.sort()
+		report.summarize()
+		// The report is left out, so a suspiciously small scan cannot be mistaken for a complete one.
+		if err := checkMinDomains(flags, logger, len(report.Domains)+len(report.ExtendedDomains)); err != nil {
+			return err
+		}
+		if count := len(withTag(TagHomograph, report.Domains, report.ExtendedDomains)); count > 0 {
+			logger.Warn("found homograph hostnames, tagged "+TagHomograph, "count", count)
+		}
+		defer forwardFindings(flags, httpOpts, logger, report.results()...)
+		if flags.collect != nil {
+			flags.collect(report)
+			return nil
+		}
+		if flags.UniqueIPsOnly {
+			for _, ip := range uniqueIPs(report.results()...) {
+				fmt.Fprintln(opts.out, ip)
+			}
+			return nil
+		}
+		if flags.PrintHashOnly {
+			fmt.Fprintln(opts.out, report.ContentHash)
+			return nil
+		}
+		if flags.GroupBySubnet {
+			printSubnetGroups(opts.out, report.Domains, report.ExtendedDomains, report.TyposquatCandidates)
+			return nil
+		}
+		if baseline != nil {
+			names := newDomains(baseline, allowlist, report.Domains, report.ExtendedDomains)
+			for _, name := range names {
+				fmt.Fprintln(opts.out, name)
+			}
+			if flags.FailOnNew && len(names) > 0 {
+				return fmt.Errorf("%w: %d missing from %s", ErrNewDomains, len(names), flags.Diff)
+			}
+			return nil
+		}
+		if flags.Export == ExportElastic {
+			return exportElastic(ctx, flags, httpOpts, report, opts.out, logger)
+		}
+		if isReportFormat(flags.Format) {
+			return writeReport(opts.out, flags, report)
+		}
+		return reportTemplate.Execute(opts.out, report)
+	}
+
+	verbose := flags.Verbosity >= 1 && opts.decorated()
+	if verbose {
+		opts.certificates = indexCertificates(certificates)
+		printMultiLabelWildcards(opts.out, certificates)
+	}
+	results, extendedResults := printDomains(resolver, domains, extendedDomains, opts)
+	var typosquatResults []DNSLookupResult
+	if len(typosquats) > 0 {
+		if opts.decorated() {
+			fmt.Fprintf(opts.out, "\nTyposquat candidates:\n")
+		}
+		typosquatResults = printResolved(opts, func(handler func(DNSLookupResult)) {
+			resolveTyposquats(resolver, typosquats, opts, handler)
+		})
+	}
+	var targetResults []DNSLookupResult
+	if flags.AllRecords {
+		targets, external := recordTargets(append(append([]DNSLookupResult{}, results...), extendedResults...),
+			append(append([]string{}, domains...), extendedDomains...), inScope)
+		if len(targets) > 0 && opts.decorated() {
+			fmt.Fprintf(opts.out, "\nMX and NS targets:\n")
+		}
+		targetResults = printResolved(opts, func(handler func(DNSLookupResult)) {
+			resolveRecordTargets(resolver, targets, opts, handler)
+		})
+		if len(external) > 0 && opts.decorated() {
+			fmt.Fprintf(opts.out, "\nRelated external domains:\n%s\n", strings.Join(external, "\n"))
+		}
+	}
+	var cnameResults []DNSLookupResult
+	if flags.FollowCNAME {
+		names := cnameDomainNames(ctx, flags, flags.fetchOpts(client), logger, inScope,
+			append(append([]string{}, domains...), extendedDomains...), results, extendedResults)
+		if len(names) > 0 && opts.decorated() {
+			fmt.Fprintf(opts.out, "\nDomains of CNAME targets:\n")
+		}
+		cnameResults = printResolved(opts, func(handler func(DNSLookupResult)) {
+			resolveDomains(resolver, names, opts.withTags(TagCNAMEDomain), handler)
+		})
+	}
+	if homographs := withTag(TagHomograph, results, extendedResults); len(homographs) > 0 {
+		if !opts.decorated() {
+			logger.Warn("found homograph hostnames, tagged "+TagHomograph, "count", len(homographs))
+		} else {
+			fmt.Fprintf(opts.out, "\nHomograph hostnames:\n")
+			for _, result := range homographs {
+				fmt.Fprintf(opts.out, "%s - %s\n", result.Domain, opts.homographs[result.Domain])
+			}
+		}
+	}
+	if flags.SOACheck && opts.decorated() {
+		for _, domain := range flags.Domains {
+			soa := lookupSOA(ctx, nameserverOpts{resolver: resolver, localIP: sourceIP}, domain)
+			fmt.Fprintf(opts.out, "\nSOA records of %s:\n", domain)
+			if len(soa) == 0 {
+				fmt.Fprintln(opts.out, "no nameservers found")
+			}
+			for _, record := range soa {
+				fmt.Fprintln(opts.out, formatSOA(record))
+			}
+			if serialsDiffer(soa) {
+				logger.Warn("the nameservers serve different serials, the zone is being updated or a secondary is "+
+					"stale", logKeyDomain, domain)
+			}
+		}
+	}
+	if verbose {
+		fmt.Fprintf(opts.out, "\nContent hash: %s\n", contentHash(results, extendedResults))
+	}
+	if err := checkMinDomains(flags, logger, len(results)+len(extendedResults)); err != nil {
+		return err
+	}
+	forwardFindings(flags, httpOpts, logger, results, extendedResults, typosquatResults, targetResults, cnameResults)
+
+	return nil
+}
+
+// Write the report in the report format of the flags, one of FormatYAML, FormatSARIF and FormatJSON. The YAML output
+// has one document per target domain.
+func writeReport(w io.Writer, flags *Config, report Report) error {
+	switch flags.Format {
+	case FormatYAML:
+		for _, targetReport := range splitReport(report, flags.Domains) {
+			if err := writeYAML(w, targetReport); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatSARIF:
+		return writeSARIF(w, flags.target(), report)
+	}
+	return writeJSON(w, report)
+}
+
+// Check that at least flags.MinDomains domains were resolved. Fewer usually means that a data source failed.
+func checkMinDomains(flags *Config, logger *slog.Logger, count int) error {
+	if count >= flags.MinDomains {
+		return nil
+	}
+	logger.Warn(fmt.Sprintf("resolved %d domains, fewer than the minimum of %d", count, flags.MinDomains))
+	return ErrNoResults
+}
+
+// Send the findings to the external systems configured, after they have been reported.
+func forwardFindings(flags *Config, httpOpts HTTPOpts, logger *slog.Logger, results ...[]DNSLookupResult) {
+	if flags.SplunkURL != "" {
+		sendSplunkEvents(flags, httpOpts, logger, results...)
 	}
+	if flags.Syslog {
+		sendSyslogMessages(flags, httpOpts.SourceIP, logger, results...)
+	}
+	if flags.NATSURL != "" {
+		sendNATSMessages(flags, httpOpts, logger, results...)
+	}
+}
 
-	if err := resp.Body.Close(); err != nil {
-		defer handleError(err)
+// Explain that crt.sh has no certificates for the domain. If the domain itself does not resolve, it is likely
+// misspelled, so resolvable names close to it are suggested.
+func reportNoCertificates(ctx context.Context, resolver Resolver, domain string, logger *slog.Logger) {
+	logger.Warn(fmt.Sprintf("no certificates found for '%s', check the spelling of the domain name", domain))
+
+	if _, err := resolver.LookupIP(ctx, domain); err == nil {
+		return
+	}
+	if suggestions := suggestDomains(ctx, resolver, domain); len(suggestions) > 0 {
+		logger.Warn(fmt.Sprintf("'%s' does not resolve, did you mean: %s?", domain, strings.Join(suggestions, ", ")))
 	}
 }
 
 // Returns 2 slices each containing only domain names which can be resolved to an IP address. If a file is provided
 // with a list of words, this function will attempt to extend all wildcard domains and return only those which are
-// resolvable to an IP address. If there is no file provided, the secondary return value be an empty slice.
-func getResolvableDomains(certificates []Certificate, flags *Flags) ([]string, []string) {
+// resolvable to an IP address. If there is no file provided, the secondary return value be an empty slice. Returns an
+// error if the words would be combined into too many permutations.
+func getResolvableDomains(certificates []Certificate, flags *Config) ([]string, []string, error) {
 	uniqDomains := make(map[string]bool)
 	for _, cert := range certificates {
 		uniqDomains[cert.CommonName] = true
@@ -120,21 +969,61 @@ func getResolvableDomains(certificates []Certificate, flags *Flags) ([]string, [
 	var uniqPotentialDomains []string
 
 	if len(flags.WordsFile) > 0 {
-		if potentialDomains, err := extendWildcardDomains(wildCardDomains, flags.WordsFile); err == nil {
+		if words, duplicates, err := readWords(flags.WordsFile, flags.WordlistDedup); err == nil {
+			if flags.WordlistDedup && flags.Verbosity >= 1 {
+				newLogger(flags.LogHandler).Info("skipped duplicate words", "count", duplicates)
+			}
+			if flags.PermuteLabels >= 2 {
+				permutations, err := GeneratePermutations(words, flags.PermuteLabels)
+				if err != nil {
+					return nil, nil, err
+				}
+				words = append(words, permutations...)
+			}
+			if flags.NumberSuffixMax > 0 {
+				var suffixed []string
+				for _, word := range words {
+					suffixed = append(suffixed, numberSuffixes(word, flags.NumberSuffixMin, flags.NumberSuffixMax)...)
+				}
+				words = append(words, suffixed...)
+			}
+			potentialDomains := extendWildcardDomains(wildCardDomains, words)
 			// Filter domains which do already exist in the non-wildcard collection
 			uniqPotentialDomains = append(uniqPotentialDomains, computeDifference(domains, potentialDomains)...)
 		}
 	}
 
-	return domains, uniqPotentialDomains
+	if flags.NumberSuffixMax > 0 {
+		var suffixedDomains []string
+		for _, domain := range domains {
+			suffixedDomains = append(suffixedDomains,
+				suffixFirstLabel(domain, flags.NumberSuffixMin, flags.NumberSuffixMax)...)
+		}
+		// A suffixed subdomain may also be the extension of a wildcard with a suffixed word.
+		suffixedDomains = append(suffixedDomains, uniqPotentialDomains...)
+		uniqPotentialDomains = computeDifference(domains, uniqueSorted(suffixedDomains))
+	}
+
+	if flags.Fuzz {
+		// Names below none of the targets have their first label changed by every call, which adds no duplicates.
+		fuzzed := generateFuzzCandidates(domains, "")
+		for _, root := range flags.Domains {
+			fuzzed = append(fuzzed, generateFuzzCandidates(domains, root)...)
+		}
+		uniqPotentialDomains = computeDifference(domains, uniqueSorted(append(uniqPotentialDomains, fuzzed...)))
+	}
+
+	return domains, uniqPotentialDomains, nil
 }
 
 // Helper function used to remove potential whitespace characters from the beginning and from the end of each domain
-// name from the input slice.
+// name from the input slice. Names which are empty after trimming are dropped.
 func cleanDomainNames(domains []string) []string {
 	var cleanDomains []string
 	for _, domain := range domains {
-		cleanDomains = append(cleanDomains, strings.TrimSpace(domain))
+		if domain = strings.TrimSpace(domain); domain != "" {
+			cleanDomains = append(cleanDomains, domain)
+		}
 	}
 	return cleanDomains
 }
@@ -154,27 +1043,97 @@ func partitionDomains(domains []string) ([]string, []string) {
 	return wildCards, nonWildCards
 }
 
-// Replace wildcard ("*") part of the domain with each world from the file provided.
-func extendWildcardDomains(domains []string, wordsPath string) ([]string, error) {
+// Read the words used for extending wildcards from a file, one word per line. Blank lines are skipped, since an empty
+// word would produce invalid names such as ".example.com", and so are comment lines starting with "#". If dedup is
+// set, repeated words are kept only once and the secondary return value is the number of words skipped.
+func readWords(wordsPath string, dedup bool) ([]string, int, error) {
 	content, err := ioutil.ReadFile(wordsPath)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	var words []string
+	seen := make(map[string]bool)
+	duplicates := 0
 
 	for _, line := range strings.Split(string(content), "\n") {
-		words = append(words, strings.TrimSpace(line))
+		word := strings.TrimSpace(line)
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		if dedup {
+			if seen[word] {
+				duplicates++
+				continue
+			}
+			seen[word] = true
+		}
+		words = append(words, word)
 	}
 
+	return words, duplicates, nil
+}
+
+// Replace wildcard ("*") part of the domain with each word provided.
+func extendWildcardDomains(domains []string, words []string) []string {
 	var potentialDomains []string
 	for _, domain := range domains {
+		if isMultiLabelWildcard(domain) {
+			potentialDomains = append(potentialDomains, extendEveryWildcard(domain, words)...)
+			continue
+		}
 		for _, word := range words {
 			potentialDomains = append(potentialDomains, strings.Replace(domain, "*", word, 1))
 		}
 	}
 
-	return potentialDomains, nil
+	return potentialDomains
+}
+
+// Check whether the domain has more than one wildcard label, such as "*.*.example.com".
+func isMultiLabelWildcard(domain string) bool {
+	wildcards := 0
+	for _, label := range strings.Split(domain, ".") {
+		if label == "*" {
+			wildcards++
+		}
+	}
+	return wildcards > 1
+}
+
+// Replace every wildcard label of the domain with each word, producing every combination of words. A domain with n
+// wildcard labels is extended into len(words)^n domains.
+func extendEveryWildcard(domain string, words []string) []string {
+	if !strings.Contains(domain, "*") {
+		return []string{domain}
+	}
+
+	var potentialDomains []string
+	for _, word := range words {
+		extended := strings.Replace(domain, "*", word, 1)
+		potentialDomains = append(potentialDomains, extendEveryWildcard(extended, words)...)
+	}
+	return potentialDomains
+}
+
+// Print the domains with more than one wildcard label found in the certificates.
+func printMultiLabelWildcards(w io.Writer, certificates []Certificate) {
+	var wildcards []string
+	for name := range indexCertificates(certificates) {
+		if isMultiLabelWildcard(name) {
+			wildcards = append(wildcards, name)
+		}
+	}
+	if len(wildcards) == 0 {
+		return
+	}
+
+	sort.Strings(wildcards)
+	fmt.Fprintf(w, "Multi-label wildcard domains:\n")
+	for _, wildcard := range wildcards {
+		fmt.Fprintf(w, "%s\n", wildcard)
+	}
+	fmt.Fprintln(w)
 }
 
 // Return the difference between "potentialDomains" slice and "domains" slice. Equivalent of B - A set operation.
@@ -194,47 +1153,440 @@ func computeDifference(domains []string, potentialDomains []string) []string {
 	return uniqPotentialDomains
 }
 
-// Pretty print two slices with domain names
-func printDomains(domains []string, extendedDomains []string, plain bool) {
-	printReachableDomains(domains, plain)
+// ComputeDifferenceStream is the streaming equivalent of computeDifference: it reads the potential domains from a
+// channel and sends those which are not in base to out, so the potential domains never have to be held in memory at
+// once. The out channel is closed after the potential channel is closed and drained.
+func ComputeDifferenceStream(base []string, potential <-chan string, out chan<- string) {
+	defer close(out)
+
+	var nonWild = make(map[string]bool, len(base))
+	for _, domain := range base {
+		nonWild[domain] = true
+	}
+
+	for domain := range potential {
+		if !nonWild[domain] {
+			out <- domain
+		}
+	}
+}
+
+// Return the distinct IP addresses of the results, IPv4 addresses first, each family in numerical order.
+func uniqueIPs(results ...[]DNSLookupResult) []net.IP {
+	seen := make(map[string]bool)
+	var ips []net.IP
+	for _, list := range results {
+		for _, result := range list {
+			for _, ip := range result.Ips {
+				if !seen[ip.String()] {
+					seen[ip.String()] = true
+					ips = append(ips, ip)
+				}
+			}
+		}
+	}
+	sortIPs(ips)
+	return ips
+}
+
+// Sort the results by domain, and the addresses of each result.
+func sortResults(results []DNSLookupResult) {
+	sort.Slice(results, func(i, j int) bool { return results[i].Domain < results[j].Domain })
+	for _, result := range results {
+		sortIPs(result.Ips)
+	}
+}
+
+// Sort the addresses, IPv4 addresses first.
+func sortIPs(ips []net.IP) {
+	sort.Slice(ips, func(i, j int) bool {
+		if v4i, v4j := ips[i].To4() != nil, ips[j].To4() != nil; v4i != v4j {
+			return v4i
+		}
+		return bytes.Compare(ips[i].To16(), ips[j].To16()) < 0
+	})
+}
+
+// Print how many certificates each domain name appeared in, the most frequent names first.
+func printSANCounts(w io.Writer, counts map[string]int) {
+	names := maps.Keys(counts)
+	sort.Slice(names, func(i, j int) bool {
+		if counts[names[i]] != counts[names[j]] {
+			return counts[names[i]] > counts[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		if counts[name] == 1 {
+			fmt.Fprintf(w, "%s appeared in 1 certificate\n", name)
+		} else {
+			fmt.Fprintf(w, "%s appeared in %d certificates\n", name, counts[name])
+		}
+	}
+}
+
+// printOpts struct used to store the settings which control how the domains are printed.
+type printOpts struct {
+	plain bool
+	// Print the results sorted by domain once every domain is resolved, instead of each one as soon as it is resolved.
+	sorted bool
+	// Resolver falling back to the public resolvers, if the run uses it. The lookups which failed before the fallback
+	// are retried.
+	fallback *fallbackResolver
+	// Certificates of each domain name. If set, they are printed below the domain.
+	certificates map[string][]Certificate
+	// Fields of the certificates which are printed. If empty, the default summary is printed.
+	certificateFields []string
+	// Check whether the certificate served for each domain covers it.
+	sni bool
+	// Check whether port 80 accepts connections.
+	http bool
+	// Local IP address the SNI, HTTP and port checks connect from. If nil, the operating system picks it.
+	sourceIP net.IP
+	// If set, only these fields of each result are printed.
+	fields []outputField
+	// Table the results are added to instead of being printed.
+	table *resultTable
+	// Print each record in the format of dnsx instead of the default line.
+	dnsx bool
+	// Print each domain as a CSV line instead of the default line.
+	csv bool
+	// Print an HTTP and an HTTPS URL of each domain instead of the default line.
+	httpx bool
+	// Prefix each line with the time the domain was resolved.
+	timestamps bool
+	// Redact the IP addresses of the printed domains.
+	anonymizeIPs bool
+	// Print the domains relative to their target domain.
+	stripDomain bool
+	// Look up every record type of each resolved domain.
+	allRecords bool
+	// Ports checked for accepting connections.
+	ports []int
+	// Classifier tagging sinkholed and parked domains.
+	classifier *ipClassifier
+	// Reason of each hostname found to be a homograph, by hostname.
+	homographs map[string]string
+	// Tags attached to every result, in addition to those found by the enrichment steps.
+	tags []string
+	// Results not passing the filter are dropped and counted in hidden.
+	filter tagFilter
+	hidden *int
+	// DNS servers whose answers are compared for each resolved domain.
+	servers []Resolver
+	// Aggregate of the failed lookups.
+	failures *lookupFailures
+	// Number of times a lookup returning no address and no error is repeated.
+	resolveRetries int
+	// Maximum number of domains resolved at once. 0 means no limit.
+	workers int
+	// Fields attached to the results below each target domain.
+	domainFields map[string]map[string]any
+	// Target domains of the run, used to label each result with the target it belongs to.
+	targets []string
+	// If set, the header line of the fields or of the CSV format is written before the first result.
+	header *sync.Once
+	// Template used to render each domain instead of the default format.
+	hostTemplate *template.Template
+	// Destination of the printed results.
+	out io.Writer
+	// Context of the run. Once it is canceled, the remaining domains fail without being looked up.
+	ctx context.Context
+	// If set, the duration of every DNS lookup is recorded.
+	latencies *latencyRecorder
+	// Clock telling the time each domain was resolved.
+	clock  runClock
+	logger *slog.Logger
+}
+
+// Return the statistics of the run: the latency of the lookups, if recorded, and the outcome of the resolver fallback,
+// if the run uses it. They are zero otherwise.
+func (opts printOpts) stats() ReportStats {
+	var stats ReportStats
+	if opts.latencies != nil {
+		stats.Latency, stats.ResolverLatency = opts.latencies.stats()
+	}
+	if opts.fallback != nil {
+		stats.Fallback = opts.fallback.stats()
+	}
+	return stats
+}
+
+// Check whether section headers and other decorations are printed around the results. The plain output, templates
+// and selected fields print one line per result, which they would break.
+func (opts printOpts) decorated() bool {
+	return !opts.plain && opts.hostTemplate == nil && len(opts.fields) == 0
+}
 
+// Return a copy of the options attaching the tags to every result.
+func (opts printOpts) withTags(tags ...string) printOpts {
+	opts.tags = append(append([]string{}, opts.tags...), tags...)
+	return opts
+}
+
+// Pretty print two slices with domain names. Returns the results printed for each slice.
+func printDomains(resolver Resolver, domains []string, extendedDomains []string,
+	opts printOpts) ([]DNSLookupResult, []DNSLookupResult) {
+	results := printReachableDomains(resolver, domains, opts)
+
+	var extendedResults []DNSLookupResult
 	if len(extendedDomains) > 0 {
-		if !plain {
-			fmt.Printf("\nExtended domains:\n")
+		if opts.decorated() {
+			fmt.Fprintf(opts.out, "\nExtended domains:\n")
 		}
-		printReachableDomains(extendedDomains, plain)
+		extendedResults = printReachableDomains(resolver, extendedDomains, opts.withTags(TagExtended))
 	}
+	return results, extendedResults
 }
 
 // Print a list with domains. If the "plain" flag is set, the IP address to which the domain is resolved,
-// will not be printed.
-func printReachableDomains(domain []string, plain bool) {
-	ch := make(chan DNSLookupResult, len(domain))
-	errCh := make(chan string, len(domain))
-	for _, domain := range domain {
-		go lookUpDns(domain, ch, errCh)
+// will not be printed. Returns the results printed.
+func printReachableDomains(resolver Resolver, domain []string, opts printOpts) []DNSLookupResult {
+	return printResolved(opts, func(handler func(DNSLookupResult)) {
+		resolveDomains(resolver, domain, opts, handler)
+	})
+}
+
+// Print the results which resolve passes to its handler, each one as soon as it is resolved or, if opts.sorted is
+// set, all of them sorted once resolve returns. Returns the results printed.
+func printResolved(opts printOpts, resolve func(handler func(DNSLookupResult))) []DNSLookupResult {
+	var results []DNSLookupResult
+	resolve(func(result DNSLookupResult) {
+		if !opts.sorted {
+			printResult(result, opts)
+		}
+		results = append(results, result)
+	})
+	if opts.sorted {
+		sortResults(results)
+		for _, result := range results {
+			printResult(result, opts)
+		}
+	}
+	return results
+}
+
+// Resolve the domains without printing them and return the domains which can be resolved.
+func collectResults(resolver Resolver, domains []string, opts printOpts) []DNSLookupResult {
+	var results []DNSLookupResult
+	resolveDomains(resolver, domains, opts, func(result DNSLookupResult) {
+		results = append(results, result)
+	})
+	return results
+}
+
+// Print a single resolved domain.
+func printResult(resp DNSLookupResult, opts printOpts) {
+	resp.anonymized = opts.anonymizeIPs
+	certificates := opts.certificates[resp.Domain]
+	if opts.stripDomain {
+		// A target domain has no relative part, like the wordlist entries the stripped names are used as.
+		if resp.Domain = relativeName(resp.Domain, targetOf(opts.targets, resp.Domain)); resp.Domain == "" {
+			return
+		}
+	}
+	if opts.hostTemplate != nil {
+		if err := executeHostTemplate(opts.out, opts.hostTemplate, resp); err != nil {
+			opts.logger.Error("failed to render template", logKeyDomain, resp.Domain, logKeyError, err)
+		}
+		return
+	}
+	if opts.table != nil {
+		opts.table.add(resp)
+		return
+	}
+	if len(opts.fields) > 0 {
+		if opts.header != nil {
+			opts.header.Do(func() { fmt.Fprintln(opts.out, formatFieldsHeader(opts.fields)) })
+		}
+		fmt.Fprintln(opts.out, formatFields(resp, opts.fields))
+		return
+	}
+	if opts.dnsx {
+		fmt.Fprint(opts.out, formatDNSX(resp))
+		return
+	}
+	if opts.csv {
+		if opts.header != nil {
+			opts.header.Do(func() { fmt.Fprint(opts.out, formatCSVHeader()) })
+		}
+		fmt.Fprint(opts.out, FormatResultsCSV([]DNSLookupResult{resp}))
+		return
+	}
+	if opts.httpx {
+		fmt.Fprintf(opts.out, "http://%s\nhttps://%s\n", resp.Domain, resp.Domain)
+		return
+	}
+	var prefix string
+	if opts.timestamps {
+		prefix = resp.ObservedAt.Format(time.RFC3339) + " "
+	}
+	if opts.plain {
+		fmt.Fprintf(opts.out, "%s%s\n", prefix, resp.Domain)
+		return
 	}
 
-	for range domain {
+	line := fmt.Sprintf("%s%s - IPs: [%s]", prefix, resp.Domain, strings.Join(resp.displayIPs(), " "))
+	if len(resp.OpenPorts) > 0 {
+		line += fmt.Sprintf(" - open ports: %v", resp.OpenPorts)
+	}
+	if onlyPrecertificates(certificates) {
+		line += " [precertificate only]"
+	}
+	if len(resp.Tags) > 0 {
+		line += " [" + strings.Join(resp.Tags, ",") + "]"
+	}
+	if resp.TyposquatOf != "" {
+		line += " " + typosquatMarker(resp)
+	}
+	if resp.Target != "" {
+		line += " (target: " + resp.Target + ")"
+	}
+	fmt.Fprintln(opts.out, line)
+	if len(resp.ResolverAnswers) > 0 {
+		fmt.Fprintf(opts.out, "    %s\n", formatSplitHorizon(resp))
+	}
+	if resp.Records != nil {
+		if records := formatRecords(*resp.Records); records != "" {
+			fmt.Fprintf(opts.out, "    %s\n", records)
+		}
+	}
+	for _, cert := range certificates {
+		if len(opts.certificateFields) > 0 {
+			fmt.Fprintf(opts.out, "    %s\n", formatCertificateFields(cert, opts.certificateFields))
+			continue
+		}
+		fmt.Fprintf(opts.out, "    %s\n", formatCertificate(cert))
+	}
+}
+
+// Resolve the domains concurrently, with at most opts.workers lookups at once, and pass each domain which can be
+// resolved to the handler as soon as it is resolved. Returns when every domain has been processed.
+func resolveDomains(resolver Resolver, domains []string, opts printOpts, handle func(DNSLookupResult)) {
+	ch := make(chan DNSLookupResult, len(domains))
+	errCh := make(chan lookupFailure, len(domains))
+	workers := opts.workers
+	if workers <= 0 || workers > len(domains) {
+		workers = len(domains)
+	}
+	queue := make(chan string)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for domain := range queue {
+				lookUpDns(resolver, domain, opts, ch, errCh)
+			}
+		}()
+	}
+	go func() {
+		defer close(queue)
+		for _, domain := range domains {
+			queue <- domain
+		}
+	}()
+
+	var failures []lookupFailure
+	for range domains {
 		select {
 		case resp := <-ch:
-			if plain {
-				fmt.Printf("%s\n", resp.Domain)
+			opts.failures.succeeded()
+			if !opts.filter.keep(resp) {
+				*opts.hidden++
 				continue
 			}
-			fmt.Printf("%s - IPs: %s\n", resp.Domain, resp.Ips)
-		case e := <-errCh:
-			_ = e
+			handle(resp)
+		case failure := <-errCh:
+			// Lookups failing because the run was interrupted say nothing about the resolver.
+			if opts.ctx.Err() == nil {
+				failures = append(failures, failure)
+			}
+		}
+	}
+
+	// The lookups which failed on the system resolver before the switch to the public resolvers get another try.
+	var retry []string
+	for _, failure := range failures {
+		if opts.fallback != nil && opts.fallback.retryable(failure.domain) {
+			retry = append(retry, failure.domain)
+		} else {
+			opts.failures.failed(failure)
 		}
 	}
+	if len(retry) > 0 {
+		opts.logger.Debug("retrying lookups which failed before the switch to the public resolvers",
+			"count", len(retry))
+		resolveDomains(resolver, retry, opts, handle)
+	}
 }
 
-// Attempt to do DNS resolution on a domain name.
-func lookUpDns(domain string, ch chan<- DNSLookupResult, errCh chan<- string) {
-	ips, err := net.LookupIP(domain)
+// Attempt to do DNS resolution on a domain name. If the SNI check is enabled, it is done using the first IP address.
+func lookUpDns(resolver Resolver, domain string, opts printOpts, ch chan<- DNSLookupResult,
+	errCh chan<- lookupFailure) {
+	start := time.Now()
+	ips, err := resolver.LookupIP(opts.ctx, domain)
+	// Some resolvers answer without any address now and then, which would look like a successful lookup.
+	for retry := 1; retry <= opts.resolveRetries && err == nil && len(ips) == 0; retry++ {
+		opts.logger.Debug("retrying lookup without addresses", logKeyDomain, domain, "retry", retry)
+		ips, err = resolver.LookupIP(opts.ctx, domain)
+	}
+	if opts.latencies != nil {
+		opts.latencies.record(resolver, domain, time.Since(start))
+	}
 	if err != nil {
-		errCh <- domain
+		errCh <- lookupFailure{domain: domain, err: err}
 		return
 	}
-	ch <- DNSLookupResult{Domain: domain, Ips: ips}
+	target := targetOf(opts.targets, domain)
+	result := DNSLookupResult{Domain: domain, Ips: ips, ObservedAt: opts.clock.now(),
+		Input: opts.domainFields[target]}
+	if len(opts.targets) > 1 {
+		result.Target = target
+	}
+	result.Tags = append(result.Tags, opts.tags...)
+	if opts.classifier != nil {
+		if class := opts.classifier.classify(ips); class != "" {
+			result.Tags = append(result.Tags, class)
+		}
+	}
+	if len(ips) == 0 {
+		result.Tags = append(result.Tags, TagEmptyAnswer)
+	}
+	if allPrivate(ips) {
+		result.Tags = append(result.Tags, TagPrivate)
+	}
+	if hosts, ok := resolver.(*hostsResolver); ok && hosts.overrides(domain) {
+		result.Tags = append(result.Tags, TagHostsOverride)
+	}
+	if len(opts.servers) > 0 {
+		var split bool
+		if result.ResolverAnswers, split = compareServers(opts.ctx, opts.servers, domain); split {
+			result.Tags = append(result.Tags, TagSplitHorizon)
+		}
+	}
+	if _, ok := opts.homographs[domain]; ok {
+		result.Tags = append(result.Tags, TagHomograph)
+	}
+	if opts.allRecords {
+		records := lookupRecordsWith(opts.ctx, resolver, domain)
+		result.Records = &records
+	}
+	if opts.sni && len(ips) > 0 {
+		result.SNI = checkSNI(opts.ctx, domain, ips[0], opts.sourceIP)
+		if result.SNI != "" {
+			result.Tags = append(result.Tags, TagTLS)
+		}
+		if result.SNI == SNIMismatch {
+			result.Tags = append(result.Tags, TagSNIMismatch)
+		}
+	}
+	if opts.http && len(ips) > 0 && checkHTTPPort(opts.ctx, ips[0], opts.sourceIP) {
+		result.Tags = append(result.Tags, TagHTTP)
+	}
+	if len(opts.ports) > 0 && len(ips) > 0 {
+		result.OpenPorts = scanPorts(opts.ctx, ips[0], opts.ports, opts.sourceIP)
+		if len(result.OpenPorts) > 0 {
+			result.Tags = append(result.Tags, TagOpenPort)
+		}
+	}
+	ch <- result
 }
@@ -0,0 +1,502 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrencyResolver struct used to record the largest number of lookups in flight at once. Each lookup takes a
+// little while, so that concurrent lookups overlap.
+type concurrencyResolver struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (r *concurrencyResolver) LookupIP(_ context.Context, _ string) ([]net.IP, error) {
+	r.mu.Lock()
+	r.inFlight++
+	if r.inFlight > r.max {
+		r.max = r.inFlight
+	}
+	r.mu.Unlock()
+	time.Sleep(2 * time.Millisecond)
+	r.mu.Lock()
+	r.inFlight--
+	r.mu.Unlock()
+	return []net.IP{net.IPv4(192, 0, 2, 1)}, nil
+}
+
+func (r *concurrencyResolver) String() string {
+	return "concurrency"
+}
+
+// Return options resolving with the number of workers and discarding the log.
+func testPrintOpts(workers int) printOpts {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	return printOpts{ctx: context.Background(), workers: workers, logger: logger, hidden: new(int),
+		failures: newLookupFailures(false, logger)}
+}
+
+func TestResolveDomainsLimitsLookupsInFlight(t *testing.T) {
+	domains := make([]string, 200)
+	for i := range domains {
+		domains[i] = fmt.Sprintf("host%d.example.com", i)
+	}
+	for _, workers := range []int{1, 5, 20} {
+		resolver := &concurrencyResolver{}
+		resolved := 0
+		resolveDomains(resolver, domains, testPrintOpts(workers), func(DNSLookupResult) {
+			resolved++
+		})
+		if resolved != len(domains) {
+			t.Errorf("workers %d: resolved %d domains, want %d", workers, resolved, len(domains))
+		}
+		if resolver.max > workers {
+			t.Errorf("workers %d: %d lookups in flight at once", workers, resolver.max)
+		}
+		if workers > 1 && resolver.max < 2 {
+			t.Errorf("workers %d: lookups did not run concurrently", workers)
+		}
+	}
+}
+
+func TestResolveDomainsWithoutLimit(t *testing.T) {
+	domains := []string{"a.example.com", "b.example.com", "c.example.com"}
+	resolver := &concurrencyResolver{}
+	resolved := 0
+	resolveDomains(resolver, domains, testPrintOpts(0), func(DNSLookupResult) {
+		resolved++
+	})
+	if resolved != len(domains) || resolver.max > len(domains) {
+		t.Errorf("resolved %d domains with %d lookups in flight", resolved, resolver.max)
+	}
+}
+
+func TestGetResolvableDomains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("api\nwww\ndev\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	certificates := []Certificate{
+		{CommonName: "example.com", NameValue: "example.com\n www.example.com \n\n*.example.com"},
+		{CommonName: "*.example.com", NameValue: "*.example.com\nmail.example.com"},
+		{CommonName: "*.*.example.org", NameValue: "*.*.example.org"},
+	}
+
+	domains, extended, err := getResolvableDomains(certificates, &Config{WordsFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(domains)
+	sort.Strings(extended)
+	if want := []string{"example.com", "mail.example.com", "www.example.com"}; !reflect.DeepEqual(domains, want) {
+		t.Errorf("got domains %q, want %q", domains, want)
+	}
+	// www.example.com is already known, and every wildcard label of *.*.example.org is extended.
+	want := []string{"api.api.example.org", "api.dev.example.org", "api.example.com", "api.www.example.org",
+		"dev.api.example.org", "dev.dev.example.org", "dev.example.com", "dev.www.example.org", "www.api.example.org",
+		"www.dev.example.org", "www.www.example.org"}
+	if !reflect.DeepEqual(extended, want) {
+		t.Errorf("got extended domains %q, want %q", extended, want)
+	}
+
+	// Without a words file, the wildcards are not extended.
+	if _, extended, _ := getResolvableDomains(certificates, &Config{}); len(extended) != 0 {
+		t.Errorf("got extended domains %q without a words file", extended)
+	}
+}
+
+func TestCollectResultsKeepsResolvedDomains(t *testing.T) {
+	resolver := &fakeResolver{answers: map[string][]net.IP{
+		"www.example.com": {net.IPv4(192, 0, 2, 1)},
+		"api.example.com": {net.IPv4(192, 0, 2, 2), net.ParseIP("2001:db8::2")},
+	}}
+	results := collectResults(resolver, []string{"www.example.com", "api.example.com", "gone.example.com"},
+		testPrintOpts(0))
+
+	resolved := make(map[string][]net.IP)
+	for _, result := range results {
+		resolved[result.Domain] = result.Ips
+	}
+	want := map[string][]net.IP{
+		"api.example.com": {net.IPv4(192, 0, 2, 2), net.ParseIP("2001:db8::2")},
+		"www.example.com": {net.IPv4(192, 0, 2, 1)},
+	}
+	if len(results) != len(want) || !reflect.DeepEqual(resolved, want) {
+		t.Errorf("got %+v, want %v", results, want)
+	}
+	for _, domain := range []string{"www.example.com", "api.example.com", "gone.example.com"} {
+		if count := resolver.count(domain); count != 1 {
+			t.Errorf("%s looked up %d times, want once", domain, count)
+		}
+	}
+}
+
+func TestComputeDifferenceStreamMatchesComputeDifference(t *testing.T) {
+	base := []string{"www.example.com", "api.example.com"}
+	potential := []string{"api.example.com", "dev.example.com", "www.example.com", "mail.example.com"}
+
+	in := make(chan string)
+	out := make(chan string)
+	go ComputeDifferenceStream(base, in, out)
+	go func() {
+		for _, domain := range potential {
+			in <- domain
+		}
+		close(in)
+	}()
+	var streamed []string
+	for domain := range out {
+		streamed = append(streamed, domain)
+	}
+
+	want := computeDifference(base, potential)
+	if !reflect.DeepEqual(streamed, want) || !reflect.DeepEqual(want, []string{"dev.example.com", "mail.example.com"}) {
+		t.Errorf("got %q from the stream and %q from the slices", streamed, want)
+	}
+}
+
+func TestLookUpDnsUsesRunClock(t *testing.T) {
+	resolver := &fakeResolver{answers: map[string][]net.IP{"a.example.com": {net.IPv4(192, 0, 2, 1)}}}
+	replayed := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	var wg sync.WaitGroup
+	for _, frozen := range []time.Time{replayed, {}} {
+		frozen := frozen
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			opts := testPrintOpts(0)
+			opts.clock = runClock{frozen: frozen}
+			ch, errCh := make(chan DNSLookupResult, 1), make(chan lookupFailure, 1)
+			lookUpDns(resolver, "a.example.com", opts, ch, errCh)
+			observed := (<-ch).ObservedAt
+			if frozen.IsZero() && (observed.Equal(replayed) || observed.Location() != time.UTC) {
+				t.Errorf("live run observed at %s", observed)
+			}
+			if !frozen.IsZero() && !observed.Equal(replayed) {
+				t.Errorf("replayed run observed at %s, want %s", observed, replayed)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestCheckCandidateCountWithoutPrompt(t *testing.T) {
+	flags := &Config{MaxCandidates: 10, noPrompt: true}
+	if err := checkCandidateCount(flags, 10); err != nil {
+		t.Errorf("count at the limit rejected: %v", err)
+	}
+	err := checkCandidateCount(flags, 11)
+	want := "11 names to resolve, more than the limit of 10; raise it with --max-candidates 11, " +
+		"or disable it with --max-candidates 0"
+	if err == nil || err.Error() != want {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestReadWordsSkipsBlankLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	content := "\napi\n\n   \n\t\r\ndev\r\n# comment\n\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	words, _, err := readWords(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"api", "dev"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("got %q, want %q", words, want)
+	}
+
+	certificates := []Certificate{{CommonName: "*.example.com", NameValue: "*.example.com\nexample.com"}}
+	_, extended, err := getResolvableDomains(certificates, &Config{WordsFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(extended)
+	if want := []string{"api.example.com", "dev.example.com"}; !reflect.DeepEqual(extended, want) {
+		t.Errorf("got %q, want %q", extended, want)
+	}
+	for _, domain := range extended {
+		if strings.HasPrefix(domain, ".") || strings.Contains(domain, "..") {
+			t.Errorf("invalid domain %q", domain)
+		}
+	}
+}
+
+func TestRunClockIsUTC(t *testing.T) {
+	local := time.Local
+	time.Local = time.FixedZone("UTC+2", 2*60*60)
+	t.Cleanup(func() { time.Local = local })
+
+	observed := runClock{}.now()
+	if observed.Location() != time.UTC {
+		t.Errorf("time in %s, want UTC", observed.Location())
+	}
+	if observed.Nanosecond() != 0 {
+		t.Errorf("time %s has fractional seconds", observed.Format(time.RFC3339Nano))
+	}
+	if formatted := observed.Format(time.RFC3339); !strings.HasSuffix(formatted, "Z") {
+		t.Errorf("time formatted as %s, want the Z suffix", formatted)
+	}
+}
+
+func TestTimestampFormat(t *testing.T) {
+	result := DNSLookupResult{Domain: "a.example.com", Ips: []net.IP{net.IPv4(192, 0, 2, 1)},
+		ObservedAt: time.Date(2024, 3, 1, 12, 30, 45, 0, time.UTC)}
+
+	var out bytes.Buffer
+	printResult(result, printOpts{out: &out, timestamps: true, plain: true})
+	if got, want := out.String(), "2024-03-01T12:30:45Z a.example.com\n"; got != want {
+		t.Errorf("text output %q, want %q", got, want)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(encoded, []byte(`"observed_at":"2024-03-01T12:30:45Z"`)) {
+		t.Errorf("unexpected JSON %s", encoded)
+	}
+	report, err := json.Marshal(Report{StartedAt: result.ObservedAt, FinishedAt: result.ObservedAt.Add(time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(report, []byte(`"started_at":"2024-03-01T12:30:45Z","finished_at":"2024-03-01T12:31:45Z"`)) {
+		t.Errorf("unexpected JSON %s", report)
+	}
+}
+
+func TestReplayRejectsForwarding(t *testing.T) {
+	for _, flags := range []Config{
+		{SplunkURL: "https://splunk.example.com:8088"},
+		{Syslog: true},
+		{NATSURL: "nats://broker:4222"},
+		{ElasticURL: "https://elastic.example.com:9200"},
+	} {
+		flags.Domains, flags.Replay = []string{"example.com"}, "session.tar"
+		err := Execute(context.Background(), &flags)
+		if err == nil || !strings.Contains(err.Error(), "--replay cannot be combined with --splunk-url") {
+			t.Errorf("%+v: unexpected error %v", flags, err)
+		}
+	}
+}
+
+func TestEmptyResultsWriteEmptyReport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "[]")
+	}))
+	defer server.Close()
+
+	for _, format := range []string{FormatJSON, FormatYAML, FormatText} {
+		var out bytes.Buffer
+		err := Execute(context.Background(), &Config{Domains: []string{"example.com"}, Format: format, Writer: &out,
+			CrtShURLs: []string{server.URL}, SkipPreflight: true, Resolver: "127.0.0.1:1",
+			LogHandler: slog.NewTextHandler(io.Discard, nil)})
+		if !errors.Is(err, ErrNoResults) {
+			t.Errorf("%s: unexpected error %v", format, err)
+		}
+		switch format {
+		case FormatJSON:
+			var report map[string]any
+			if err := json.Unmarshal(out.Bytes(), &report); err != nil || !bytes.Contains(out.Bytes(), []byte("[]")) {
+				t.Errorf("json: unexpected output %q", out.String())
+			}
+			// The statistics are present, and zero since no lookup was made.
+			zero := map[string]any{
+				"latency":  map[string]any{"lookups": 0.0, "p50_ms": 0.0, "p90_ms": 0.0, "p99_ms": 0.0},
+				"fallback": map[string]any{"canary_name": "", "canary_result": "", "switched": false},
+			}
+			if !reflect.DeepEqual(report["stats"], zero) {
+				t.Errorf("json: got stats %v, want %v", report["stats"], zero)
+			}
+		case FormatYAML:
+			if !strings.HasPrefix(out.String(), "---\n") || !strings.Contains(out.String(), "domains: []\n") {
+				t.Errorf("yaml: unexpected output %q", out.String())
+			}
+		default:
+			if out.Len() != 0 {
+				t.Errorf("text: unexpected output %q", out.String())
+			}
+		}
+	}
+}
+
+func TestExecuteAllScansEveryDomainOnce(t *testing.T) {
+	var mutex sync.Mutex
+	queries := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		queries[r.URL.Query().Get("q")]++
+		mutex.Unlock()
+		_, _ = io.WriteString(w, "[]")
+	}))
+	defer server.Close()
+
+	var out bytes.Buffer
+	cfg := &Config{Domains: []string{"example.net"}, Format: FormatJSON, Writer: &out, CrtShURLs: []string{server.URL},
+		SkipPreflight: true, Resolver: "127.0.0.1:1", LogHandler: slog.NewTextHandler(io.Discard, nil)}
+	err := ExecuteAll([]string{"example.com", " example.org", "example.com", ""}, cfg)
+	if !errors.Is(err, ErrNoResults) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if len(queries) != 2 || queries["example.com"] == 0 || queries["example.org"] == 0 {
+		t.Errorf("unexpected queries %v", queries)
+	}
+	if !strings.Contains(out.String(), `"domain": "example.com,example.org"`) {
+		t.Errorf("unexpected output %s", out.String())
+	}
+	if !reflect.DeepEqual(cfg.Domains, []string{"example.net"}) {
+		t.Errorf("the config was changed: %v", cfg.Domains)
+	}
+
+	if err := ExecuteAll([]string{" "}, cfg); err == nil {
+		t.Error("expected an error without domains")
+	}
+}
+
+func TestBrokenTemplateFailsBeforeLookups(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+	}))
+	defer server.Close()
+
+	err := Execute(context.Background(), &Config{Domains: []string{"example.com"}, Template: "{{.Nope}}",
+		Writer: io.Discard, CrtShURLs: []string{server.URL}, SkipPreflight: true, Resolver: "127.0.0.1:1",
+		LogHandler: slog.NewTextHandler(io.Discard, nil)})
+	if err == nil || !strings.Contains(err.Error(), "Nope") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestYAMLWritesOneDocumentPerTarget(t *testing.T) {
+	report := Report{
+		Domain: "example.com,example.org",
+		Certificates: []Certificate{{Id: 1, NameValue: "*.example.org\nexample.org"},
+			{Id: 2, NameValue: "www.example.com"}},
+		Domains: []DNSLookupResult{{Domain: "www.example.com", Target: "example.com"},
+			{Domain: "example.org", Target: "example.org"}},
+		ExtendedDomains: []DNSLookupResult{{Domain: "api.example.org", Target: "example.org"}},
+		CNAMEDomains:    []DNSLookupResult{{Domain: "cdn.example.net"}},
+	}
+	var out bytes.Buffer
+	flags := &Config{Domains: []string{"example.org", "example.com"}, Format: FormatYAML}
+	if err := writeReport(&out, flags, report); err != nil {
+		t.Fatal(err)
+	}
+
+	documents := strings.Split(strings.TrimPrefix(out.String(), "---\n"), "---\n")
+	if len(documents) != 2 {
+		t.Fatalf("expected 2 documents, got %d:\n%s", len(documents), out.String())
+	}
+	for i, expected := range []struct {
+		domain  string
+		present []string
+		absent  []string
+	}{
+		{"example.org", []string{`"api.example.org"`, `"cdn.example.net"`, "id: 1\n"},
+			[]string{`"www.example.com"`, "id: 2\n"}},
+		{"example.com", []string{`"www.example.com"`, "id: 2\n"},
+			[]string{`"api.example.org"`, `"cdn.example.net"`, "id: 1\n"}},
+	} {
+		if !strings.HasPrefix(documents[i], `domain: "`+expected.domain+`"`) {
+			t.Errorf("document %d: expected domain %s:\n%s", i, expected.domain, documents[i])
+		}
+		for _, text := range expected.present {
+			if !strings.Contains(documents[i], text) {
+				t.Errorf("document %d: expected %s:\n%s", i, text, documents[i])
+			}
+		}
+		for _, text := range expected.absent {
+			if strings.Contains(documents[i], text) {
+				t.Errorf("document %d: unexpected %s:\n%s", i, text, documents[i])
+			}
+		}
+	}
+}
+
+func TestFieldsOutputHasNoSectionHeaders(t *testing.T) {
+	resolver := &fakeResolver{answers: map[string][]net.IP{
+		"www.example.com": {net.IPv4(192, 0, 2, 1)},
+		"api.example.com": {net.IPv4(192, 0, 2, 2)},
+	}}
+	var out bytes.Buffer
+	opts := testPrintOpts(1)
+	opts.out = &out
+	opts.fields, _ = parseFields([]string{"host", "ips"})
+	printDomains(resolver, []string{"www.example.com"}, []string{"api.example.com"}, opts)
+
+	if want := "www.example.com\t192.0.2.1\napi.example.com\t192.0.2.2\n"; out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
+
+func TestReplayGivesIdenticalOutput(t *testing.T) {
+	var names []string
+	for i := 0; i < 40; i++ {
+		names = append(names, fmt.Sprintf("host%d.example.com", i))
+	}
+	body, _ := json.Marshal([]Certificate{{Id: 1, CommonName: "example.com", NameValue: strings.Join(names, "\n")}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer server.Close()
+	logs := slog.NewTextHandler(io.Discard, nil)
+
+	// The lookups of the recorded run fail, their answers are replaced with addresses in descending order.
+	archive := filepath.Join(t.TempDir(), "session.tar")
+	_ = Execute(context.Background(), &Config{Domains: []string{"example.com"}, Writer: io.Discard,
+		CrtShURLs: []string{server.URL}, SkipPreflight: true, Resolver: "127.0.0.1:1", Record: archive,
+		LogHandler: logs})
+	recording, err := loadSession(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, entry := range recording.dns {
+		entry.Ips = []net.IP{net.ParseIP("2001:db8::1"), net.IPv4(192, 0, 2, 2), net.IPv4(192, 0, 2, 1)}
+		entry.ErrorClass, entry.Error = "", ""
+		recording.dns[key] = entry
+	}
+	if err := recording.save(archive); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatText, FormatJSON, FormatYAML} {
+		var outputs [2]bytes.Buffer
+		for i := range outputs {
+			err := Execute(context.Background(), &Config{Domains: []string{"example.com"}, Format: format,
+				Writer: &outputs[i], CrtShURLs: []string{server.URL}, Replay: archive, MaxConcurrency: 16,
+				LogHandler: logs})
+			if err != nil {
+				t.Fatalf("%s: %v", format, err)
+			}
+		}
+		if !bytes.Equal(outputs[0].Bytes(), outputs[1].Bytes()) {
+			t.Errorf("%s: the replays differ:\n%s\n%s", format, outputs[0].String(), outputs[1].String())
+		}
+		output := outputs[0].String()
+		if first, last := strings.Index(output, "host0."), strings.Index(output, "host9."); first < 0 || last < first {
+			t.Errorf("%s: the domains are not sorted:\n%s", format, output)
+		}
+		if low, high := strings.Index(output, "192.0.2.1"), strings.Index(output, "192.0.2.2"); low < 0 || high < low {
+			t.Errorf("%s: the addresses are not sorted:\n%s", format, output)
+		}
+	}
+}
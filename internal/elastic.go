@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Export formats.
+const ExportElastic = "elastic"
+
+// Environment variables holding the Elasticsearch credentials. An API key takes precedence over basic authentication.
+const (
+	envElasticAPIKey   = "ELASTIC_API_KEY"
+	envElasticUsername = "ELASTIC_USERNAME"
+	envElasticPassword = "ELASTIC_PASSWORD"
+)
+
+// elasticDocument struct used as the document indexed for each resolved domain.
+type elasticDocument struct {
+	Target string `json:"target"`
+	DNSLookupResult
+}
+
+// Return the ID of the document of a host. It depends only on the target and the host, so the document of a host is
+// replaced instead of duplicated when a run is imported again.
+func elasticDocumentID(target string, host string) string {
+	sum := sha256.Sum256([]byte(target + "\n" + strings.ToLower(host)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Write the results of the report in the NDJSON format of the Elasticsearch bulk API: an index action followed by the
+// document of every resolved domain.
+func writeElasticBulk(w io.Writer, target string, index string, report Report) error {
+	encoder := json.NewEncoder(w)
+	for _, results := range report.results() {
+		for _, result := range results {
+			action := map[string]map[string]string{
+				"index": {"_index": index, "_id": elasticDocumentID(target, result.Domain)},
+			}
+			if err := encoder.Encode(action); err != nil {
+				return err
+			}
+			if err := encoder.Encode(elasticDocument{Target: target, DNSLookupResult: result}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// elasticBulkResponse struct used to decode the per-item outcome of a bulk request.
+type elasticBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// Send the bulk payload to the Elasticsearch cluster at baseURL. Every document which could not be indexed is logged
+// and an error is returned if there was any.
+func postElasticBulk(ctx context.Context, client *http.Client, baseURL string, payload []byte,
+	logger *slog.Logger) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/_bulk",
+		bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if apiKey := os.Getenv(envElasticAPIKey); apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+	} else if username := os.Getenv(envElasticUsername); username != "" {
+		req.SetBasicAuth(username, os.Getenv(envElasticPassword))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("elasticsearch bulk request failed: %s: %s", resp.Status, body)
+	}
+
+	var bulk elasticBulkResponse
+	if err := json.Unmarshal(body, &bulk); err != nil {
+		return fmt.Errorf("unexpected elasticsearch response: %w", err)
+	}
+	failed := 0
+	for _, item := range bulk.Items {
+		for _, outcome := range item {
+			if outcome.Error != nil {
+				failed++
+				logger.Warn("failed to index document", "id", outcome.ID, "status", outcome.Status,
+					logKeyError, outcome.Error.Type+": "+outcome.Error.Reason)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d documents could not be indexed", failed, len(bulk.Items))
+	}
+	return nil
+}
+
+// Export the report to Elasticsearch: write the bulk payload to the output file, or to w if there is neither an output
+// file nor a cluster URL, and post it to the cluster if a URL is given.
+func exportElastic(ctx context.Context, flags *Config, httpOpts HTTPOpts, report Report, w io.Writer,
+	logger *slog.Logger) error {
+	target := flags.target()
+	var payload bytes.Buffer
+	if err := writeElasticBulk(&payload, target, flags.ElasticIndex, report); err != nil {
+		return err
+	}
+
+	switch {
+	case flags.Output != "":
+		if err := os.WriteFile(flags.Output, payload.Bytes(), 0644); err != nil {
+			return err
+		}
+	case flags.ElasticURL == "":
+		_, err := w.Write(payload.Bytes())
+		return err
+	}
+
+	if flags.ElasticURL == "" || payload.Len() == 0 {
+		return nil
+	}
+	// Only the trust settings are shared with the crt.sh client, its credentials must not reach the cluster.
+	client, err := NewHTTPClient(HTTPOpts{
+		TrustStoreFile: httpOpts.TrustStoreFile,
+		CACertFile:     httpOpts.CACertFile,
+		Insecure:       httpOpts.Insecure,
+		SourceIP:       httpOpts.SourceIP,
+		Timeout:        httpOpts.Timeout,
+	})
+	if err != nil {
+		return err
+	}
+	return postElasticBulk(ctx, client, flags.ElasticURL, payload.Bytes(), logger)
+}
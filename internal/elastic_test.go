@@ -0,0 +1,38 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExportElasticHonoursInsecure(t *testing.T) {
+	var posted int
+	// The certificate of the test server is signed by a CA unknown to the system.
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_bulk" {
+			posted++
+		}
+		_, _ = io.WriteString(w, `{"errors": false, "items": []}`)
+	}))
+	defer server.Close()
+
+	report := Report{Domains: []DNSLookupResult{{Domain: "a.example.com", Ips: []net.IP{net.IPv4(192, 0, 2, 1)}}}}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	flags := &Config{Domains: []string{"example.com"}, ElasticURL: server.URL, ElasticIndex: "domain-recon"}
+	var out bytes.Buffer
+	if err := exportElastic(context.Background(), flags, HTTPOpts{}, report, &out, logger); err == nil {
+		t.Error("expected the certificate of the cluster to be rejected")
+	}
+	if err := exportElastic(context.Background(), flags, HTTPOpts{Insecure: true}, report, &out, logger); err != nil {
+		t.Errorf("export with --insecure failed: %v", err)
+	}
+	if posted != 1 {
+		t.Errorf("%d bulk requests, want 1", posted)
+	}
+}
@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// ErrIncompleteResults is returned by Execute when most DNS lookups failed for the same reason, such as an
+// unreachable resolver, so the results are likely incomplete.
+var ErrIncompleteResults = errors.New("results are likely incomplete")
+
+// Settings of the detection of systematic lookup failures.
+const (
+	// Share of the lookups failing with the same class above which the failures are considered systematic.
+	failureRateThreshold = 0.9
+	// Number of lookups below which the share of failures is not meaningful.
+	failureMinLookups = 5
+)
+
+// lookupFailure struct used to report a failed DNS lookup.
+type lookupFailure struct {
+	domain string
+	err    error
+}
+
+// lookupFailures struct used to aggregate the failed DNS lookups of a run by error class.
+type lookupFailures struct {
+	lookups int
+	byClass map[string]int
+	// If set, every failure other than a non-existent name is logged.
+	verbose bool
+	logger  *slog.Logger
+}
+
+// Create an empty aggregate.
+func newLookupFailures(verbose bool, logger *slog.Logger) *lookupFailures {
+	return &lookupFailures{byClass: make(map[string]int), verbose: verbose, logger: logger}
+}
+
+// Count a successful lookup.
+func (f *lookupFailures) succeeded() {
+	f.lookups++
+}
+
+// Count a failed lookup.
+func (f *lookupFailures) failed(failure lookupFailure) {
+	f.lookups++
+	class := classifyLookupError(failure.err)
+	f.byClass[class]++
+	if f.verbose && class != lookupErrNXDomain {
+		f.logger.Info("lookup failed", logKeyDomain, failure.domain, logKeyError, failure.err)
+	}
+}
+
+// Check whether the failures are systematic. Most candidates do not exist, so NXDOMAIN answers never are. Returns
+// ErrIncompleteResults after a warning if another class of errors dominates.
+func (f *lookupFailures) check() error {
+	if f.lookups < failureMinLookups {
+		return nil
+	}
+	for class, count := range f.byClass {
+		if class == lookupErrNXDomain || float64(count) < failureRateThreshold*float64(f.lookups) {
+			continue
+		}
+		f.logger.Warn(fmt.Sprintf("%d of %d DNS lookups failed with %s errors, the results are likely incomplete; "+
+			"check the resolver", count, f.lookups, class), "class", class)
+		return ErrIncompleteResults
+	}
+	return nil
+}
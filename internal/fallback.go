@@ -0,0 +1,234 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Name which resolves on every resolver with access to the public DNS.
+const fallbackCanary = "example.com"
+
+// Time allowed for checking whether the public resolvers can be reached.
+const fallbackCheckTimeout = 3 * time.Second
+
+// Number of consecutive lookups failing with the same class of errors, other than non-existent names, after which
+// the system resolver is checked with the canary.
+const fallbackFailureStreak = 3
+
+// Public resolvers used when the system resolver cannot resolve public names.
+var publicResolvers = []string{"1.1.1.1", "8.8.8.8", "9.9.9.9"}
+
+// chainResolver struct used to try a list of resolvers in order until one of them answers. A name which does not
+// exist is not retried with the next resolver.
+type chainResolver struct {
+	resolvers []Resolver
+}
+
+func (r *chainResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	var err error
+	for _, resolver := range r.resolvers {
+		var ips []net.IP
+		if ips, err = resolver.LookupIP(ctx, host); err == nil || classifyLookupError(err) == lookupErrNXDomain {
+			return ips, err
+		}
+	}
+	return nil, err
+}
+
+func (r *chainResolver) String() string {
+	names := make([]string, 0, len(r.resolvers))
+	for _, resolver := range r.resolvers {
+		names = append(names, resolver.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// fallbackResolver struct used to switch from the system resolver to public resolvers when the system resolver turns
+// out to refuse public names, as on some locked-down machines. The check is done once, after fallbackFailureStreak
+// consecutive lookups failed with the same class of errors, by resolving a canary name which always exists. Names
+// which do not exist and lookups cut short by the caller tell nothing about the resolver and are not counted.
+type fallbackResolver struct {
+	system   Resolver
+	public   Resolver
+	logger   *slog.Logger
+	verbose  bool
+	once     sync.Once
+	switched atomic.Bool
+
+	mu sync.Mutex
+	// Class and number of the consecutive failures of the system resolver.
+	streakClass string
+	streak      int
+	// Outcome of the canary check, empty until it is done.
+	canaryResult string
+	// Names whose lookup failed on the system resolver and was not retried with the public resolvers.
+	failed map[string]bool
+}
+
+// Return a resolver using the system resolver, which falls back to public resolvers sending queries from localIP if
+// the system resolver cannot resolve public names.
+func newFallbackResolver(system Resolver, localIP net.IP, logger *slog.Logger, verbose bool) *fallbackResolver {
+	public := &chainResolver{}
+	for _, address := range publicResolvers {
+		public.resolvers = append(public.resolvers, NewResolver(address, localIP))
+	}
+	return &fallbackResolver{system: system, public: public, logger: logger, verbose: verbose,
+		failed: make(map[string]bool)}
+}
+
+func (r *fallbackResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if r.switched.Load() {
+		return r.public.LookupIP(ctx, host)
+	}
+
+	ips, err := r.system.LookupIP(ctx, host)
+	if err != nil && ctx.Err() != nil {
+		return nil, err
+	}
+	class := ""
+	if err != nil {
+		class = classifyLookupError(err)
+	}
+	if err == nil || class == lookupErrNXDomain {
+		r.countFailure("")
+		return ips, err
+	}
+	if r.countFailure(class) >= fallbackFailureStreak {
+		r.decide(ctx)
+	}
+	if r.switched.Load() {
+		return r.public.LookupIP(ctx, host)
+	}
+	r.mu.Lock()
+	r.failed[host] = true
+	r.mu.Unlock()
+	return nil, err
+}
+
+// Check whether the lookup of the host failed on the system resolver before the switch to the public resolvers, so it
+// is worth retrying now. The failures counted towards the streak which led to the switch are not retried otherwise.
+// Each host is reported once.
+func (r *fallbackResolver) retryable(host string) bool {
+	if !r.switched.Load() {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.failed[host] {
+		return false
+	}
+	delete(r.failed, host)
+	return true
+}
+
+// Count a failure of the class, or reset the count with an empty class. Returns the number of consecutive failures of
+// the class.
+func (r *fallbackResolver) countFailure(class string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if class != r.streakClass {
+		r.streakClass, r.streak = class, 0
+	}
+	if class != "" {
+		r.streak++
+	}
+	return r.streak
+}
+
+// Decide, once, whether to switch to the public resolvers.
+func (r *fallbackResolver) decide(ctx context.Context) {
+	r.once.Do(func() { r.switched.Store(r.systemBroken(ctx)) })
+}
+
+// Resolve the canary with the system resolver, deciding at once whether to switch to the public resolvers if it
+// fails: the canary always exists, so its failure is telling without a streak of failures. Used by the preflight
+// check, so a run is not aborted for a system resolver the run would switch away from.
+func (r *fallbackResolver) checkCanary(ctx context.Context) ([]net.IP, error) {
+	if !r.switched.Load() {
+		ips, err := r.system.LookupIP(ctx, fallbackCanary)
+		if err == nil || ctx.Err() != nil {
+			return ips, err
+		}
+		r.decide(ctx)
+		if !r.switched.Load() {
+			return nil, err
+		}
+	}
+	return r.public.LookupIP(ctx, fallbackCanary)
+}
+
+func (r *fallbackResolver) String() string {
+	if r.switched.Load() {
+		return r.public.String()
+	}
+	return r.system.String()
+}
+
+// Check whether the system resolver fails to resolve the canary while the public resolvers succeed.
+func (r *fallbackResolver) systemBroken(ctx context.Context) bool {
+	_, systemErr := r.system.LookupIP(ctx, fallbackCanary)
+	if systemErr == nil {
+		r.setCanaryResult("resolved by the system resolver, keeping it")
+		r.debug("system resolver resolved the canary, keeping it", "canary", fallbackCanary)
+		return false
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, fallbackCheckTimeout)
+	defer cancel()
+	if _, err := r.public.LookupIP(checkCtx, fallbackCanary); err != nil {
+		r.setCanaryResult("resolved by neither the system nor the public resolvers, keeping the system resolver")
+		r.debug("neither the system nor the public resolvers resolved the canary, keeping the system resolver",
+			"canary", fallbackCanary, logKeyError, err)
+		return false
+	}
+	r.setCanaryResult(fmt.Sprintf("not resolved by the system resolver (%s), switched to the public resolvers",
+		classifyLookupError(systemErr)))
+
+	r.logger.Warn(fmt.Sprintf("the system resolver cannot resolve public names (%s: %s), switching to public "+
+		"resolvers %s; use --no-fallback to prevent this", fallbackCanary, classifyLookupError(systemErr), r.public),
+		logKeyError, systemErr)
+	return true
+}
+
+// Store the outcome of the canary check for the statistics of the run.
+func (r *fallbackResolver) setCanaryResult(result string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.canaryResult = result
+}
+
+// Log the fallback decision with the statistics of the run, if the canary was checked.
+func (r *fallbackResolver) report() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.canaryResult != "" {
+		r.logger.Info("resolver fallback", "canary", fallbackCanary, "result", r.canaryResult,
+			"switched", r.switched.Load())
+	}
+}
+
+// Return the outcome of the canary check and whether the lookups were switched to the public resolvers.
+func (r *fallbackResolver) stats() FallbackStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := FallbackStats{Canary: r.canaryResult, Switched: r.switched.Load()}
+	if stats.Canary != "" {
+		stats.CanaryName = fallbackCanary
+	}
+	return stats
+}
+
+// Log the fallback decision at the info level if verbose output was requested, at the debug level otherwise.
+func (r *fallbackResolver) debug(msg string, args ...any) {
+	if r.verbose {
+		r.logger.Info(msg, args...)
+	} else {
+		r.logger.Debug(msg, args...)
+	}
+}
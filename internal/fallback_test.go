@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+)
+
+var servFail = &net.DNSError{Err: "server misbehaving", Name: "x"}
+
+func newTestFallback(system *fakeResolver, public *fakeResolver) *fallbackResolver {
+	return &fallbackResolver{system: system, public: public, logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		failed: make(map[string]bool)}
+}
+
+func TestFallbackIgnoresNonExistentNames(t *testing.T) {
+	system := &fakeResolver{name: "system"}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{fallbackCanary: {net.IPv4(1, 2, 3, 4)}}}
+	r := newTestFallback(system, public)
+	for i := 0; i < 10; i++ {
+		if _, err := r.LookupIP(context.Background(), "missing.example.com"); err == nil {
+			t.Fatal("expected the name not to exist")
+		}
+	}
+	if system.count(fallbackCanary) != 0 || r.switched.Load() {
+		t.Error("non-existent names triggered the canary check")
+	}
+}
+
+func TestFallbackIgnoresCanceledLookups(t *testing.T) {
+	system := &fakeResolver{name: "system", err: servFail}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{fallbackCanary: {net.IPv4(1, 2, 3, 4)}}}
+	r := newTestFallback(system, public)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 10; i++ {
+		_, _ = r.LookupIP(ctx, "a.example.com")
+	}
+	if system.count(fallbackCanary) != 0 || r.switched.Load() {
+		t.Error("canceled lookups triggered the canary check")
+	}
+}
+
+func TestFallbackSwitchesAfterStreak(t *testing.T) {
+	system := &fakeResolver{name: "system", err: servFail}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{
+		fallbackCanary:  {net.IPv4(1, 2, 3, 4)},
+		"a.example.com": {net.IPv4(5, 6, 7, 8)},
+	}}
+	r := newTestFallback(system, public)
+	for i := 1; i < fallbackFailureStreak; i++ {
+		if _, err := r.LookupIP(context.Background(), "a.example.com"); err == nil {
+			t.Fatalf("lookup %d: expected the failure of the system resolver", i)
+		}
+	}
+	if system.count(fallbackCanary) != 0 {
+		t.Fatal("the canary was checked before the streak was complete")
+	}
+	ips, err := r.LookupIP(context.Background(), "a.example.com")
+	if err != nil || len(ips) != 1 {
+		t.Fatalf("expected the public resolvers to answer, got %v, %v", ips, err)
+	}
+	if !r.switched.Load() {
+		t.Error("expected the switch to the public resolvers")
+	}
+}
+
+func TestFallbackStreakResetBySuccess(t *testing.T) {
+	system := &fakeResolver{name: "system", answers: map[string][]net.IP{"ok.example.com": {net.IPv4(5, 6, 7, 8)}},
+		errors: map[string]error{"a.example.com": servFail}}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{fallbackCanary: {net.IPv4(1, 2, 3, 4)}}}
+	r := newTestFallback(system, public)
+	for i := 0; i < 3; i++ {
+		for j := 1; j < fallbackFailureStreak; j++ {
+			_, _ = r.LookupIP(context.Background(), "a.example.com")
+		}
+		if _, err := r.LookupIP(context.Background(), "ok.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.switched.Load() {
+		t.Error("interrupted streaks triggered the switch")
+	}
+}
+
+func TestFallbackCheckCanary(t *testing.T) {
+	system := &fakeResolver{name: "system", err: servFail}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{fallbackCanary: {net.IPv4(1, 2, 3, 4)}}}
+	r := newTestFallback(system, public)
+	if _, err := r.checkCanary(context.Background()); err != nil {
+		t.Fatalf("expected the canary to resolve through the public resolvers: %v", err)
+	}
+	if !r.switched.Load() {
+		t.Error("expected the failed canary to switch to the public resolvers")
+	}
+	want := FallbackStats{CanaryName: fallbackCanary, Switched: true,
+		Canary: "not resolved by the system resolver (servfail), switched to the public resolvers"}
+	if stats := r.stats(); stats != want {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestFallbackRetriesLookupsFailedBeforeSwitch(t *testing.T) {
+	system := &fakeResolver{name: "system", err: servFail}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{fallbackCanary: {net.IPv4(1, 2, 3, 4)}}}
+	domains := []string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"}
+	for _, domain := range domains {
+		public.answers[domain] = []net.IP{net.IPv4(5, 6, 7, 8)}
+	}
+	r := newTestFallback(system, public)
+	opts := testPrintOpts(1)
+	opts.fallback = r
+
+	var resolved []string
+	resolveDomains(r, domains, opts, func(result DNSLookupResult) {
+		resolved = append(resolved, result.Domain)
+	})
+	if len(resolved) != len(domains) {
+		t.Errorf("resolved %v, want every one of %v", resolved, domains)
+	}
+	if opts.failures.lookups != len(domains) || len(opts.failures.byClass) != 0 {
+		t.Errorf("unexpected failures %+v", opts.failures)
+	}
+}
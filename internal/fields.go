@@ -0,0 +1,152 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Value of the --fields option listing the available fields.
+const FieldsHelp = "help"
+
+// Placeholder printed for a field without value.
+const emptyField = "-"
+
+// outputField struct used to describe a field of a result which can be selected for the output.
+type outputField struct {
+	name        string
+	description string
+	// Option which has to be set for the field to be populated, if any.
+	requires string
+	value    func(r DNSLookupResult) string
+}
+
+// Every field which can be selected, in the order they are listed by --fields help.
+var outputFields = []outputField{
+	{name: "host", description: "Resolved domain name", value: func(r DNSLookupResult) string { return r.Domain }},
+	{name: "ips", description: "Every IP address of the domain", value: func(r DNSLookupResult) string {
+		return strings.Join(r.displayIPs(), ",")
+	}},
+	{name: "ipv4", description: "IPv4 addresses of the domain", value: func(r DNSLookupResult) string {
+		return strings.Join(r.IPv4(), ",")
+	}},
+	{name: "ipv6", description: "IPv6 addresses of the domain", value: func(r DNSLookupResult) string {
+		return strings.Join(r.IPv6(), ",")
+	}},
+	{name: "tags", description: "Tags attached by the enrichment steps", value: func(r DNSLookupResult) string {
+		return strings.Join(r.Tags, ",")
+	}},
+	{name: "observed_at", description: "UTC time the domain was resolved", value: func(r DNSLookupResult) string {
+		return r.ObservedAt.Format(time.RFC3339)
+	}},
+	{name: "sni", description: "Result of the SNI check", requires: "--sni", value: func(r DNSLookupResult) string {
+		return r.SNI
+	}},
+	{name: "ports", description: "Open ports of the first IP address", requires: "--ports",
+		value: func(r DNSLookupResult) string {
+			ports := make([]string, 0, len(r.OpenPorts))
+			for _, port := range r.OpenPorts {
+				ports = append(ports, strconv.Itoa(port))
+			}
+			return strings.Join(ports, ",")
+		}},
+	{name: "cname", description: "CNAME record", requires: "--all-records", value: func(r DNSLookupResult) string {
+		if r.Records == nil {
+			return ""
+		}
+		return r.Records.CNAME
+	}},
+	{name: "mx", description: "MX records", requires: "--all-records",
+		value: recordsField(func(records FullDNSRecord) []string { return records.MX })},
+	{name: "ns", description: "NS records", requires: "--all-records",
+		value: recordsField(func(records FullDNSRecord) []string { return records.NS })},
+	{name: "txt", description: "TXT records", requires: "--all-records",
+		value: recordsField(func(records FullDNSRecord) []string { return records.TXT })},
+	{name: "target", description: "Target domain the domain was found for, when several are scanned",
+		value: func(r DNSLookupResult) string { return r.Target }},
+	{name: "typosquat_of", description: "Subdomain the domain is a typo variant of", requires: "--typosquat-check",
+		value: func(r DNSLookupResult) string { return r.TyposquatOf }},
+}
+
+// Return the value of a field holding a list of records of the domain.
+func recordsField(list func(records FullDNSRecord) []string) func(r DNSLookupResult) string {
+	return func(r DNSLookupResult) string {
+		if r.Records == nil {
+			return ""
+		}
+		return strings.Join(list(*r.Records), ",")
+	}
+}
+
+// Look up the fields by their names, keeping the given order. Fails on the first unknown name.
+func parseFields(names []string) ([]outputField, error) {
+	var fields []outputField
+	for _, name := range names {
+		found := false
+		for _, field := range outputFields {
+			if field.name == name {
+				fields = append(fields, field)
+				found = true
+				break
+			}
+		}
+		if !found {
+			known := make([]string, 0, len(outputFields))
+			for _, field := range outputFields {
+				known = append(known, field.name)
+			}
+			return nil, fmt.Errorf("unknown field %q, expected one of: %s", name, strings.Join(known, ", "))
+		}
+	}
+	return fields, nil
+}
+
+// Return the value of the named field of a result.
+func fieldValue(r DNSLookupResult, name string) string {
+	for _, field := range outputFields {
+		if field.name == name {
+			return field.value(r)
+		}
+	}
+	return ""
+}
+
+// Return the values of the fields of a result, separated by tabs.
+func formatFields(r DNSLookupResult, fields []outputField) string {
+	values := make([]string, 0, len(fields))
+	for _, field := range fields {
+		value := field.value(r)
+		if value == "" {
+			value = emptyField
+		}
+		values = append(values, value)
+	}
+	return strings.Join(values, "\t")
+}
+
+// Return the names of the fields separated by tabs, the header line of the lines formatted by formatFields.
+func formatFieldsHeader(fields []outputField) string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.name)
+	}
+	return strings.Join(names, "\t")
+}
+
+// WriteFieldsHelp lists the fields which can be selected with --fields.
+func WriteFieldsHelp(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, field := range outputFields {
+		description := field.description
+		if field.requires != "" {
+			description += " (requires " + field.requires + ")"
+		}
+		if _, err := fmt.Fprintf(tw, "%s\t%s\n", field.name, description); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,212 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Parameters of the Punycode encoding (RFC 3492, section 5).
+const (
+	punycodeBase        = 36
+	punycodeTMin        = 1
+	punycodeTMax        = 26
+	punycodeSkew        = 38
+	punycodeDamp        = 700
+	punycodeInitialBias = 72
+	punycodeInitialN    = 128
+)
+
+// Prefix of the labels of internationalized domain names encoded with Punycode.
+const acePrefix = "xn--"
+
+// Characters of other scripts which look like Latin letters, mapped to the letter they are confused with. This is the
+// subset of the Unicode confusables data relevant to lowercase hostnames.
+var latinConfusables = map[rune]rune{
+	// Cyrillic.
+	'а': 'a', 'в': 'b', 'ь': 'b', 'с': 'c', 'ԁ': 'd', 'е': 'e', 'ё': 'e', 'һ': 'h',
+	'і': 'i', 'ї': 'i', 'ј': 'j', 'к': 'k', 'ӏ': 'l', 'м': 'm', 'п': 'n', 'о': 'o',
+	'р': 'p', 'ԛ': 'q', 'г': 'r', 'ѕ': 's', 'т': 't', 'ц': 'u', 'ѵ': 'v', 'ԝ': 'w',
+	'х': 'x', 'у': 'y', 'з': '3',
+	// Greek.
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'γ': 'y', 'ω': 'w',
+	// Latin letters outside ASCII.
+	'ı': 'i', 'ɑ': 'a', 'ɡ': 'g', 'ɩ': 'i', 'ℓ': 'l',
+}
+
+// Scripts which are written together within a single word, and are therefore not mixed when they appear in a label.
+var scriptGroups = map[string]string{
+	"Hiragana": "Han",
+	"Katakana": "Han",
+	"Hangul":   "Han",
+	"Bopomofo": "Han",
+}
+
+// Decode a Punycode string (RFC 3492) into Unicode.
+func decodePunycode(s string) (string, error) {
+	var output []rune
+	pos := 0
+	if b := strings.LastIndexByte(s, '-'); b >= 0 {
+		for _, c := range []byte(s[:b]) {
+			if c >= 0x80 {
+				return "", fmt.Errorf("invalid punycode %q", s)
+			}
+			output = append(output, rune(c))
+		}
+		pos = b + 1
+	}
+
+	n, i, bias := punycodeInitialN, 0, punycodeInitialBias
+	for pos < len(s) {
+		oldI, w := i, 1
+		for k := punycodeBase; ; k += punycodeBase {
+			if pos >= len(s) {
+				return "", fmt.Errorf("invalid punycode %q", s)
+			}
+			digit := punycodeDigit(s[pos])
+			pos++
+			if digit < 0 {
+				return "", fmt.Errorf("invalid punycode %q", s)
+			}
+			i += digit * w
+			t := min(max(k-bias, punycodeTMin), punycodeTMax)
+			if digit < t {
+				break
+			}
+			w *= punycodeBase - t
+			if i > unicode.MaxRune*len(s) || w > unicode.MaxRune*len(s) {
+				return "", errors.New("punycode overflow")
+			}
+		}
+		bias = punycodeAdapt(i-oldI, len(output)+1, oldI == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > unicode.MaxRune {
+			return "", errors.New("punycode overflow")
+		}
+		output = append(output[:i], append([]rune{rune(n)}, output[i:]...)...)
+		i++
+	}
+	return string(output), nil
+}
+
+// Return the value of a Punycode digit, or -1 if the character is not a digit.
+func punycodeDigit(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c-'0') + 26
+	case c >= 'a' && c <= 'z':
+		return int(c - 'a')
+	case c >= 'A' && c <= 'Z':
+		return int(c - 'A')
+	}
+	return -1
+}
+
+// Adapt the bias after each decoded character (RFC 3492, section 6.1).
+func punycodeAdapt(delta int, numPoints int, first bool) int {
+	if first {
+		delta /= punycodeDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punycodeBase-punycodeTMin)*punycodeTMax)/2 {
+		delta /= punycodeBase - punycodeTMin
+		k += punycodeBase
+	}
+	return k + (punycodeBase-punycodeTMin+1)*delta/(delta+punycodeSkew)
+}
+
+// Return the Unicode form of a hostname, decoding its Punycode labels. Labels which cannot be decoded are kept.
+func decodeHostname(hostname string) string {
+	labels := strings.Split(hostname, ".")
+	for i, label := range labels {
+		if strings.HasPrefix(strings.ToLower(label), acePrefix) {
+			if decoded, err := decodePunycode(label[len(acePrefix):]); err == nil {
+				labels[i] = decoded
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Return the script of a letter, with the scripts written together merged. Returns an empty string for characters
+// shared by every script, such as digits and hyphens.
+func scriptOf(r rune) string {
+	if !unicode.IsLetter(r) {
+		return ""
+	}
+	for name, table := range unicode.Scripts {
+		if name != "Common" && name != "Inherited" && unicode.Is(table, r) {
+			if group, ok := scriptGroups[name]; ok {
+				return group
+			}
+			return name
+		}
+	}
+	return ""
+}
+
+// Check whether a label mixes letters of several scripts.
+func isMixedScript(label string) bool {
+	first := ""
+	for _, r := range label {
+		if script := scriptOf(r); script != "" {
+			if first == "" {
+				first = script
+			} else if script != first {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return the ASCII name a hostname would be confused with, by replacing every confusable character with the Latin
+// letter it looks like.
+func confusableSkeleton(hostname string) string {
+	return strings.Map(func(r rune) rune {
+		if latin, ok := latinConfusables[r]; ok {
+			return latin
+		}
+		return r
+	}, strings.ToLower(hostname))
+}
+
+// Find the internationalized hostnames which are likely homograph attacks: those with a label mixing several scripts,
+// and those which look like one of the ASCII hostnames or the target domains. Names written in a single script are
+// flagged only in the second case, since they are usually legitimate. Returns the reason of each finding by hostname.
+func findHomographs(hostnames []string, targets []string) map[string]string {
+	latinNames := make(map[string]bool)
+	for _, target := range targets {
+		latinNames[strings.ToLower(target)] = true
+	}
+	for _, hostname := range hostnames {
+		if decodeHostname(hostname) == hostname {
+			latinNames[strings.ToLower(hostname)] = true
+		}
+	}
+
+	homographs := make(map[string]string)
+	for _, hostname := range hostnames {
+		decoded := decodeHostname(hostname)
+		if decoded == hostname {
+			continue
+		}
+		if skeleton := confusableSkeleton(decoded); latinNames[skeleton] {
+			homographs[hostname] = fmt.Sprintf("%s looks like %s", decoded, skeleton)
+			continue
+		}
+		for _, label := range strings.Split(decoded, ".") {
+			if isMixedScript(label) {
+				homographs[hostname] = fmt.Sprintf("%s mixes scripts", decoded)
+				break
+			}
+		}
+	}
+	return homographs
+}
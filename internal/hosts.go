@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// hostsResolver struct used to answer the names listed in a hosts file from the file, and every other name with the
+// next resolver.
+type hostsResolver struct {
+	path  string
+	hosts map[string][]net.IP
+	next  Resolver
+}
+
+// Read a file in the hosts file format: an IP address followed by the names it is assigned to on each line, with
+// comments starting with "#". A name listed on several lines gets every address.
+func readHostsFile(path string) (map[string][]net.IP, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hosts := make(map[string][]net.IP)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ip := net.ParseIP(fields[0])
+		if ip == nil || len(fields) < 2 {
+			return nil, fmt.Errorf("%s:%d: expected an IP address followed by host names", path, lineNumber)
+		}
+		for _, name := range fields[1:] {
+			name = strings.ToLower(strings.TrimSuffix(name, "."))
+			if !containsIP(hosts[name], ip) {
+				hosts[name] = append(hosts[name], ip)
+			}
+		}
+	}
+	return hosts, scanner.Err()
+}
+
+// Check whether the list contains the IP address.
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, i := range ips {
+		if i.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check whether the host is answered from the hosts file.
+func (r *hostsResolver) overrides(host string) bool {
+	_, ok := r.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]
+	return ok
+}
+
+func (r *hostsResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	if ips, ok := r.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]; ok {
+		return ips, nil
+	}
+	return r.next.LookupIP(ctx, host)
+}
+
+func (r *hostsResolver) String() string {
+	return fmt.Sprintf("%s with overrides from %s", r.next, r.path)
+}
+
+// The other records of an overridden host still come from the next resolver, only the addresses are replaced.
+func (r *hostsResolver) LookupRecords(ctx context.Context, host string) FullDNSRecord {
+	records := lookupRecordsWith(ctx, r.next, host)
+	if ips, ok := r.hosts[strings.ToLower(strings.TrimSuffix(host, "."))]; ok {
+		records.A, records.AAAA = nil, nil
+		for _, ip := range ips {
+			if ip.To4() != nil {
+				records.A = append(records.A, ip.String())
+			} else {
+				records.AAAA = append(records.AAAA, ip.String())
+			}
+		}
+	}
+	return records
+}
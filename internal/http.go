@@ -0,0 +1,176 @@
+package internal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// HTTPOpts holds the settings of the HTTP client used to query certificate sources.
+type HTTPOpts struct {
+	// PEM file with CA certificates trusted instead of the system roots.
+	TrustStoreFile string
+	// PEM file with CA certificates trusted in addition to the system roots, or to the trust store if set.
+	CACertFile string
+	// Skip the verification of server certificates. Only meant for networks with TLS interception.
+	Insecure bool
+	// PEM files with the client certificate and its private key presented to servers requiring mutual TLS.
+	ClientCertFile string
+	ClientKeyFile  string
+	// PKCS#12 file holding the client certificate and its private key, used instead of the PEM files, and the password
+	// protecting it.
+	ClientP12File     string
+	ClientP12Password string
+	// Extra headers sent with every request, each in the form "Name: Value".
+	Headers []string
+	// Key sent as a bearer token in the Authorization header of every request.
+	APIKey string
+	// Header carrying the key for services using another authentication scheme, in the form "Name: Value".
+	APIKeyHeader string
+	// Local address the connections are made from. If nil, the operating system picks it.
+	SourceIP net.IP
+	// Time limit for a whole request, including reading the response body. Zero means no limit.
+	Timeout time.Duration
+}
+
+// NewHTTPClient returns an HTTP client configured according to the options.
+func NewHTTPClient(opts HTTPOpts) (*http.Client, error) {
+	tlsConfig, err := newTLSConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	headerValues := append([]string{}, opts.Headers...)
+	if opts.APIKeyHeader != "" {
+		headerValues = append(headerValues, opts.APIKeyHeader)
+	}
+	headers, err := parseHeaders(headerValues)
+	if err != nil {
+		return nil, err
+	}
+	if opts.APIKey != "" {
+		headers.Set("Authorization", "Bearer "+opts.APIKey)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if opts.SourceIP != nil {
+		transport.DialContext = dialFrom(opts.SourceIP, 30*time.Second)
+	}
+	var roundTripper http.RoundTripper = transport
+	if len(headers) > 0 {
+		roundTripper = &headerTransport{headers: headers, next: transport}
+	}
+	return &http.Client{Transport: roundTripper, Timeout: opts.Timeout}, nil
+}
+
+// Return the TLS settings of the options: the trusted CA certificates, the client certificate and whether server
+// certificates are verified.
+func newTLSConfig(opts HTTPOpts) (*tls.Config, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: opts.Insecure}
+
+	if opts.ClientP12File != "" && (opts.ClientCertFile != "" || opts.ClientKeyFile != "") {
+		return nil, errors.New("a PKCS#12 client certificate cannot be combined with the PEM certificate and key")
+	}
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, errors.New("a client certificate requires both the certificate and the key file")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if opts.ClientP12File != "" {
+		cert, err := loadPKCS12(opts.ClientP12File, opts.ClientP12Password)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	} else if opts.ClientP12Password != "" {
+		return nil, errors.New("a client certificate password requires a PKCS#12 client certificate")
+	}
+	if opts.TrustStoreFile != "" {
+		pool := x509.NewCertPool()
+		if err := appendCertsFromFile(pool, opts.TrustStoreFile); err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.CACertFile != "" {
+		pool := tlsConfig.RootCAs
+		if pool == nil {
+			var err error
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if err := appendCertsFromFile(pool, opts.CACertFile); err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// Read a client certificate and its private key from a PKCS#12 file protected by the password.
+func loadPKCS12(path string, password string) (tls.Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	key, cert, err := pkcs12.Decode(content, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return tls.Certificate{Certificate: [][]byte{cert.Raw}, PrivateKey: key, Leaf: cert}, nil
+}
+
+// Add the PEM-encoded certificates from a file to the pool.
+func appendCertsFromFile(pool *x509.CertPool, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return fmt.Errorf("%s: no PEM-encoded certificates found", path)
+	}
+	return nil
+}
+
+// Parse headers given in the form "Name: Value".
+func parseHeaders(values []string) (http.Header, error) {
+	headers := make(http.Header)
+	for _, value := range values {
+		name, content, found := strings.Cut(value, ":")
+		name = strings.TrimSpace(name)
+		if !found || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected \"Name: Value\"", value)
+		}
+		headers.Add(name, strings.TrimSpace(content))
+	}
+	return headers, nil
+}
+
+// headerTransport struct used to add the same headers to every request before passing it on.
+type headerTransport struct {
+	headers http.Header
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = append(req.Header[name], values...)
+	}
+	return t.next.RoundTrip(req)
+}
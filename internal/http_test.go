@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewTLSConfigPKCS12(t *testing.T) {
+	// client.p12 holds a self-signed certificate and its key, protected by the password "secret".
+	p12 := filepath.Join("testdata", "client.p12")
+	config, err := newTLSConfig(HTTPOpts{ClientP12File: p12, ClientP12Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Certificates) != 1 || config.Certificates[0].Leaf.Subject.CommonName != "domain-recon test client" ||
+		config.Certificates[0].PrivateKey == nil {
+		t.Errorf("unexpected client certificates %+v", config.Certificates)
+	}
+
+	for _, test := range []struct {
+		name string
+		opts HTTPOpts
+		err  string
+	}{
+		{name: "wrong password", opts: HTTPOpts{ClientP12File: p12, ClientP12Password: "wrong"},
+			err: "loading client certificate"},
+		{name: "password without file", opts: HTTPOpts{ClientP12Password: "secret"}, err: "requires a PKCS#12"},
+		{name: "PEM files too", opts: HTTPOpts{ClientP12File: p12, ClientCertFile: "cert.pem",
+			ClientKeyFile: "key.pem"}, err: "cannot be combined"},
+	} {
+		if _, err := newTLSConfig(test.opts); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"errors"
+	"strings"
+)
+
+// Issuer struct used to store the fields of a certificate issuer's distinguished name.
+type Issuer struct {
+	Organization string `json:"organization"`
+	CommonName   string `json:"common_name"`
+}
+
+// String returns the organization followed by the common name of the issuer.
+func (issuer Issuer) String() string {
+	switch {
+	case issuer.Organization == "":
+		return issuer.CommonName
+	case issuer.CommonName == "":
+		return issuer.Organization
+	}
+	return issuer.Organization + " (" + issuer.CommonName + ")"
+}
+
+// Parse a distinguished name in the form used by crt.sh, such as `C=US, O="DigiCert Inc", CN=DigiCert CA1`, and
+// extract the organization and the common name. If the name is malformed, the raw string is used as the common name.
+func parseIssuerName(dn string) Issuer {
+	attributes, err := parseDN(dn)
+	if err != nil {
+		return Issuer{CommonName: dn}
+	}
+	return Issuer{Organization: attributes["O"], CommonName: attributes["CN"]}
+}
+
+// Split a distinguished name into its attributes. Values may be quoted, and commas may be escaped with a backslash
+// outside quotes, in the types as well as in the values. If an attribute appears more than once, the first value is
+// kept.
+func parseDN(dn string) (map[string]string, error) {
+	attributes := make(map[string]string)
+
+	var key, value strings.Builder
+	inValue, quoted, escaped := false, false, false
+	flush := func() error {
+		k := strings.TrimSpace(key.String())
+		if k == "" || !inValue {
+			return errors.New("attribute without a type")
+		}
+		if _, exists := attributes[strings.ToUpper(k)]; !exists {
+			attributes[strings.ToUpper(k)] = strings.TrimSpace(value.String())
+		}
+		key.Reset()
+		value.Reset()
+		inValue = false
+		return nil
+	}
+
+	for _, r := range dn {
+		switch {
+		case escaped && inValue:
+			value.WriteRune(r)
+			escaped = false
+		case escaped:
+			key.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"' && inValue:
+			quoted = !quoted
+		case r == ',' && !quoted:
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case r == '=' && !inValue:
+			inValue = true
+		case inValue:
+			value.WriteRune(r)
+		default:
+			key.WriteRune(r)
+		}
+	}
+
+	if quoted || escaped {
+		return nil, errors.New("unterminated quote or escape sequence")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return attributes, nil
+}
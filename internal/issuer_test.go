@@ -0,0 +1,68 @@
+package internal
+
+import "testing"
+
+func TestParseIssuerName(t *testing.T) {
+	tests := []struct {
+		dn   string
+		want Issuer
+	}{
+		{dn: "C=US, O=Let's Encrypt, CN=R3", want: Issuer{Organization: "Let's Encrypt", CommonName: "R3"}},
+		{dn: `C=US, O="DigiCert Inc", CN=DigiCert TLS RSA SHA256 2020 CA1`,
+			want: Issuer{Organization: "DigiCert Inc", CommonName: "DigiCert TLS RSA SHA256 2020 CA1"}},
+		// Commas inside quotes and escaped commas are part of the value.
+		{dn: `C=US, ST=Arizona, L=Scottsdale, O="GoDaddy.com, Inc.", OU=http://certs.godaddy.com/repository/, ` +
+			`CN=Go Daddy Secure Certificate Authority - G2`, want: Issuer{Organization: "GoDaddy.com, Inc.",
+			CommonName: "Go Daddy Secure Certificate Authority - G2"}},
+		{dn: `C=US, O=Amazon\, Inc., CN=Amazon RSA 2048 M01`,
+			want: Issuer{Organization: "Amazon, Inc.", CommonName: "Amazon RSA 2048 M01"}},
+		// Escaped quotes inside a quoted value.
+		{dn: `C=GB, O="The \"Best\" CA Ltd", CN=Best CA`,
+			want: Issuer{Organization: `The "Best" CA Ltd`, CommonName: "Best CA"}},
+		// The keys are case-insensitive, and an escaped character in a key does not end up in a value.
+		{dn: `c=DE, o=D-Trust GmbH, cn=D-TRUST CA 2-2 2019, X\=Y=ignored`,
+			want: Issuer{Organization: "D-Trust GmbH", CommonName: "D-TRUST CA 2-2 2019"}},
+		{dn: `C=US, O\,X=ignored, O=Sectigo Limited, CN=Sectigo RSA Domain Validation Secure Server CA`,
+			want: Issuer{Organization: "Sectigo Limited",
+				CommonName: "Sectigo RSA Domain Validation Secure Server CA"}},
+		// The first value of a repeated attribute is kept.
+		{dn: "CN=Root, CN=Intermediate", want: Issuer{CommonName: "Root"}},
+		// Attributes other than O and CN do not matter.
+		{dn: "C=JP, O=SECOM Trust Systems CO.\\,LTD., OU=Security Communication RootCA2",
+			want: Issuer{Organization: "SECOM Trust Systems CO.,LTD."}},
+		// Malformed names fall back to the raw string.
+		{dn: `C=US, O="Unterminated, CN=X`, want: Issuer{CommonName: `C=US, O="Unterminated, CN=X`}},
+		{dn: `C=US, CN=Trailing\`, want: Issuer{CommonName: `C=US, CN=Trailing\`}},
+		{dn: "Just a name", want: Issuer{CommonName: "Just a name"}},
+		{dn: "C=US, , CN=X", want: Issuer{CommonName: "C=US, , CN=X"}},
+		{dn: "=US, CN=X", want: Issuer{CommonName: "=US, CN=X"}},
+	}
+	for _, test := range tests {
+		if got := parseIssuerName(test.dn); got != test.want {
+			t.Errorf("parseIssuerName(%q) = %+v, want %+v", test.dn, got, test.want)
+		}
+	}
+}
+
+func TestParseDNEscapedKey(t *testing.T) {
+	attributes, err := parseDN(`O\,X=a, CN=b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes["O,X"] != "a" || attributes["CN"] != "b" || len(attributes) != 2 {
+		t.Errorf("unexpected attributes %q", attributes)
+	}
+}
+
+func TestIssuerString(t *testing.T) {
+	tests := map[Issuer]string{
+		{Organization: "Let's Encrypt", CommonName: "R3"}: "Let's Encrypt (R3)",
+		{Organization: "Let's Encrypt"}:                   "Let's Encrypt",
+		{CommonName: "R3"}:                                "R3",
+	}
+	for issuer, want := range tests {
+		if got := issuer.String(); got != want {
+			t.Errorf("%+v: got %q, want %q", issuer, got, want)
+		}
+	}
+}
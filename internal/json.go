@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// FormatResults returns the domains and the extended domains in the layout written by the JSON format, as a report
+// holding only them. The certificate ids are left empty, since the certificates are not known here.
+func FormatResults(domains []DNSLookupResult, extended []DNSLookupResult) []byte {
+	report := Report{Domains: domains, ExtendedDomains: extended}
+	report.Counts = ReportCounts{Domains: len(domains), ExtendedDomains: len(extended)}
+	return marshalJSON(report)
+}
+
+// Write the report as a single JSON object, with the same structure as the YAML output.
+func writeJSON(w io.Writer, report Report) error {
+	_, err := w.Write(marshalJSON(report))
+	return err
+}
+
+// Encode the report as an indented JSON object followed by a newline. Empty lists are written as [] rather than null.
+// The report contains no value which cannot be encoded, so there is no error to return.
+func marshalJSON(report Report) []byte {
+	for _, list := range []*[]DNSLookupResult{&report.Domains, &report.ExtendedDomains} {
+		if *list == nil {
+			*list = []DNSLookupResult{}
+		}
+	}
+	if report.Certificates == nil {
+		report.Certificates = []Certificate{}
+	}
+	content, _ := json.MarshalIndent(report, "", "  ")
+	return append(content, '\n')
+}
+
+// Return the sorted ids of the certificates listing the domain, or the wildcard covering it if there are none.
+func certificateIds(index map[string][]Certificate, domain string) []int {
+	certificates := index[domain]
+	if len(certificates) == 0 {
+		if _, parent, ok := strings.Cut(domain, "."); ok {
+			certificates = index["*."+parent]
+		}
+	}
+	seen := make(map[int]bool)
+	ids := make([]int, 0, len(certificates))
+	for _, cert := range certificates {
+		if !seen[cert.Id] {
+			seen[cert.Id] = true
+			ids = append(ids, cert.Id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+)
+
+func TestFormatResultsKeepsExtendedDomainsApart(t *testing.T) {
+	domains := []DNSLookupResult{{Domain: "www.example.com", Ips: []net.IP{net.ParseIP("192.0.2.1")}}}
+	extended := []DNSLookupResult{{Domain: "dev.example.com", Ips: []net.IP{net.ParseIP("192.0.2.2")}}}
+
+	var document struct {
+		Domains  []DNSLookupResult `json:"domains"`
+		Extended []DNSLookupResult `json:"extended"`
+		Counts   ReportCounts      `json:"counts"`
+	}
+	if err := json.Unmarshal(FormatResults(domains, extended), &document); err != nil {
+		t.Fatal(err)
+	}
+	if len(document.Domains) != 1 || document.Domains[0].Domain != "www.example.com" {
+		t.Errorf("got domains %v, want only www.example.com", document.Domains)
+	}
+	if len(document.Extended) != 1 || document.Extended[0].Domain != "dev.example.com" {
+		t.Errorf("got extended domains %v, want only dev.example.com", document.Extended)
+	}
+	if document.Counts.Domains != 1 || document.Counts.ExtendedDomains != 1 {
+		t.Errorf("got counts %+v, want one domain and one extended domain", document.Counts)
+	}
+
+	var empty map[string]any
+	if err := json.Unmarshal(FormatResults(nil, nil), &empty); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"domains", "extended"} {
+		if list, ok := empty[key].([]any); !ok || len(list) != 0 {
+			t.Errorf("got %s %v, want an empty array", key, empty[key])
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Attribute key of the resolver a DNS lookup was sent to.
+const logKeyResolver = "resolver"
+
+// latencyRecorder struct used to collect the duration of every DNS lookup, grouped by resolver. Lookups slower than the
+// threshold are logged as they complete.
+type latencyRecorder struct {
+	threshold time.Duration
+	logger    *slog.Logger
+
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+}
+
+// Return a recorder logging the lookups slower than the threshold. A zero threshold disables the logging of slow
+// lookups.
+func newLatencyRecorder(threshold time.Duration, logger *slog.Logger) *latencyRecorder {
+	return &latencyRecorder{threshold: threshold, logger: logger, latencies: make(map[string][]time.Duration)}
+}
+
+// Record the duration of a lookup of the domain sent to the resolver.
+func (r *latencyRecorder) record(resolver Resolver, domain string, duration time.Duration) {
+	if r.threshold > 0 && duration > r.threshold {
+		r.logger.Info("slow DNS lookup", logKeyResolver, resolver.String(), logKeyDomain, domain,
+			logKeyDuration, duration)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[resolver.String()] = append(r.latencies[resolver.String()], duration)
+}
+
+// Log the p50/p90/p99 latencies of every lookup and, if more than one resolver was used, of the lookups sent to each
+// resolver.
+func (r *latencyRecorder) report() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var all []time.Duration
+	resolvers := make([]string, 0, len(r.latencies))
+	for resolver, latencies := range r.latencies {
+		all = append(all, latencies...)
+		resolvers = append(resolvers, resolver)
+	}
+	if len(all) == 0 {
+		return
+	}
+
+	r.logPercentiles("DNS lookup latency", all)
+	if len(resolvers) > 1 {
+		sort.Strings(resolvers)
+		for _, resolver := range resolvers {
+			r.logPercentiles("DNS lookup latency", r.latencies[resolver], logKeyResolver, resolver)
+		}
+	}
+}
+
+// Log the percentiles of the latencies with the extra attributes.
+func (r *latencyRecorder) logPercentiles(msg string, latencies []time.Duration, args ...any) {
+	sorted := sortedDurations(latencies)
+	args = append(args, "lookups", len(sorted), "p50", percentile(sorted, 50), "p90", percentile(sorted, 90),
+		"p99", percentile(sorted, 99))
+	r.logger.Info(msg, args...)
+}
+
+// Return the percentiles of every lookup recorded so far and, if more than one resolver was used, of the lookups sent
+// to each resolver, by resolver.
+func (r *latencyRecorder) stats() (LatencyStats, map[string]LatencyStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var all []time.Duration
+	for _, latencies := range r.latencies {
+		all = append(all, latencies...)
+	}
+	var perResolver map[string]LatencyStats
+	if len(r.latencies) > 1 {
+		perResolver = make(map[string]LatencyStats, len(r.latencies))
+		for resolver, latencies := range r.latencies {
+			perResolver[resolver] = newLatencyStats(latencies)
+		}
+	}
+	return newLatencyStats(all), perResolver
+}
+
+// Return the number of lookups and the percentiles of their latencies.
+func newLatencyStats(latencies []time.Duration) LatencyStats {
+	sorted := sortedDurations(latencies)
+	milliseconds := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	return LatencyStats{Lookups: len(sorted), P50: milliseconds(percentile(sorted, 50)),
+		P90: milliseconds(percentile(sorted, 90)), P99: milliseconds(percentile(sorted, 99))}
+}
+
+// Return a sorted copy of the durations.
+func sortedDurations(durations []time.Duration) []time.Duration {
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
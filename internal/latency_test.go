@@ -0,0 +1,34 @@
+package internal
+
+import (
+	"io"
+	"log/slog"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyRecorderStats(t *testing.T) {
+	r := newLatencyRecorder(0, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if all, perResolver := r.stats(); all != (LatencyStats{}) || perResolver != nil {
+		t.Errorf("got %+v and %v without lookups, want zero stats", all, perResolver)
+	}
+
+	first, second := &fakeResolver{name: "first"}, &fakeResolver{name: "second"}
+	for i := 1; i <= 10; i++ {
+		r.record(first, "a.example.com", time.Duration(i)*time.Millisecond)
+	}
+	r.record(second, "b.example.com", 1500*time.Microsecond)
+
+	all, perResolver := r.stats()
+	if want := (LatencyStats{Lookups: 11, P50: 5, P90: 9, P99: 10}); all != want {
+		t.Errorf("got %+v, want %+v", all, want)
+	}
+	want := map[string]LatencyStats{
+		"first":  {Lookups: 10, P50: 5, P90: 9, P99: 10},
+		"second": {Lookups: 1, P50: 1.5, P90: 1.5, P99: 1.5},
+	}
+	if !reflect.DeepEqual(perResolver, want) {
+		t.Errorf("got %+v, want %+v", perResolver, want)
+	}
+}
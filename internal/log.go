@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// Attribute keys shared by every diagnostic message, so log collectors can rely on them.
+const (
+	logKeySource   = "source"
+	logKeyDomain   = "domain"
+	logKeyDuration = "duration"
+	logKeyError    = "error"
+)
+
+// NewLogHandler returns a slog.Handler writing records of at least the given level to w. The format can be either
+// "text" or "json".
+func NewLogHandler(w io.Writer, format string, level slog.Level) (slog.Handler, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.NewTextHandler(w, opts), nil
+	case "json":
+		return slog.NewJSONHandler(w, opts), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// Return a logger writing to the handler. If there is no handler, the default logger is returned.
+func newLogger(handler slog.Handler) *slog.Logger {
+	if handler == nil {
+		return slog.Default()
+	}
+	return slog.New(handler)
+}
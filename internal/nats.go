@@ -0,0 +1,242 @@
+package internal
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Settings of the connection to the NATS server.
+const (
+	DefaultNATSSubject   = "recon.subdomains"
+	natsDefaultPort      = "4222"
+	natsTimeout          = 5 * time.Second
+	natsReconnects       = 3
+	natsReconnectBackoff = time.Second
+	// Number of messages published between two confirmations by the server.
+	natsFlushBatch = 100
+)
+
+// Environment variables holding the NATS credentials. A token takes precedence over a user and password, which in
+// turn take precedence over credentials embedded in the URL.
+const (
+	envNATSToken    = "NATS_TOKEN"
+	envNATSUser     = "NATS_USER"
+	envNATSPassword = "NATS_PASSWORD"
+)
+
+// natsMessage struct used as the JSON payload published for each resolved domain.
+type natsMessage struct {
+	Target string `json:"target"`
+	RunID  string `json:"run_id"`
+	DNSLookupResult
+}
+
+// natsConn struct used to publish messages over the NATS client protocol.
+type natsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// Return a random ID identifying the messages published by a run.
+func newRunID() string {
+	buf := make([]byte, 8)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// Publish a message for every result to flags.NATSSubject on the NATS server at flags.NATSURL. The messages are
+// flushed before returning, so short runs do not drop them. If the connection breaks, the client reconnects and
+// publishes again the messages the server has not confirmed yet, so they are delivered at least once. Failures are
+// reported in a single warning.
+func sendNATSMessages(flags *Config, httpOpts HTTPOpts, logger *slog.Logger, results ...[]DNSLookupResult) {
+	// Only the trust settings are shared with the crt.sh client, as for Splunk.
+	tlsConfig, err := newTLSConfig(HTTPOpts{
+		TrustStoreFile: httpOpts.TrustStoreFile,
+		CACertFile:     httpOpts.CACertFile,
+		Insecure:       httpOpts.Insecure,
+	})
+	if err != nil {
+		logger.Warn("failed to publish findings to NATS", logKeyError, err)
+		return
+	}
+
+	runID := newRunID()
+	var payloads [][]byte
+	for _, list := range results {
+		for _, result := range list {
+			payload, err := json.Marshal(natsMessage{Target: flags.target(), RunID: runID, DNSLookupResult: result})
+			if err != nil {
+				logger.Warn("failed to publish findings to NATS", logKeyError, err)
+				return
+			}
+			payloads = append(payloads, payload)
+		}
+	}
+
+	subject := flags.NATSSubject
+	if subject == "" {
+		subject = DefaultNATSSubject
+	}
+
+	confirmed := 0
+	for attempt := 0; attempt <= natsReconnects; attempt++ {
+		if attempt > 0 {
+			logger.Debug("reconnecting to NATS", logKeyError, err, "confirmed", confirmed)
+			time.Sleep(time.Duration(attempt) * natsReconnectBackoff)
+		}
+		var count int
+		count, err = publishNATS(flags.NATSURL, httpOpts.SourceIP, tlsConfig, subject, payloads[confirmed:])
+		if confirmed += count; err == nil {
+			return
+		}
+	}
+	logger.Warn(fmt.Sprintf("failed to publish %d of %d findings to NATS", len(payloads)-confirmed, len(payloads)),
+		logKeyError, err)
+}
+
+// Connect to the server from the source IP address, publish the payloads and wait until the server has processed them.
+// The server is asked to confirm every natsFlushBatch messages. Returns the number of payloads it confirmed.
+func publishNATS(address string, sourceIP net.IP, tlsConfig *tls.Config, subject string,
+	payloads [][]byte) (int, error) {
+	nc, err := dialNATS(address, sourceIP, tlsConfig)
+	if err != nil {
+		return 0, err
+	}
+	defer nc.conn.Close()
+
+	confirmed := 0
+	for confirmed < len(payloads) {
+		batch := payloads[confirmed:min(confirmed+natsFlushBatch, len(payloads))]
+		for _, payload := range batch {
+			if _, err := fmt.Fprintf(nc.writer, "PUB %s %d\r\n%s\r\n", subject, len(payload), payload); err != nil {
+				return confirmed, err
+			}
+		}
+		if err := nc.flush(); err != nil {
+			return confirmed, err
+		}
+		confirmed += len(batch)
+	}
+	return confirmed, nil
+}
+
+// Connect to the NATS server at the address, given as "nats://host:port" or "tls://host:port", from the source IP
+// address, and authenticate. The connection is upgraded to TLS with the settings if the server requires it.
+func dialNATS(address string, sourceIP net.IP, tlsConfig *tls.Config) (*natsConn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("invalid NATS address %q, expected nats://host:port", address)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), natsDefaultPort)
+	}
+
+	conn, err := dialFrom(sourceIP, natsTimeout)(context.Background(), "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(natsTimeout))
+	nc := &natsConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	// The server greets with its INFO, which says whether TLS is required.
+	line, err := nc.reader.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	if !strings.HasPrefix(line, "INFO ") || json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info) != nil {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected NATS greeting: %s", strings.TrimSpace(line))
+	}
+	if info.TLSRequired || u.Scheme == "tls" {
+		config := tlsConfig.Clone()
+		config.ServerName = u.Hostname()
+		tlsConn := tls.Client(conn, config)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		nc.conn = tlsConn
+		nc.reader = bufio.NewReader(tlsConn)
+	}
+	nc.writer = bufio.NewWriter(nc.conn)
+
+	connect, _ := json.Marshal(natsConnectOptions(u))
+	if _, err := fmt.Fprintf(nc.writer, "CONNECT %s\r\n", connect); err != nil {
+		nc.conn.Close()
+		return nil, err
+	}
+	// Authentication errors are only reported in answer to the next command.
+	if err := nc.flush(); err != nil {
+		nc.conn.Close()
+		return nil, err
+	}
+	return nc, nil
+}
+
+// Return the options of the CONNECT command, with the credentials from the environment or the URL.
+func natsConnectOptions(u *url.URL) map[string]any {
+	options := map[string]any{"verbose": false, "pedantic": false, "name": "domain-recon", "lang": "go"}
+	if token := os.Getenv(envNATSToken); token != "" {
+		options["auth_token"] = token
+	} else if user := os.Getenv(envNATSUser); user != "" {
+		options["user"] = user
+		options["pass"] = os.Getenv(envNATSPassword)
+	} else if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			options["user"] = u.User.Username()
+			options["pass"] = password
+		} else {
+			options["auth_token"] = u.User.Username()
+		}
+	}
+	return options
+}
+
+// Send the buffered commands followed by a PING, and wait for the PONG confirming the server processed them.
+func (nc *natsConn) flush() error {
+	_ = nc.conn.SetDeadline(time.Now().Add(natsTimeout))
+	if _, err := nc.writer.WriteString("PING\r\n"); err != nil {
+		return err
+	}
+	if err := nc.writer.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := nc.reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := nc.conn.Write([]byte("PONG\r\n")); err != nil {
+				return err
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS server: " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeNATS struct used to accept NATS clients, recording the payloads they publish. The first connection is dropped
+// instead of answering its PING number dropAtPing, if set.
+type fakeNATS struct {
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	dropAtPing int
+
+	mu          sync.Mutex
+	connections int
+	payloads    []string
+}
+
+// Start a fake NATS server, requiring TLS with the configuration if it is set.
+func newFakeNATS(t *testing.T, tlsConfig *tls.Config, dropAtPing int) *fakeNATS {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeNATS{listener: listener, tlsConfig: tlsConfig, dropAtPing: dropAtPing}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.connections++
+			first := server.connections == 1
+			server.mu.Unlock()
+			go server.serve(conn, first)
+		}
+	}()
+	return server
+}
+
+func (s *fakeNATS) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+func (s *fakeNATS) serve(conn net.Conn, first bool) {
+	defer conn.Close()
+	fmt.Fprintf(conn, "INFO {\"tls_required\":%t}\r\n", s.tlsConfig != nil)
+	if s.tlsConfig != nil {
+		tlsConn := tls.Server(conn, s.tlsConfig)
+		if tlsConn.Handshake() != nil {
+			return
+		}
+		conn = tlsConn
+	}
+	reader := bufio.NewReader(conn)
+	pings := 0
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 3 && fields[0] == "PUB":
+			var length int
+			fmt.Sscan(fields[2], &length)
+			payload := make([]byte, length+2)
+			if _, err := io.ReadFull(reader, payload); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.payloads = append(s.payloads, string(payload[:length]))
+			s.mu.Unlock()
+		case len(fields) == 1 && fields[0] == "PING":
+			if pings++; first && pings == s.dropAtPing {
+				return
+			}
+			fmt.Fprint(conn, "PONG\r\n")
+		}
+	}
+}
+
+// Return the number of times each payload was received.
+func (s *fakeNATS) received() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int)
+	for _, payload := range s.payloads {
+		counts[payload]++
+	}
+	return counts
+}
+
+// Return results for the domains 0.example.com to n-1.example.com.
+func natsTestResults(n int) []DNSLookupResult {
+	results := make([]DNSLookupResult, n)
+	for i := range results {
+		results[i] = DNSLookupResult{Domain: fmt.Sprintf("%d.example.com", i)}
+	}
+	return results
+}
+
+func TestSendNATSMessages(t *testing.T) {
+	server := newFakeNATS(t, nil, 0)
+	flags := &Config{Domains: []string{"example.com"}, NATSURL: server.url()}
+	sendNATSMessages(flags, HTTPOpts{}, slog.New(slog.NewTextHandler(io.Discard, nil)), natsTestResults(250))
+
+	received := server.received()
+	if len(received) != 250 {
+		t.Fatalf("received %d distinct messages, want 250", len(received))
+	}
+	for payload, count := range received {
+		if count != 1 || !strings.Contains(payload, `"target":"example.com"`) {
+			t.Errorf("received %d times: %s", count, payload)
+		}
+	}
+}
+
+func TestSendNATSMessagesResumesAfterConfirmed(t *testing.T) {
+	// The connection breaks before the second batch is confirmed, the first PING confirming the CONNECT command.
+	server := newFakeNATS(t, nil, 3)
+	flags := &Config{Domains: []string{"example.com"}, NATSURL: server.url()}
+	sendNATSMessages(flags, HTTPOpts{}, slog.New(slog.NewTextHandler(io.Discard, nil)), natsTestResults(250))
+
+	received := server.received()
+	if len(received) != 250 {
+		t.Fatalf("received %d distinct messages, want 250", len(received))
+	}
+	for payload, count := range received {
+		var i int
+		_, _ = fmt.Sscanf(payload[strings.Index(payload, `"domain":"`)+len(`"domain":"`):], "%d", &i)
+		want := 1
+		if i >= natsFlushBatch && i < 2*natsFlushBatch {
+			// The second batch was sent before the connection broke, and again after the reconnection.
+			want = 2
+		}
+		if count != want {
+			t.Errorf("received %d times, want %d: %s", count, want, payload)
+		}
+	}
+}
+
+func TestSendNATSMessagesTrustsCACertFile(t *testing.T) {
+	// The certificate of the test HTTPS server is valid for 127.0.0.1 and signed by a CA unknown to the system.
+	https := httptest.NewTLSServer(http.NotFoundHandler())
+	defer https.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: https.Certificate().Raw})
+	if err := os.WriteFile(caFile, caPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := &tls.Config{Certificates: https.TLS.Certificates}
+
+	for _, test := range []struct {
+		name  string
+		opts  HTTPOpts
+		count int
+	}{
+		{name: "untrusted", opts: HTTPOpts{}, count: 0},
+		{name: "CA file", opts: HTTPOpts{CACertFile: caFile}, count: 3},
+		{name: "insecure", opts: HTTPOpts{Insecure: true}, count: 3},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := newFakeNATS(t, tlsConfig, 0)
+			config, err := newTLSConfig(test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, err := publishNATS(server.url(), nil, config, DefaultNATSSubject, [][]byte{{'a'}, {'b'}, {'c'}})
+			if count != test.count || (test.count > 0) != (err == nil) {
+				t.Errorf("published %d messages with error %v, want %d", count, err, test.count)
+			}
+		})
+	}
+}
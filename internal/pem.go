@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Layout used by crt.sh for the validity timestamps of a certificate.
+const crtShTimeLayout = "2006-01-02T15:04:05"
+
+// Read a PEM-encoded certificate or certificate chain from a file and convert every certificate into the same form as
+// the certificates returned by crt.sh. The domain part of every e-mail address from the SAN extension is used as a
+// domain name as well.
+func readPEMCertificates(path string) ([]Certificate, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	certificates, err := parsePEMCertificates(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return certificates, nil
+}
+
+// Parse every PEM-encoded certificate from the content and convert it into a Certificate.
+func parsePEMCertificates(content []byte) ([]Certificate, error) {
+	var certificates []Certificate
+	for {
+		var block *pem.Block
+		block, content = pem.Decode(content)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, fromX509Certificate(cert))
+	}
+
+	if len(certificates) == 0 {
+		return nil, errors.New("no PEM-encoded certificates found")
+	}
+	return certificates, nil
+}
+
+// Convert a parsed X.509 certificate into a Certificate.
+func fromX509Certificate(cert *x509.Certificate) Certificate {
+	names := append([]string{}, cert.DNSNames...)
+	for _, email := range cert.EmailAddresses {
+		if at := strings.LastIndex(email, "@"); at >= 0 {
+			names = append(names, email[at+1:])
+		}
+	}
+
+	precertificate := false
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(precertificatePoisonOID) {
+			precertificate = true
+		}
+	}
+
+	issuer := Issuer{Organization: strings.Join(cert.Issuer.Organization, ", "), CommonName: cert.Issuer.CommonName}
+	return Certificate{
+		Precertificate: precertificate,
+		IssuerName:     cert.Issuer.String(),
+		Issuer:         issuer,
+		CommonName:     cert.Subject.CommonName,
+		NameValue:      strings.Join(names, "\n"),
+		NotBefore:      cert.NotBefore.UTC().Format(crtShTimeLayout),
+		NotAfter:       cert.NotAfter.UTC().Format(crtShTimeLayout),
+		SerialNumber:   cert.SerialNumber.Text(16),
+	}
+}
@@ -0,0 +1,149 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Maximum number of permutations generated. The count is checked before generating them, so a large word list with a
+// high --permute-labels fails at once instead of exhausting the memory.
+const maxPermutations = 1_000_000
+
+// Separators used to join labels when generating permutations.
+var permutationSeparators = []string{"-", "_", ""}
+
+// GeneratePermutations returns every ordered combination of at least two and at most maxLen distinct labels, joined by
+// each of the separators "-", "_" and the empty string. For the labels "api" and "dev" it returns "api-dev",
+// "api_dev", "apidev", "dev-api", "dev_api" and "devapi". The number of results grows quickly with maxLen, so an
+// error is returned instead if there would be more than maxPermutations.
+func GeneratePermutations(labels []string, maxLen int) ([]string, error) {
+	if count := permutationCount(len(labels), maxLen); count > maxPermutations {
+		return nil, fmt.Errorf("combining %d words up to %d labels gives more than %d names, lower --permute-labels "+
+			"or use fewer words", len(labels), maxLen, maxPermutations)
+	}
+	var permutations []string
+	seen := make(map[string]bool)
+	used := make([]bool, len(labels))
+	var chosen []string
+
+	var generate func()
+	generate = func() {
+		if len(chosen) >= 2 {
+			for _, separator := range permutationSeparators {
+				permutation := strings.Join(chosen, separator)
+				if !seen[permutation] {
+					seen[permutation] = true
+					permutations = append(permutations, permutation)
+				}
+			}
+		}
+		if len(chosen) == maxLen {
+			return
+		}
+		for i, label := range labels {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			chosen = append(chosen, label)
+			generate()
+			chosen = chosen[:len(chosen)-1]
+			used[i] = false
+		}
+	}
+	generate()
+
+	return permutations, nil
+}
+
+// Return the number of permutations of at least two and at most maxLen of n labels, joined by each separator,
+// counting the duplicates. Counts above maxPermutations are returned as maxPermutations+1.
+func permutationCount(n int, maxLen int) int {
+	total, ordered := 0, n
+	for length := 2; length <= min(maxLen, n); length++ {
+		ordered *= n - length + 1
+		total += ordered * len(permutationSeparators)
+		if ordered > maxPermutations || total > maxPermutations {
+			return maxPermutations + 1
+		}
+	}
+	return total
+}
+
+// Return the base followed by each number from 1 to max, such as "api1", "api2" and "api3".
+func generateNumberSuffixes(base string, max int) []string {
+	var candidates []string
+	for i := 1; i <= max; i++ {
+		candidates = append(candidates, base+strconv.Itoa(i))
+	}
+	return candidates
+}
+
+// Return the base followed by each number from min to max.
+func numberSuffixes(base string, min int, max int) []string {
+	if min < 1 {
+		min = 1
+	}
+	if min > max {
+		return nil
+	}
+	return generateNumberSuffixes(base, max)[min-1:]
+}
+
+// Append the numbers from min to max to the first label of a subdomain, turning "api.example.com" into
+// "api1.example.com", "api2.example.com" and so on. Names with less than three labels are left alone, since changing
+// the first label of "example.com" would leave the domain.
+func suffixFirstLabel(domain string, min int, max int) []string {
+	label, rest, _ := strings.Cut(domain, ".")
+	if strings.Count(rest, ".") < 1 {
+		return nil
+	}
+	var candidates []string
+	for _, suffixed := range numberSuffixes(label, min, max) {
+		candidates = append(candidates, suffixed+"."+rest)
+	}
+	return candidates
+}
+
+// Affixes added to the labels of discovered subdomains in fuzz mode.
+var (
+	fuzzPrefixes = []string{"api-", "dev-", "staging-", "prod-", "test-", "beta-"}
+	fuzzSuffixes = []string{"-api", "-v2", "-new"}
+)
+
+// Return the names obtained by adding each fuzz prefix and suffix to each label of the domains below the root, such
+// as "dev-api.example.com" and "api-v2.example.com" for "api.example.com". If the root is empty or a domain is not
+// below it, only the first label of domains with at least three labels is changed, as with the number suffixes.
+func generateFuzzCandidates(domains []string, root string) []string {
+	root = strings.ToLower(strings.TrimSuffix(root, "."))
+	var candidates []string
+	for _, domain := range domains {
+		labels := strings.Split(strings.ToLower(domain), ".")
+		fuzzed := 1
+		if root != "" && strings.HasSuffix(strings.ToLower(domain), "."+root) {
+			fuzzed = len(labels) - strings.Count(root, ".") - 1
+		} else if len(labels) < 3 {
+			continue
+		}
+		for i := 0; i < fuzzed; i++ {
+			label := labels[i]
+			var variants []string
+			for _, prefix := range fuzzPrefixes {
+				if !strings.HasPrefix(label, prefix) && label+"-" != prefix {
+					variants = append(variants, prefix+label)
+				}
+			}
+			for _, suffix := range fuzzSuffixes {
+				if !strings.HasSuffix(label, suffix) && "-"+label != suffix {
+					variants = append(variants, label+suffix)
+				}
+			}
+			for _, variant := range variants {
+				candidate := append(append(append([]string{}, labels[:i]...), variant), labels[i+1:]...)
+				candidates = append(candidates, strings.Join(candidate, "."))
+			}
+		}
+	}
+	return uniqueSorted(candidates)
+}
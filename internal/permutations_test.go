@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePermutations(t *testing.T) {
+	permutations, err := GeneratePermutations([]string{"api", "dev"}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"api-dev", "api_dev", "apidev", "dev-api", "dev_api", "devapi"}
+	if !reflect.DeepEqual(permutations, want) {
+		t.Errorf("got %q, want %q", permutations, want)
+	}
+}
+
+func TestPermutationCount(t *testing.T) {
+	tests := []struct {
+		n, maxLen, want int
+	}{
+		{n: 2, maxLen: 2, want: 6},
+		{n: 3, maxLen: 2, want: 18},
+		{n: 3, maxLen: 3, want: 36},
+		// Lengths above the number of labels add nothing.
+		{n: 3, maxLen: 10, want: 36},
+		{n: 1, maxLen: 3, want: 0},
+		{n: 10_000, maxLen: 5, want: maxPermutations + 1},
+	}
+	for _, test := range tests {
+		if got := permutationCount(test.n, test.maxLen); got != test.want {
+			t.Errorf("permutationCount(%d, %d) = %d, want %d", test.n, test.maxLen, got, test.want)
+		}
+	}
+	for _, labels := range [][]string{{"a", "b", "c", "d"}, {"a", "b", "c"}} {
+		permutations, _ := GeneratePermutations(labels, 3)
+		if got := permutationCount(len(labels), 3); got != len(permutations) {
+			t.Errorf("%d labels: counted %d permutations, generated %d", len(labels), got, len(permutations))
+		}
+	}
+}
+
+func TestGeneratePermutationsRejectsTooMany(t *testing.T) {
+	labels := make([]string, 200)
+	for i := range labels {
+		labels[i] = strings.Repeat("a", i+1)
+	}
+	permutations, err := GeneratePermutations(labels, 4)
+	if err == nil || !strings.Contains(err.Error(), "lower --permute-labels") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if permutations != nil {
+		t.Errorf("generated %d permutations", len(permutations))
+	}
+}
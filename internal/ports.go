@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Timeout of the connection attempted to each scanned port.
+const portTimeout = 3 * time.Second
+
+// Parse the ports given with --ports, which must be between 1 and 65535. The ports are returned sorted, each once.
+func parsePorts(values []string) ([]int, error) {
+	seen := make(map[int]bool)
+	var ports []int
+	for _, value := range values {
+		port, err := strconv.Atoi(value)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid port '%s', expected a number between 1 and 65535", value)
+		}
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+	return ports, nil
+}
+
+// Return the ports of the IP address accepting TCP connections from the source IP address, in increasing order. The
+// ports are tried concurrently.
+func scanPorts(ctx context.Context, ip net.IP, ports []int, sourceIP net.IP) []int {
+	ctx, cancel := context.WithTimeout(ctx, portTimeout)
+	defer cancel()
+
+	open := make([]bool, len(ports))
+	var wg sync.WaitGroup
+	for i, port := range ports {
+		i, port := i, port
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := dialFrom(sourceIP, portTimeout)(ctx, "tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+			if err == nil {
+				open[i] = true
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	var openPorts []int
+	for i, port := range ports {
+		if open[i] {
+			openPorts = append(openPorts, port)
+		}
+	}
+	return openPorts
+}
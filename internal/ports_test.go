@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParsePorts(t *testing.T) {
+	ports, err := parsePorts([]string{"8443", "80", "443", "80"})
+	if err != nil || !reflect.DeepEqual(ports, []int{80, 443, 8443}) {
+		t.Errorf("got %v, %v", ports, err)
+	}
+	for _, value := range []string{"0", "65536", "http", ""} {
+		if _, err := parsePorts([]string{value}); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestScanPorts(t *testing.T) {
+	open, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer open.Close()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+	openPort := open.Addr().(*net.TCPAddr).Port
+
+	got := scanPorts(context.Background(), net.IPv4(127, 0, 0, 1), []int{closedPort, openPort}, nil)
+	if !reflect.DeepEqual(got, []int{openPort}) {
+		t.Errorf("got %v, want [%d]", got, openPort)
+	}
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Time limit of each preflight check.
+const preflightTimeout = 15 * time.Second
+
+// Name looked up to check that the resolver answers. The name always exists, so only addresses pass the check: a
+// resolver saying that it does not exist is as broken as one not answering.
+const preflightCanary = fallbackCanary
+
+// preflightCheck struct used to describe a component verified before a run.
+type preflightCheck struct {
+	component string
+	target    string
+	// A run cannot succeed if a required component fails. Endpoints are required as a group, since the run falls back
+	// from one to the next.
+	required bool
+	run      func(ctx context.Context) (string, error)
+}
+
+// preflightResult struct used to store the outcome of a preflight check.
+type preflightResult struct {
+	check   preflightCheck
+	latency time.Duration
+	detail  string
+	err     error
+}
+
+// Return the checks of the components used by the run: the proxies and the crt.sh endpoints, unless certificates are
+// read from a file, and the resolver.
+func preflightChecks(flags *Config, client *http.Client, resolver Resolver, sourceIP net.IP) []preflightCheck {
+	var checks []preflightCheck
+	if flags.PEMFile == "" {
+		endpoints := flags.fetchOpts(client).URLs
+		if len(endpoints) == 0 {
+			endpoints = []string{defaultCrtShURL}
+		}
+		proxies := map[string]bool{}
+		for _, endpoint := range endpoints {
+			req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+			if err != nil {
+				continue
+			}
+			proxy, err := http.ProxyFromEnvironment(req)
+			if err == nil && proxy != nil && !proxies[proxy.Host] {
+				proxies[proxy.Host] = true
+				checks = append(checks, preflightCheck{component: "proxy", target: proxy.Redacted(), required: true,
+					run: func(ctx context.Context) (string, error) { return checkProxy(ctx, proxy, sourceIP) }})
+			}
+		}
+		fetchOpts := flags.fetchOpts(client)
+		for _, endpoint := range endpoints {
+			endpoint := endpoint
+			checks = append(checks, preflightCheck{component: "crt.sh", target: endpoint, required: len(endpoints) == 1,
+				run: func(ctx context.Context) (string, error) { return checkEndpoint(ctx, fetchOpts, endpoint) }})
+		}
+	}
+	checks = append(checks, preflightCheck{component: "resolver", target: resolver.String(), required: true,
+		run: func(ctx context.Context) (string, error) { return checkResolver(ctx, resolver) }})
+	return checks
+}
+
+// Run the checks one after the other, each bounded by preflightTimeout within ctx. Returns their results and an error
+// if a required component failed, or if every endpoint failed.
+func runPreflight(ctx context.Context, checks []preflightCheck, logger *slog.Logger) ([]preflightResult, error) {
+	results := make([]preflightResult, 0, len(checks))
+	var failed []string
+	endpoints, endpointFailures := 0, 0
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, preflightTimeout)
+		start := time.Now()
+		detail, err := check.run(checkCtx)
+		cancel()
+		result := preflightResult{check: check, latency: time.Since(start), detail: detail, err: err}
+		results = append(results, result)
+		logger.Debug("preflight check", "component", check.component, logKeySource, check.target,
+			logKeyDuration, result.latency, logKeyError, err)
+
+		if check.component == "crt.sh" {
+			endpoints++
+		}
+		if err == nil {
+			continue
+		}
+		if check.component == "crt.sh" {
+			endpointFailures++
+		}
+		if check.required {
+			failed = append(failed, check.component+" "+check.target)
+		}
+	}
+	if endpoints > 1 && endpointFailures == endpoints {
+		failed = append(failed, "every crt.sh endpoint")
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("preflight check failed: %s", strings.Join(failed, ", "))
+	}
+	return results, nil
+}
+
+// Print the results of the checks as a table.
+func writePreflightTable(w io.Writer, results []preflightResult) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tTARGET\tSTATUS\tLATENCY\tDETAIL")
+	for _, result := range results {
+		status, detail := "pass", result.detail
+		if result.err != nil {
+			status, detail = "FAIL", result.err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", result.check.component, result.check.target, status,
+			result.latency.Round(time.Millisecond), detail)
+	}
+	return tw.Flush()
+}
+
+// Check that the endpoint answers, and that the configured credentials are accepted. Responses with status 429 or 5xx
+// are retried like the requests of the run, opts.Retries times, as long as the time limit of the check allows.
+func checkEndpoint(ctx context.Context, opts FetchOpts, endpoint string) (string, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return "", err
+		}
+		resp, err := opts.client().Do(req)
+		if err != nil {
+			return "", err
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			return "", fmt.Errorf("authentication failed: %s", resp.Status)
+		case !(&statusError{code: resp.StatusCode}).retryable():
+			return resp.Status, nil
+		}
+		err = fmt.Errorf("server error: %s", resp.Status)
+		if attempt > 0 {
+			err = fmt.Errorf("server error: %s after %d attempts", resp.Status, attempt+1)
+		}
+		if attempt >= opts.Retries || sleepContext(ctx, opts.retryDelay(attempt)) != nil {
+			return "", err
+		}
+	}
+}
+
+// Check that the resolver answers the canary lookup.
+func checkResolver(ctx context.Context, resolver Resolver) (string, error) {
+	var ips []net.IP
+	var err error
+	// A failing system resolver is not fatal if the run switches to the public resolvers instead.
+	if fallback, ok := resolver.(*fallbackResolver); ok {
+		ips, err = fallback.checkCanary(ctx)
+	} else {
+		ips, err = resolver.LookupIP(ctx, preflightCanary)
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return "", fmt.Errorf("answered NXDOMAIN for %s, which exists", preflightCanary)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("answered no address for %s", preflightCanary)
+	}
+	return fmt.Sprintf("resolved %s to %d addresses", preflightCanary, len(ips)), nil
+}
+
+// Check that the proxy accepts connections.
+func checkProxy(ctx context.Context, proxy *url.URL, sourceIP net.IP) (string, error) {
+	host := proxy.Host
+	if proxy.Port() == "" {
+		port := "80"
+		if proxy.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(proxy.Hostname(), port)
+	}
+	conn, err := dialFrom(sourceIP, preflightTimeout)(ctx, "tcp", host)
+	if err != nil {
+		return "", err
+	}
+	conn.Close()
+	return "accepts connections", nil
+}
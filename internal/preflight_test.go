@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCheckResolverUsesFallback(t *testing.T) {
+	system := &fakeResolver{name: "system", err: servFail}
+	public := &fakeResolver{name: "public", answers: map[string][]net.IP{preflightCanary: {net.IPv4(1, 2, 3, 4)}}}
+	if _, err := checkResolver(context.Background(), newTestFallback(system, public)); err != nil {
+		t.Errorf("expected the check to pass through the public resolvers: %v", err)
+	}
+	if _, err := checkResolver(context.Background(), system); err == nil {
+		t.Error("expected the check of the failing resolver alone to fail")
+	}
+}
+
+func TestCheckEndpointRetriesServerErrors(t *testing.T) {
+	server, requests := newFlakyCrtSh(t, 2, http.StatusServiceUnavailable)
+	if _, err := checkEndpoint(context.Background(), testFetchOpts(server, 3), server.URL); err != nil {
+		t.Errorf("expected the check to pass after the retries: %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("%d requests, want 3", got)
+	}
+
+	server, _ = newFlakyCrtSh(t, 100, http.StatusServiceUnavailable)
+	_, err := checkEndpoint(context.Background(), testFetchOpts(server, 1), server.URL)
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCheckResolverRequiresAddresses(t *testing.T) {
+	if _, err := checkResolver(context.Background(), &fakeResolver{name: "lying"}); err == nil {
+		t.Error("expected a resolver answering NXDOMAIN for the canary to fail the check")
+	}
+	empty := &fakeResolver{name: "empty", answers: map[string][]net.IP{preflightCanary: {}}}
+	if _, err := checkResolver(context.Background(), empty); err == nil {
+		t.Error("expected a resolver answering without addresses to fail the check")
+	}
+}
+
+func TestRunPreflightStopsWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	check := preflightCheck{component: "resolver", target: "system", required: true,
+		run: func(ctx context.Context) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		}}
+	results, err := runPreflight(ctx, []preflightCheck{check}, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err == nil {
+		t.Fatal("expected the canceled run to fail the required check")
+	}
+	if len(results) != 1 || !errors.Is(results[0].err, context.Canceled) {
+		t.Errorf("unexpected results %+v", results)
+	}
+}
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"sort"
+	"strings"
+)
+
+// Return a function checking whether a hostname belongs to the target. With target domains, their subdomains are in
+// scope. Otherwise, when the certificates were found by organization or read from a file, hostnames sharing the
+// registrable domain of one of the discovered domains are, such as example.co.uk but not all of co.uk.
+func newScope(domains []string, discovered []string) func(hostname string) bool {
+	if len(domains) > 0 {
+		return func(hostname string) bool {
+			hostname = strings.ToLower(hostname)
+			for _, domain := range domains {
+				domain = strings.ToLower(domain)
+				if hostname == domain || strings.HasSuffix(hostname, "."+domain) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	bases := make(map[string]bool)
+	for _, name := range discovered {
+		if base := registrableDomain(name); base != "" {
+			bases[base] = true
+		}
+	}
+	return func(hostname string) bool {
+		base := registrableDomain(hostname)
+		return base != "" && bases[base]
+	}
+}
+
+// Collect the hosts the MX and NS records of the results point to, leaving out the names already known. Returns the
+// in-scope hosts with the tags of the records pointing to them, and the sorted out-of-scope hosts.
+func recordTargets(results []DNSLookupResult, known []string, inScope func(string) bool) (map[string][]string,
+	[]string) {
+	seen := make(map[string]bool)
+	for _, name := range known {
+		seen[strings.ToLower(name)] = true
+	}
+
+	targets := make(map[string][]string)
+	external := make(map[string]bool)
+	add := func(host string, tag string) {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		// A null MX record (RFC 7505) has "." as its host.
+		if host == "" || seen[host] {
+			return
+		}
+		if !inScope(host) {
+			external[host] = true
+			return
+		}
+		for _, t := range targets[host] {
+			if t == tag {
+				return
+			}
+		}
+		targets[host] = append(targets[host], tag)
+	}
+	for _, result := range results {
+		if result.Records == nil {
+			continue
+		}
+		for _, mx := range result.Records.MX {
+			// Each MX record is formatted as "preference host".
+			if _, host, found := strings.Cut(mx, " "); found {
+				add(host, TagMXTarget)
+			}
+		}
+		for _, ns := range result.Records.NS {
+			add(ns, TagNSTarget)
+		}
+	}
+
+	var externalHosts []string
+	for host := range external {
+		externalHosts = append(externalHosts, host)
+	}
+	sort.Strings(externalHosts)
+	return targets, externalHosts
+}
+
+// Resolve the record targets, attaching their tags, and pass each resolved target to the handler.
+func resolveRecordTargets(resolver Resolver, targets map[string][]string, opts printOpts,
+	handle func(DNSLookupResult)) {
+	// Hosts pointed to by the same record types share their options.
+	groups := make(map[string][]string)
+	for host, tags := range targets {
+		key := strings.Join(tags, ",")
+		groups[key] = append(groups[key], host)
+	}
+	for key, hosts := range groups {
+		resolveDomains(resolver, hosts, opts.withTags(strings.Split(key, ",")...), handle)
+	}
+}
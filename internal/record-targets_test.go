@@ -0,0 +1,27 @@
+package internal
+
+import "testing"
+
+func TestNewScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		domains    []string
+		discovered []string
+		hostname   string
+		want       bool
+	}{
+		{"target itself", []string{"example.com"}, nil, "example.com", true},
+		{"subdomain of target", []string{"example.com"}, nil, "mx.Example.com", true},
+		{"other domain", []string{"example.com"}, nil, "example.net", false},
+		{"suffix of target", []string{"example.com"}, nil, "badexample.com", false},
+		{"discovered registrable domain", nil, []string{"www.example.co.uk"}, "mx.example.co.uk", true},
+		{"other owner under the same suffix", nil, []string{"www.example.co.uk"}, "mx.other.co.uk", false},
+		{"public suffix", nil, []string{"www.example.co.uk"}, "co.uk", false},
+		{"other tenant of a platform", nil, []string{"app.azurewebsites.net"}, "other.azurewebsites.net", false},
+	}
+	for _, test := range tests {
+		if got := newScope(test.domains, test.discovered)(test.hostname); got != test.want {
+			t.Errorf("%s: inScope(%q) = %v, want %v", test.name, test.hostname, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// FullDNSRecord struct used to store the DNS records of a domain, beyond its IP addresses.
+type FullDNSRecord struct {
+	A     []string `json:"a,omitempty"`
+	AAAA  []string `json:"aaaa,omitempty"`
+	CNAME string   `json:"cname,omitempty"`
+	MX    []string `json:"mx,omitempty"`
+	NS    []string `json:"ns,omitempty"`
+	TXT   []string `json:"txt,omitempty"`
+	CAA   []string `json:"caa,omitempty"`
+	// SOA record of the zone, if the domain is the apex of one.
+	SOA *SOARecord `json:"soa,omitempty"`
+}
+
+// Check whether no record was found.
+func (record FullDNSRecord) empty() bool {
+	return len(record.A) == 0 && len(record.AAAA) == 0 && record.CNAME == "" && len(record.MX) == 0 &&
+		len(record.NS) == 0 && len(record.TXT) == 0 && len(record.CAA) == 0 && record.SOA == nil
+}
+
+// recordResolver is implemented by the resolvers able to look up every record type of a FullDNSRecord.
+type recordResolver interface {
+	LookupRecords(ctx context.Context, host string) FullDNSRecord
+}
+
+func (r systemResolver) LookupRecords(ctx context.Context, host string) FullDNSRecord {
+	record := lookupRecords(ctx, r.resolver, host)
+	lookupZoneRecords(ctx, r, r.resolver, host, r.localIP, &record)
+	return record
+}
+
+func (r *serverResolver) LookupRecords(ctx context.Context, host string) FullDNSRecord {
+	record := lookupRecords(ctx, r.resolver, fqdn(host))
+	lookupZoneRecords(ctx, r, r.resolver, host, r.localIP, &record)
+	return record
+}
+
+// Records are looked up with the resolvers of the chain in order, until one of them finds some.
+func (r *chainResolver) LookupRecords(ctx context.Context, host string) FullDNSRecord {
+	var record FullDNSRecord
+	for _, resolver := range r.resolvers {
+		if record = lookupRecordsWith(ctx, resolver, host); !record.empty() || ctx.Err() != nil {
+			break
+		}
+	}
+	return record
+}
+
+func (r *fallbackResolver) LookupRecords(ctx context.Context, host string) FullDNSRecord {
+	if r.switched.Load() {
+		return lookupRecordsWith(ctx, r.public, host)
+	}
+	return lookupRecordsWith(ctx, r.system, host)
+}
+
+// Look up the records using the resolver, if it supports it.
+func lookupRecordsWith(ctx context.Context, resolver Resolver, host string) FullDNSRecord {
+	if records, ok := resolver.(recordResolver); ok {
+		return records.LookupRecords(ctx, host)
+	}
+	return FullDNSRecord{}
+}
+
+// Query every record type in parallel. Record types which cannot be looked up are left empty.
+func lookupRecords(ctx context.Context, resolver *net.Resolver, host string) FullDNSRecord {
+	var record FullDNSRecord
+	var wg sync.WaitGroup
+	run := func(lookup func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lookup()
+		}()
+	}
+
+	run(func() {
+		if ips, err := resolver.LookupIP(ctx, "ip4", host); err == nil {
+			for _, ip := range ips {
+				record.A = append(record.A, ip.String())
+			}
+		}
+	})
+	run(func() {
+		if ips, err := resolver.LookupIP(ctx, "ip6", host); err == nil {
+			for _, ip := range ips {
+				record.AAAA = append(record.AAAA, ip.String())
+			}
+		}
+	})
+	run(func() {
+		if cname, err := resolver.LookupCNAME(ctx, host); err == nil && !sameName(cname, host) {
+			record.CNAME = strings.TrimSuffix(cname, ".")
+		}
+	})
+	run(func() {
+		if mxs, err := resolver.LookupMX(ctx, host); err == nil {
+			for _, mx := range mxs {
+				record.MX = append(record.MX, fmt.Sprintf("%d %s", mx.Pref, strings.TrimSuffix(mx.Host, ".")))
+			}
+		}
+	})
+	run(func() {
+		if nss, err := resolver.LookupNS(ctx, host); err == nil {
+			for _, ns := range nss {
+				record.NS = append(record.NS, strings.TrimSuffix(ns.Host, "."))
+			}
+		}
+	})
+	run(func() {
+		if txts, err := resolver.LookupTXT(ctx, host); err == nil {
+			record.TXT = txts
+		}
+	})
+	wg.Wait()
+
+	return record
+}
+
+// Ask the nameservers of the zone of the host for its CAA records, and for its SOA record if the host is the apex of
+// the zone, since the standard library cannot look them up. The zone of a host without NS records of its own is taken
+// to be its registrable domain. The nameservers are tried in turn until one of them answers, and records which none
+// of them returns are left empty.
+func lookupZoneRecords(ctx context.Context, r Resolver, resolver *net.Resolver, host string, localIP net.IP,
+	record *FullDNSRecord) {
+	host = strings.TrimSuffix(host, ".")
+	query := nameserverOpts{resolver: r, localIP: localIP}
+	nameservers := record.NS
+	if len(nameservers) == 0 {
+		domain := registrableDomain(host)
+		if domain == "" || sameName(domain, host) {
+			return
+		}
+		nss, err := resolver.LookupNS(ctx, fqdn(domain))
+		if err != nil || len(nss) == 0 {
+			return
+		}
+		for _, ns := range nss {
+			nameservers = append(nameservers, strings.TrimSuffix(ns.Host, "."))
+		}
+	} else {
+		for _, nameserver := range nameservers {
+			if soa := querySOA(ctx, query, host, nameserver); soa.Error == "" {
+				record.SOA = &soa
+				break
+			}
+		}
+	}
+	for _, nameserver := range nameservers {
+		if caa, err := queryCAA(ctx, query, host, nameserver); err == nil {
+			record.CAA = caa
+			break
+		}
+	}
+}
+
+// Check whether two domain names are equal, ignoring the case and the trailing dot.
+func sameName(a string, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+// Format the records other than the IP addresses as a single line. Returns an empty string if there are none.
+func formatRecords(record FullDNSRecord) string {
+	var parts []string
+	if record.CNAME != "" {
+		parts = append(parts, "CNAME: "+record.CNAME)
+	}
+	if len(record.MX) > 0 {
+		parts = append(parts, "MX: "+strings.Join(record.MX, ", "))
+	}
+	if len(record.NS) > 0 {
+		parts = append(parts, "NS: "+strings.Join(record.NS, ", "))
+	}
+	if len(record.TXT) > 0 {
+		parts = append(parts, fmt.Sprintf("TXT: %d record(s)", len(record.TXT)))
+	}
+	if len(record.CAA) > 0 {
+		parts = append(parts, "CAA: "+strings.Join(record.CAA, ", "))
+	}
+	if record.SOA != nil {
+		parts = append(parts, fmt.Sprintf("SOA: %s %s %d", record.SOA.PrimaryNS, record.SOA.AdminEmail,
+			record.SOA.Serial))
+	}
+	return strings.Join(parts, "; ")
+}
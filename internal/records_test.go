@@ -0,0 +1,42 @@
+package internal
+
+import (
+	"context"
+	"testing"
+)
+
+// recordsFakeResolver struct used to answer the record lookups with fixed records.
+type recordsFakeResolver struct {
+	fakeResolver
+	records FullDNSRecord
+}
+
+func (r *recordsFakeResolver) LookupRecords(context.Context, string) FullDNSRecord {
+	return r.records
+}
+
+func TestChainLookupRecordsTriesNextResolver(t *testing.T) {
+	failing := &recordsFakeResolver{fakeResolver: fakeResolver{name: "failing"}}
+	answering := &recordsFakeResolver{fakeResolver: fakeResolver{name: "answering"},
+		records: FullDNSRecord{MX: []string{"10 mail.example.com"}}}
+	unused := &recordsFakeResolver{fakeResolver: fakeResolver{name: "unused"},
+		records: FullDNSRecord{MX: []string{"20 other.example.com"}}}
+	chain := &chainResolver{resolvers: []Resolver{failing, answering, unused}}
+	records := chain.LookupRecords(context.Background(), "example.com")
+	if len(records.MX) != 1 || records.MX[0] != "10 mail.example.com" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
+
+func TestFormatRecordsZoneRecords(t *testing.T) {
+	record := FullDNSRecord{
+		NS:  []string{"ns1.example.com"},
+		CAA: []string{`0 issue "letsencrypt.org"`},
+		SOA: &SOARecord{PrimaryNS: "ns1.example.com", AdminEmail: "hostmaster@example.com", Serial: 2024010101},
+	}
+	want := `NS: ns1.example.com; CAA: 0 issue "letsencrypt.org"; ` +
+		`SOA: ns1.example.com hostmaster@example.com 2024010101`
+	if got := formatRecords(record); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
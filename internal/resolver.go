@@ -0,0 +1,210 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Resolver is implemented by every DNS backend used to resolve domain names to IP addresses.
+type Resolver interface {
+	// LookupIP returns the IP addresses to which the host is resolved.
+	LookupIP(ctx context.Context, host string) ([]net.IP, error)
+	// String returns a human-readable name of the backend, used when reporting results.
+	String() string
+}
+
+// Error classes returned by classifyLookupError.
+const (
+	lookupErrNXDomain = "nxdomain"
+	lookupErrServFail = "servfail"
+	lookupErrTimeout  = "timeout"
+	lookupErrOther    = "other"
+)
+
+// systemResolver resolves domain names using the resolver configured by the operating system.
+type systemResolver struct {
+	resolver *net.Resolver
+	// Local IP address the queries sent to nameservers directly are sent from. If nil, the operating system picks it.
+	localIP net.IP
+	// Detector of the answers obtained by appending a search domain. Nil if there are no search domains.
+	search *searchPath
+}
+
+// The system resolver may append the search domains of the system to a name which does not exist and resolve it as
+// "mail.example.com.corp.local". Such answers are rejected. The name cannot simply be made fully qualified, since that
+// would bypass the hosts file.
+func (r systemResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	ips, err := r.resolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	if r.search != nil && r.search.expanded(ctx, host, ips) {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, nil
+}
+
+// searchPath struct used to detect the answers the system resolver obtained by appending a search domain to a name
+// which does not exist. Such answers come from a wildcard record of the search domain, since the expanded names, such
+// as "mail.example.com.corp.local", are not registered otherwise. The addresses of the wildcards are looked up once,
+// and only the answers returning one of them are confirmed with a lookup of the canonical name.
+type searchPath struct {
+	domains     []string
+	lookupIP    func(ctx context.Context, host string) ([]net.IP, error)
+	lookupCNAME func(ctx context.Context, host string) (string, error)
+
+	once sync.Once
+	// Addresses returned for names which do not exist under the search domains.
+	wildcardIPs map[string]bool
+}
+
+// Return a detector of the answers obtained by appending one of the search domains with the resolver, or nil if there
+// are no search domains.
+func newSearchPath(resolver *net.Resolver, domains []string) *searchPath {
+	if len(domains) == 0 {
+		return nil
+	}
+	return &searchPath{
+		domains: domains,
+		lookupIP: func(ctx context.Context, host string) ([]net.IP, error) {
+			return resolver.LookupIP(ctx, "ip", host)
+		},
+		lookupCNAME: resolver.LookupCNAME,
+	}
+}
+
+// Check whether the addresses of the host were obtained by appending one of the search domains to it.
+func (s *searchPath) expanded(ctx context.Context, host string, ips []net.IP) bool {
+	s.once.Do(func() {
+		s.wildcardIPs = make(map[string]bool)
+		for _, domain := range s.domains {
+			probe := fmt.Sprintf("domain-recon-probe-%016x.%s.", rand.Uint64(), domain)
+			if wildcard, err := s.lookupIP(ctx, probe); err == nil {
+				for _, ip := range wildcard {
+					s.wildcardIPs[ip.String()] = true
+				}
+			}
+		}
+	})
+
+	for _, ip := range ips {
+		if s.wildcardIPs[ip.String()] {
+			cname, err := s.lookupCNAME(ctx, host)
+			return err == nil && resolvedViaSearchDomain(host, cname, s.domains)
+		}
+	}
+	return false
+}
+
+func (systemResolver) String() string {
+	return "system"
+}
+
+// serverResolver sends every query to a specific DNS server, bypassing the system configuration.
+type serverResolver struct {
+	address  string
+	resolver *net.Resolver
+	localIP  net.IP
+}
+
+func (r *serverResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	return r.resolver.LookupIP(ctx, "ip", fqdn(host))
+}
+
+func (r *serverResolver) String() string {
+	return r.address
+}
+
+// NewResolver returns a Resolver which queries the DNS server at the given address. The address may omit the port, in
+// which case port 53 is used. If the address is empty, the system resolver is returned. If localIP is set, the queries
+// are sent from that address.
+func NewResolver(address string, localIP net.IP) Resolver {
+	dial := dialFrom(localIP, dialTimeout)
+	if address == "" {
+		if localIP == nil {
+			return systemResolver{resolver: net.DefaultResolver,
+				search: newSearchPath(net.DefaultResolver, systemSearchDomains())}
+		}
+		resolver := &net.Resolver{PreferGo: true, Dial: dial}
+		return systemResolver{resolver: resolver, localIP: localIP,
+			search: newSearchPath(resolver, systemSearchDomains())}
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "53")
+	}
+	return &serverResolver{
+		address: address,
+		localIP: localIP,
+		resolver: &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dial(ctx, network, address)
+			},
+		},
+	}
+}
+
+// Search domains configured in /etc/resolv.conf, read once.
+var systemSearchDomains = sync.OnceValue(func() []string {
+	content, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+
+	var domains []string
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && (fields[0] == "search" || fields[0] == "domain") {
+			for _, domain := range fields[1:] {
+				domains = append(domains, strings.ToLower(strings.TrimSuffix(domain, ".")))
+			}
+		}
+	}
+	return domains
+})
+
+// Check whether the canonical name of a host points under one of the search domains while the host itself is not
+// under it, which means that the resolver answered for the host with a search domain appended.
+func resolvedViaSearchDomain(host string, cname string, searchDomains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	cname = strings.ToLower(strings.TrimSuffix(cname, "."))
+	for _, domain := range searchDomains {
+		if strings.HasSuffix(cname, "."+domain) && host != domain && !strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the host as a fully qualified name by appending the trailing dot. Resolvers never apply the search domains
+// of the system to fully qualified names, so a name which does not exist cannot resolve as a name under a search
+// domain, such as "mail.example.com.corp.local".
+func fqdn(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
+
+// Classify a DNS lookup error into a short, stable class name which can be used to aggregate failures.
+func classifyLookupError(err error) string {
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) {
+		return lookupErrOther
+	}
+	switch {
+	case dnsErr.IsNotFound:
+		return lookupErrNXDomain
+	case dnsErr.IsTimeout:
+		return lookupErrTimeout
+	case dnsErr.Err == "server misbehaving":
+		return lookupErrServFail
+	}
+	return lookupErrOther
+}
@@ -0,0 +1,134 @@
+package internal
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeResolver struct used to answer lookups from a table, counting the lookups of each name. Names missing from the
+// table do not exist.
+type fakeResolver struct {
+	name    string
+	answers map[string][]net.IP
+	// Error returned for every lookup if set, such as a refused query, and errors returned for some names.
+	err    error
+	errors map[string]error
+
+	mu      sync.Mutex
+	lookups map[string]int
+}
+
+func (r *fakeResolver) LookupIP(_ context.Context, host string) ([]net.IP, error) {
+	r.mu.Lock()
+	if r.lookups == nil {
+		r.lookups = make(map[string]int)
+	}
+	r.lookups[host]++
+	r.mu.Unlock()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if err := r.errors[host]; err != nil {
+		return nil, err
+	}
+	if ips, ok := r.answers[host]; ok {
+		return ips, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *fakeResolver) String() string {
+	return r.name
+}
+
+// Return the number of lookups of the name.
+func (r *fakeResolver) count(host string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lookups[host]
+}
+
+// Return a search path over the fake resolver, whose canonical names are taken from the table, and the counter of
+// the canonical name lookups. Names missing from the table are their own canonical name.
+func newTestSearchPath(resolver *fakeResolver, cnames map[string]string, domains ...string) (*searchPath,
+	*atomic.Int32) {
+	var lookups atomic.Int32
+	return &searchPath{
+		domains:  domains,
+		lookupIP: resolver.LookupIP,
+		lookupCNAME: func(_ context.Context, host string) (string, error) {
+			lookups.Add(1)
+			if cname, ok := cnames[host]; ok {
+				return cname, nil
+			}
+			return host + ".", nil
+		},
+	}, &lookups
+}
+
+func TestSearchPathRejectsExpandedNames(t *testing.T) {
+	wildcard := net.IPv4(10, 0, 0, 80)
+	resolver := &fakeResolver{answers: map[string][]net.IP{}}
+	search, lookups := newTestSearchPath(resolver,
+		map[string]string{"mail.example.com": "mail.example.com.corp.local."}, "corp.local")
+	search.lookupIP = func(ctx context.Context, host string) ([]net.IP, error) {
+		if strings.HasSuffix(host, ".corp.local.") {
+			return []net.IP{wildcard}, nil
+		}
+		return resolver.LookupIP(ctx, host)
+	}
+
+	tests := []struct {
+		host     string
+		ips      []net.IP
+		expanded bool
+	}{
+		// Answered by the wildcard of the search domain.
+		{host: "mail.example.com", ips: []net.IP{wildcard}, expanded: true},
+		// Names below the search domain are answered by its wildcard legitimately.
+		{host: "intranet.corp.local", ips: []net.IP{wildcard}},
+		// Answers other than the wildcard address are not checked.
+		{host: "www.example.com", ips: []net.IP{net.IPv4(93, 184, 216, 34)}},
+	}
+	for _, test := range tests {
+		if got := search.expanded(context.Background(), test.host, test.ips); got != test.expanded {
+			t.Errorf("%s: expanded = %t, want %t", test.host, got, test.expanded)
+		}
+	}
+	if got := lookups.Load(); got != 2 {
+		t.Errorf("%d canonical name lookups, want 2 for the answers matching the wildcard", got)
+	}
+}
+
+func TestSearchPathWithoutWildcard(t *testing.T) {
+	resolver := &fakeResolver{answers: map[string][]net.IP{"www.example.com": {net.IPv4(93, 184, 216, 34)}}}
+	search, lookups := newTestSearchPath(resolver, nil, "corp.local", "example.org")
+	for i := 0; i < 10; i++ {
+		if search.expanded(context.Background(), "www.example.com", []net.IP{net.IPv4(93, 184, 216, 34)}) {
+			t.Fatal("answer rejected without a wildcard search domain")
+		}
+	}
+	if got := lookups.Load(); got != 0 {
+		t.Errorf("%d canonical name lookups, want none", got)
+	}
+	// The search domains are probed once, each with a random name.
+	probes := 0
+	for host, count := range resolver.lookups {
+		if strings.HasPrefix(host, "domain-recon-probe-") {
+			probes += count
+		}
+	}
+	if probes != 2 {
+		t.Errorf("%d probes of the search domains, want 2", probes)
+	}
+}
+
+func TestSystemResolverWithoutSearchDomains(t *testing.T) {
+	if newSearchPath(net.DefaultResolver, nil) != nil {
+		t.Error("expected no search path without search domains")
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// Version and schema of the SARIF reports.
+const (
+	sarifVersion  = "2.1.0"
+	sarifSchema   = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifToolName = "domain-recon"
+	sarifToolURI  = "https://github.com/Ernyoke/domain-recon"
+)
+
+// sarifRule struct used to describe a kind of finding and the tag of the results it applies to.
+type sarifRule struct {
+	ID               string         `json:"id"`
+	Name             string         `json:"name"`
+	ShortDescription sarifMessage   `json:"shortDescription"`
+	DefaultConfig    sarifRuleLevel `json:"defaultConfiguration"`
+	// Tag of the results reported under the rule. Empty for the rule every resolved domain is reported under.
+	tag string
+}
+
+// sarifRuleLevel struct used to hold the default level of a rule.
+type sarifRuleLevel struct {
+	Level string `json:"level"`
+}
+
+// sarifMessage struct used to hold a plain text message.
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+// Rules of the findings, in the order they are checked for each result.
+var sarifRules = []sarifRule{
+	{ID: "DOMAIN-DISCOVERED", Name: "DomainDiscovered", tag: "",
+		ShortDescription: sarifMessage{"Resolvable domain discovered for the target"},
+		DefaultConfig:    sarifRuleLevel{"note"}},
+	{ID: "SNI-MISMATCH", Name: "SNIMismatch", tag: TagSNIMismatch,
+		ShortDescription: sarifMessage{"Certificate served over TLS does not cover the domain"},
+		DefaultConfig:    sarifRuleLevel{"warning"}},
+	{ID: "HTTP-ONLY", Name: "HTTPOnly", tag: TagHTTP,
+		ShortDescription: sarifMessage{"Port 80 is open but no TLS server answers on port 443"},
+		DefaultConfig:    sarifRuleLevel{"warning"}},
+	{ID: "PRIVATE-IP", Name: "PrivateIP", tag: TagPrivate,
+		ShortDescription: sarifMessage{"Public DNS name resolves only to private or loopback addresses"},
+		DefaultConfig:    sarifRuleLevel{"warning"}},
+	{ID: "SINKHOLED", Name: "Sinkholed", tag: TagSinkholed,
+		ShortDescription: sarifMessage{"Domain resolves to a known sinkhole"},
+		DefaultConfig:    sarifRuleLevel{"note"}},
+	{ID: "PARKED", Name: "Parked", tag: TagParked,
+		ShortDescription: sarifMessage{"Domain resolves to a parking service"},
+		DefaultConfig:    sarifRuleLevel{"note"}},
+	{ID: "HOMOGRAPH", Name: "Homograph", tag: TagHomograph,
+		ShortDescription: sarifMessage{"Internationalized name mixing scripts or looking like a discovered domain"},
+		DefaultConfig:    sarifRuleLevel{"warning"}},
+	{ID: "TYPOSQUAT", Name: "Typosquat", tag: TagTyposquat,
+		ShortDescription: sarifMessage{"Resolvable name one typo away from a discovered subdomain"},
+		DefaultConfig:    sarifRuleLevel{"warning"}},
+}
+
+// sarifLog struct used as the root object of a SARIF report.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+// sarifRun struct used to hold the results of a single run of the tool.
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+// sarifTool struct used to describe the tool and the rules of its findings.
+type sarifTool struct {
+	Driver struct {
+		Name           string      `json:"name"`
+		InformationURI string      `json:"informationUri"`
+		Rules          []sarifRule `json:"rules"`
+	} `json:"driver"`
+}
+
+// sarifResult struct used to hold a single finding.
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+// sarifLocation struct used to point a finding at the domain it is about.
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+// sarifLogicalLocation struct used to name the domain of a finding.
+type sarifLogicalLocation struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+}
+
+// Write the report as a SARIF 2.1.0 log. Every resolved domain is a result of the DOMAIN-DISCOVERED rule, and each
+// tag with a rule of its own adds a result of that rule.
+func writeSARIF(w io.Writer, target string, report Report) error {
+	run := sarifRun{Results: []sarifResult{}}
+	run.Tool.Driver.Name = sarifToolName
+	run.Tool.Driver.InformationURI = sarifToolURI
+	run.Tool.Driver.Rules = sarifRules
+
+	for _, results := range report.results() {
+		for _, result := range results {
+			for i, rule := range sarifRules {
+				if rule.tag != "" && !result.HasTag(rule.tag) {
+					continue
+				}
+				run.Results = append(run.Results, newSARIFResult(target, result, i, rule))
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{Version: sarifVersion, Schema: sarifSchema, Runs: []sarifRun{run}})
+}
+
+// Return the result of a rule for a resolved domain. The fingerprint depends only on the target, the rule and the
+// domain, so platforms recognize the same finding across runs.
+func newSARIFResult(target string, result DNSLookupResult, index int, rule sarifRule) sarifResult {
+	text := rule.ShortDescription.Text + ": " + result.Domain
+	if len(result.Ips) > 0 {
+		text += " (" + fieldValue(result, "ips") + ")"
+	}
+	location := sarifLocation{
+		LogicalLocations: []sarifLogicalLocation{{Name: result.Domain, Kind: "resource"}},
+	}
+	location.PhysicalLocation.ArtifactLocation.URI = result.Domain
+	fingerprint := sha256.Sum256([]byte(target + "\n" + rule.ID + "\n" + strings.ToLower(result.Domain)))
+	return sarifResult{
+		RuleID:    rule.ID,
+		RuleIndex: index,
+		Level:     rule.DefaultConfig.Level,
+		Message:   sarifMessage{text},
+		Locations: []sarifLocation{location},
+		PartialFingerprints: map[string]string{
+			"domainFinding/v1": hex.EncodeToString(fingerprint[:]),
+		},
+	}
+}
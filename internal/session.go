@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Name of the archive entry holding the metadata of a recorded session.
+const sessionMetaEntry = "session.json"
+
+// sessionMeta struct used to store the metadata of a recorded session.
+type sessionMeta struct {
+	StartedAt time.Time `json:"started_at"`
+}
+
+// sessionHTTPEntry struct used to store a recorded HTTP response.
+type sessionHTTPEntry struct {
+	Key    string      `json:"key"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// sessionDNSEntry struct used to store a recorded DNS answer. Either the addresses or the records are set, depending on
+// the kind of lookup in the key.
+type sessionDNSEntry struct {
+	Key     string         `json:"key"`
+	Ips     []net.IP       `json:"ips,omitempty"`
+	Records *FullDNSRecord `json:"records,omitempty"`
+	// Class and message of the error of a failed lookup.
+	ErrorClass string `json:"error_class,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// session struct used to hold the HTTP responses and DNS answers of a run, recorded or loaded for replay.
+type session struct {
+	mu     sync.Mutex
+	meta   sessionMeta
+	http   map[string]sessionHTTPEntry
+	dns    map[string]sessionDNSEntry
+	replay bool
+	// Keys requested during replay which are not in the archive.
+	misses []string
+}
+
+// Create an empty session to record a run starting at the time.
+func newRecordSession(startedAt time.Time) *session {
+	return &session{meta: sessionMeta{StartedAt: startedAt}, http: map[string]sessionHTTPEntry{},
+		dns: map[string]sessionDNSEntry{}}
+}
+
+// Load a recorded session from a tar archive for replay.
+func loadSession(archivePath string) (*session, error) {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &session{http: map[string]sessionHTTPEntry{}, dns: map[string]sessionDNSEntry{}, replay: true}
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", archivePath, err)
+		}
+		decoder := json.NewDecoder(reader)
+		switch {
+		case header.Name == sessionMetaEntry:
+			err = decoder.Decode(&s.meta)
+		case strings.HasPrefix(header.Name, "http/"):
+			var entry sessionHTTPEntry
+			if err = decoder.Decode(&entry); err == nil {
+				s.http[entry.Key] = entry
+			}
+		case strings.HasPrefix(header.Name, "dns/"):
+			var entry sessionDNSEntry
+			if err = decoder.Decode(&entry); err == nil {
+				s.dns[entry.Key] = entry
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", archivePath, header.Name, err)
+		}
+	}
+	if s.meta.StartedAt.IsZero() {
+		return nil, fmt.Errorf("%s: not a recorded session, %s is missing", archivePath, sessionMetaEntry)
+	}
+	return s, nil
+}
+
+// Write the recorded session to a tar archive. Entries are named after the hash of their key and sorted, so recording
+// the same answers gives the same archive.
+func (s *session) save(archivePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := map[string]any{sessionMetaEntry: s.meta}
+	for key, entry := range s.http {
+		entries[path.Join("http", sessionEntryName(key))] = entry
+	}
+	for key, entry := range s.dns {
+		entries[path.Join("dns", sessionEntryName(key))] = entry
+	}
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, name := range names {
+		content, err := json.MarshalIndent(entries[name], "", "  ")
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: s.meta.StartedAt}
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := writer.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(archivePath, buf.Bytes(), 0o644)
+}
+
+// Return the name of the archive entry of a key.
+func sessionEntryName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16]) + ".json"
+}
+
+// Remember a key missing from the archive.
+func (s *session) miss(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.misses = append(s.misses, key)
+}
+
+// Return an error naming the first key which was missing from the archive during replay, if any.
+func (s *session) err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.misses) == 0 {
+		return nil
+	}
+	return fmt.Errorf("replay: %q was not recorded (%d missing in total)", s.misses[0], len(s.misses))
+}
+
+// Return a client recording the responses of the client, or serving them from the session when replaying.
+func (s *session) wrapClient(client *http.Client) *http.Client {
+	wrapped := *client
+	wrapped.Transport = &sessionTransport{session: s, next: client.Transport}
+	return &wrapped
+}
+
+// sessionTransport struct used to record or replay HTTP responses.
+type sessionTransport struct {
+	session *session
+	next    http.RoundTripper
+}
+
+func (t *sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Only the method and URL identify a request, the credentials in the headers are never stored.
+	key := req.Method + " " + req.URL.String()
+	s := t.session
+	if s.replay {
+		s.mu.Lock()
+		entry, ok := s.http[key]
+		s.mu.Unlock()
+		if !ok {
+			s.miss(key)
+			return nil, fmt.Errorf("replay: no recorded response for %q", key)
+		}
+		return &http.Response{Status: fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status)),
+			StatusCode: entry.Status, Header: entry.Header, Body: io.NopCloser(bytes.NewReader(entry.Body)),
+			ContentLength: int64(len(entry.Body)), Request: req, Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1}, nil
+	}
+
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	s.mu.Lock()
+	s.http[key] = sessionHTTPEntry{Key: key, Status: resp.StatusCode, Header: resp.Header, Body: body}
+	s.mu.Unlock()
+	return resp, nil
+}
+
+// sessionResolver struct used to record the answers of a resolver, or to serve them from the session when replaying.
+type sessionResolver struct {
+	session *session
+	// Resolver whose answers are recorded. Nil when replaying.
+	next Resolver
+}
+
+func (r *sessionResolver) LookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	key := "ip " + strings.ToLower(host)
+	if r.session.replay {
+		entry, err := r.replayed(key)
+		if err != nil {
+			return nil, err
+		}
+		return entry.Ips, entryError(entry, host)
+	}
+
+	ips, err := r.next.LookupIP(ctx, host)
+	entry := sessionDNSEntry{Key: key, Ips: ips}
+	if err != nil {
+		entry.ErrorClass, entry.Error = classifyLookupError(err), err.Error()
+	}
+	r.record(entry)
+	return ips, err
+}
+
+func (r *sessionResolver) String() string {
+	if r.session.replay {
+		return "replay"
+	}
+	return r.next.String()
+}
+
+func (r *sessionResolver) LookupRecords(ctx context.Context, host string) FullDNSRecord {
+	key := "records " + strings.ToLower(host)
+	if r.session.replay {
+		if entry, err := r.replayed(key); err == nil && entry.Records != nil {
+			return *entry.Records
+		}
+		return FullDNSRecord{}
+	}
+
+	records := lookupRecordsWith(ctx, r.next, host)
+	r.record(sessionDNSEntry{Key: key, Records: &records})
+	return records
+}
+
+// Return the recorded answer of the key, or an error naming the key if there is none.
+func (r *sessionResolver) replayed(key string) (sessionDNSEntry, error) {
+	r.session.mu.Lock()
+	entry, ok := r.session.dns[key]
+	r.session.mu.Unlock()
+	if !ok {
+		r.session.miss(key)
+		return entry, fmt.Errorf("replay: no recorded answer for %q", key)
+	}
+	return entry, nil
+}
+
+// Store an answer in the session.
+func (r *sessionResolver) record(entry sessionDNSEntry) {
+	r.session.mu.Lock()
+	defer r.session.mu.Unlock()
+	r.session.dns[entry.Key] = entry
+}
+
+// Recreate the error of a recorded failed lookup, so it is classified as the original one.
+func entryError(entry sessionDNSEntry, host string) error {
+	switch entry.ErrorClass {
+	case "":
+		return nil
+	case lookupErrNXDomain:
+		return &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	case lookupErrTimeout:
+		return &net.DNSError{Err: "i/o timeout", Name: host, IsTimeout: true}
+	case lookupErrServFail:
+		return &net.DNSError{Err: "server misbehaving", Name: host}
+	}
+	return errors.New(entry.Error)
+}
@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// bogusRange struct used to associate a range of IP addresses with the tag of the names resolving into it, either
+// TagSinkholed or TagParked.
+type bogusRange struct {
+	network *net.IPNet
+	class   string
+}
+
+// Ranges recognized without a --bogus-ips file, in the same format as the file: a CIDR range followed by its class.
+var defaultBogusRanges = []string{
+	"0.0.0.0/8 sinkholed",
+	"127.0.0.0/8 sinkholed",
+	"::/128 sinkholed",
+	"::1/128 sinkholed",
+	// Discard-only prefix (RFC 6666).
+	"100::/64 sinkholed",
+	// Parking services of Sedo and Bodis.
+	"91.195.240.0/23 parked",
+	"199.59.240.0/22 parked",
+}
+
+// ipClassifier struct used to tag results whose every IP address falls into a bogus range.
+type ipClassifier struct {
+	ranges []bogusRange
+}
+
+// Return a classifier knowing the default ranges and, if path is set, the ranges listed in that file. Each line of the
+// file holds a CIDR range or a single IP address, optionally followed by the class, "sinkholed" (the default) or
+// "parked".
+// Blank lines and lines starting with "#" are skipped.
+func newIPClassifier(path string) (*ipClassifier, error) {
+	lines := append([]string{}, defaultBogusRanges...)
+	if path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	classifier := &ipClassifier{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		network, err := parseNetwork(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		class := TagSinkholed
+		if len(fields) > 1 {
+			class = fields[1]
+		}
+		if class != TagSinkholed && class != TagParked {
+			return nil, fmt.Errorf("%s: unknown class %q, expected %s or %s", path, class, TagSinkholed, TagParked)
+		}
+		classifier.ranges = append(classifier.ranges, bogusRange{network: network, class: class})
+	}
+	return classifier, nil
+}
+
+// Parse a CIDR range, or a single IP address as a range containing only that address.
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// Return the class of the IP address, or an empty string if it is not in a bogus range.
+func (c *ipClassifier) classifyIP(ip net.IP) string {
+	for _, r := range c.ranges {
+		if r.network.Contains(ip) {
+			return r.class
+		}
+	}
+	return ""
+}
+
+// Return the class of a resolution. A name is classified only if all its addresses are in bogus ranges, so a real
+// asset is never hidden because of one stray address. If the addresses have different classes, the class of the
+// first address is returned.
+func (c *ipClassifier) classify(ips []net.IP) string {
+	var class string
+	for i, ip := range ips {
+		ipClass := c.classifyIP(ip)
+		if ipClass == "" {
+			return ""
+		}
+		if i == 0 {
+			class = ipClass
+		}
+	}
+	return class
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+)
+
+// Results of the SNI check.
+const (
+	// The certificate served for the domain name covers it.
+	SNIMatch = "match"
+	// The certificate served for the domain name does not cover it, so the host is likely a shared virtual host.
+	SNIMismatch = "mismatch"
+)
+
+// Timeout of the connection and of the TLS handshake done by the SNI check.
+const sniTimeout = 5 * time.Second
+
+// Connect to port 443 of the IP address from the source IP address, send the domain name as SNI and check whether the
+// returned certificate covers the domain. Returns an empty string if there is no TLS server listening on the port.
+func checkSNI(ctx context.Context, domain string, ip net.IP, sourceIP net.IP) string {
+	ctx, cancel := context.WithTimeout(ctx, sniTimeout)
+	defer cancel()
+
+	rawConn, err := dialFrom(sourceIP, sniTimeout)(ctx, "tcp", net.JoinHostPort(ip.String(), "443"))
+	if err != nil {
+		return ""
+	}
+	conn := tls.Client(rawConn, &tls.Config{
+		ServerName: domain,
+		// Only the domain name matters here, it is verified below. The chain may be self-signed or expired.
+		InsecureSkipVerify: true,
+	})
+	defer conn.Close()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return ""
+	}
+
+	certificates := conn.ConnectionState().PeerCertificates
+	if len(certificates) == 0 {
+		return ""
+	}
+	if certificates[0].VerifyHostname(domain) != nil {
+		return SNIMismatch
+	}
+	return SNIMatch
+}
+
+// Check whether port 80 of the IP address accepts TCP connections from the source IP address.
+func checkHTTPPort(ctx context.Context, ip net.IP, sourceIP net.IP) bool {
+	ctx, cancel := context.WithTimeout(ctx, sniTimeout)
+	defer cancel()
+
+	conn, err := dialFrom(sourceIP, sniTimeout)(ctx, "tcp", net.JoinHostPort(ip.String(), "80"))
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
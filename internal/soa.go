@@ -0,0 +1,408 @@
+package internal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout of the SOA query sent to each nameserver.
+const soaTimeout = 5 * time.Second
+
+// DNS record types and class of the queries sent to nameservers.
+const (
+	dnsTypeSOA   = 6
+	dnsTypeCAA   = 257
+	dnsClassINET = 1
+)
+
+// Flag of the header of a DNS response telling that it was truncated to fit in a UDP datagram.
+const dnsFlagTruncated = 0x02
+
+// Longest label and longest name, in their wire format, a DNS query can carry.
+const (
+	maxDNSLabel = 63
+	maxDNSName  = 255
+)
+
+// nameserverOpts struct used to store the settings of the queries sent directly to nameservers.
+type nameserverOpts struct {
+	// Resolver looking up the addresses of the nameservers.
+	resolver Resolver
+	// Local IP address the queries are sent from. If nil, the operating system picks it.
+	localIP net.IP
+	// Port the nameservers are queried on. If empty, port 53 is used.
+	port string
+}
+
+// Return the address of the nameserver IP to send the queries to.
+func (opts nameserverOpts) address(ip net.IP) string {
+	port := opts.port
+	if port == "" {
+		port = "53"
+	}
+	return net.JoinHostPort(ip.String(), port)
+}
+
+// SOARecord struct used to store the SOA record of a zone as served by one of its nameservers.
+type SOARecord struct {
+	Zone       string `json:"zone"`
+	Nameserver string `json:"nameserver"`
+	PrimaryNS  string `json:"primary_ns,omitempty"`
+	AdminEmail string `json:"admin_email,omitempty"`
+	Serial     uint32 `json:"serial,omitempty"`
+	// Refresh, retry and expire intervals of the zone, and the TTL of negative answers, in seconds.
+	Refresh uint32 `json:"refresh,omitempty"`
+	Retry   uint32 `json:"retry,omitempty"`
+	Expire  uint32 `json:"expire,omitempty"`
+	Minimum uint32 `json:"minimum,omitempty"`
+	// Reason the nameserver did not return the record, if it did not.
+	Error string `json:"error,omitempty"`
+}
+
+// Look up the nameservers of the zone with the resolver of the options and ask each of them for the SOA record of the
+// zone. The records are sorted by nameserver.
+func lookupSOA(ctx context.Context, opts nameserverOpts, zone string) []SOARecord {
+	nameservers := lookupRecordsWith(ctx, opts.resolver, zone).NS
+	records := make([]SOARecord, len(nameservers))
+	var wg sync.WaitGroup
+	for i, nameserver := range nameservers {
+		i, nameserver := i, nameserver
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			records[i] = querySOA(ctx, opts, zone, nameserver)
+		}()
+	}
+	wg.Wait()
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Nameserver < records[j].Nameserver
+	})
+	return records
+}
+
+// Ask the nameserver for the SOA record of the zone. The query is sent without recursion, so the record comes from
+// the nameserver's own copy of the zone.
+func querySOA(ctx context.Context, opts nameserverOpts, zone string, nameserver string) SOARecord {
+	record := SOARecord{Zone: zone, Nameserver: nameserver}
+	response, id, err := queryNameserver(ctx, opts, nameserver, zone, dnsTypeSOA)
+	if err == nil {
+		err = parseSOAResponse(response, id, &record)
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	return record
+}
+
+// Ask the nameserver for the CAA records of the name, formatted as "flags tag value".
+func queryCAA(ctx context.Context, opts nameserverOpts, name string, nameserver string) ([]string, error) {
+	response, id, err := queryNameserver(ctx, opts, nameserver, name, dnsTypeCAA)
+	if err != nil {
+		return nil, err
+	}
+	return parseCAAResponse(response, id)
+}
+
+// Resolve the nameserver with the resolver of the options and send it a query for the records of the type of the
+// name. The addresses of the nameserver are tried in turn until one of them answers, and a response truncated to fit
+// in a UDP datagram is asked for again over TCP. Returns the response and the ID of the query it must match.
+func queryNameserver(ctx context.Context, opts nameserverOpts, nameserver string, name string,
+	recordType uint16) ([]byte, uint16, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+	query, err := dnsQuery(id, name, recordType)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ips, err := opts.resolver.LookupIP(ctx, nameserver)
+	if err != nil || len(ips) == 0 {
+		return nil, 0, fmt.Errorf("cannot resolve the nameserver: %v", err)
+	}
+	for _, ip := range ips {
+		address := opts.address(ip)
+		var response []byte
+		response, err = exchangeDNS(ctx, "udp", address, query, opts.localIP)
+		if err == nil && len(response) > 2 && response[2]&dnsFlagTruncated != 0 {
+			response, err = exchangeDNS(ctx, "tcp", address, query, opts.localIP)
+		}
+		if err == nil {
+			return response, id, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, 0, err
+}
+
+// Send the query to the address over the network, udp or tcp, from localIP and return the response. Over UDP,
+// datagrams which do not answer the query, such as late answers to an earlier one, are skipped.
+func exchangeDNS(ctx context.Context, network string, address string, query []byte, localIP net.IP) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, soaTimeout)
+	defer cancel()
+	conn, err := dialFrom(localIP, soaTimeout)(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		// Messages sent over TCP are preceded by their length.
+		message := binary.BigEndian.AppendUint16(make([]byte, 0, len(query)+2), uint16(len(query)))
+		if _, err = conn.Write(append(message, query...)); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err = io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		response := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err = io.ReadFull(conn, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	if _, err = conn.Write(query); err != nil {
+		return nil, err
+	}
+	response := make([]byte, 4096)
+	for {
+		n, err := conn.Read(response)
+		if err != nil {
+			return nil, err
+		}
+		if n >= 2 && binary.BigEndian.Uint16(response) == binary.BigEndian.Uint16(query) {
+			return response[:n], nil
+		}
+	}
+}
+
+// Build a DNS query message asking for the records of the type of the name, with recursion not desired. Fails for
+// names with an empty label or a label longer than maxDNSLabel bytes, and for names longer than maxDNSName bytes once
+// encoded, which no nameserver would accept.
+func dnsQuery(id uint16, name string, recordType uint16) ([]byte, error) {
+	message := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(message[0:], id)
+	// One question, no answer, authority or additional records.
+	binary.BigEndian.PutUint16(message[4:], 1)
+	// The root zone has no labels.
+	if trimmed := strings.TrimSuffix(name, "."); trimmed != "" {
+		for _, label := range strings.Split(trimmed, ".") {
+			if len(label) == 0 || len(label) > maxDNSLabel {
+				return nil, fmt.Errorf("invalid name '%s': each label must have 1 to %d bytes", name, maxDNSLabel)
+			}
+			message = append(message, byte(len(label)))
+			message = append(message, label...)
+		}
+	}
+	message = append(message, 0)
+	if length := len(message) - 12; length > maxDNSName {
+		return nil, fmt.Errorf("invalid name '%s': %d bytes long once encoded, more than %d", name, length,
+			maxDNSName)
+	}
+	message = binary.BigEndian.AppendUint16(message, recordType)
+	return binary.BigEndian.AppendUint16(message, dnsClassINET), nil
+}
+
+// Errors of malformed DNS responses.
+var errShortDNSMessage = errors.New("truncated DNS response")
+
+// dnsAnswer struct used to locate a record of the answer section of a DNS response.
+type dnsAnswer struct {
+	recordType uint16
+	// Offset and length of the data of the record in the message.
+	data   int
+	length int
+}
+
+// Check the header of the response and return the records of its answer section.
+func parseDNSAnswers(message []byte, id uint16) ([]dnsAnswer, error) {
+	if len(message) < 12 {
+		return nil, errShortDNSMessage
+	}
+	if binary.BigEndian.Uint16(message[0:]) != id {
+		return nil, errors.New("DNS response does not match the query")
+	}
+	if rcode := message[3] & 0x0f; rcode != 0 {
+		return nil, fmt.Errorf("nameserver answered with response code %d", rcode)
+	}
+	questions := int(binary.BigEndian.Uint16(message[4:]))
+	count := int(binary.BigEndian.Uint16(message[6:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		_, next, err := readDNSName(message, offset)
+		if err != nil {
+			return nil, err
+		}
+		offset = next + 4
+	}
+	var answers []dnsAnswer
+	for i := 0; i < count; i++ {
+		_, next, err := readDNSName(message, offset)
+		if err != nil {
+			return nil, err
+		}
+		if next+10 > len(message) {
+			return nil, errShortDNSMessage
+		}
+		answer := dnsAnswer{
+			recordType: binary.BigEndian.Uint16(message[next:]),
+			data:       next + 10,
+			length:     int(binary.BigEndian.Uint16(message[next+8:])),
+		}
+		if answer.data+answer.length > len(message) {
+			return nil, errShortDNSMessage
+		}
+		offset = answer.data + answer.length
+		answers = append(answers, answer)
+	}
+	return answers, nil
+}
+
+// Parse the first SOA record of the answer section of the response into the record.
+func parseSOAResponse(message []byte, id uint16, record *SOARecord) error {
+	answers, err := parseDNSAnswers(message, id)
+	if err != nil {
+		return err
+	}
+	for _, answer := range answers {
+		if answer.recordType != dnsTypeSOA {
+			continue
+		}
+
+		primary, next, err := readDNSName(message, answer.data)
+		if err != nil {
+			return err
+		}
+		admin, next, err := readDNSName(message, next)
+		if err != nil {
+			return err
+		}
+		if next+20 > len(message) {
+			return errShortDNSMessage
+		}
+		field := func(i int) uint32 {
+			return binary.BigEndian.Uint32(message[next+4*i:])
+		}
+		record.PrimaryNS = primary
+		record.AdminEmail = adminEmail(admin)
+		record.Serial, record.Refresh, record.Retry, record.Expire, record.Minimum =
+			field(0), field(1), field(2), field(3), field(4)
+		return nil
+	}
+	return errors.New("nameserver returned no SOA record")
+}
+
+// Parse the CAA records of the answer section of the response, formatted as "flags tag value". Returns no records
+// if the name has none.
+func parseCAAResponse(message []byte, id uint16) ([]string, error) {
+	answers, err := parseDNSAnswers(message, id)
+	if err != nil {
+		return nil, err
+	}
+	var records []string
+	for _, answer := range answers {
+		if answer.recordType != dnsTypeCAA {
+			continue
+		}
+		data := message[answer.data : answer.data+answer.length]
+		if len(data) < 2 || 2+int(data[1]) > len(data) {
+			return nil, errShortDNSMessage
+		}
+		tag, value := data[2:2+int(data[1])], data[2+int(data[1]):]
+		records = append(records, fmt.Sprintf("%d %s %q", data[0], tag, value))
+	}
+	return records, nil
+}
+
+// Read the possibly compressed domain name starting at the offset. Returns the name without the trailing dot and the
+// offset following it.
+func readDNSName(message []byte, offset int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if offset >= len(message) {
+			return "", 0, errShortDNSMessage
+		}
+		length := int(message[offset])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case length&0xc0 == 0xc0:
+			if offset+1 >= len(message) {
+				return "", 0, errShortDNSMessage
+			}
+			// Pointers only go backwards in valid messages, the limit guards against loops in invalid ones.
+			if jumps++; jumps > 64 {
+				return "", 0, errors.New("too many compression pointers in DNS response")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(message[offset:]) & 0x3fff)
+		default:
+			if offset+1+length > len(message) {
+				return "", 0, errShortDNSMessage
+			}
+			label := string(message[offset+1 : offset+1+length])
+			labels = append(labels, strings.ReplaceAll(label, ".", `\.`))
+			offset += 1 + length
+		}
+	}
+}
+
+// Convert the mailbox of a SOA record, such as hostmaster.example.com, to an email address. The first label is the
+// local part, dots escaped in it are kept.
+func adminEmail(mailbox string) string {
+	for i := 0; i < len(mailbox); i++ {
+		switch mailbox[i] {
+		case '\\':
+			i++
+		case '.':
+			return strings.ReplaceAll(mailbox[:i], `\.`, ".") + "@" + mailbox[i+1:]
+		}
+	}
+	return mailbox
+}
+
+// Format the SOA record of a nameserver as a single line.
+func formatSOA(record SOARecord) string {
+	if record.Error != "" {
+		return fmt.Sprintf("%s - %s", record.Nameserver, record.Error)
+	}
+	return fmt.Sprintf("%s - Primary NS: %s, Admin email: %s, Serial: %d, Refresh: %ds", record.Nameserver,
+		record.PrimaryNS, record.AdminEmail, record.Serial, record.Refresh)
+}
+
+// Check whether the nameservers which answered disagree on the serial of the zone, which happens while a zone update
+// is propagating or when a secondary has stopped transferring it.
+func serialsDiffer(records []SOARecord) bool {
+	serials := make(map[uint32]bool)
+	for _, record := range records {
+		if record.Error == "" {
+			serials[record.Serial] = true
+		}
+	}
+	return len(serials) > 1
+}
@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testAnswer struct used to describe a record of the answer section of a test DNS response.
+type testAnswer struct {
+	recordType uint16
+	data       []byte
+}
+
+// Return the response to the query for the records of the type of the name, with the answers. Their names point to
+// the name of the question.
+func testDNSResponse(id uint16, name string, recordType uint16, answers ...testAnswer) []byte {
+	message, _ := dnsQuery(id, name, recordType)
+	message[2] |= 0x80
+	binary.BigEndian.PutUint16(message[6:], uint16(len(answers)))
+	for _, answer := range answers {
+		message = append(message, 0xc0, 12)
+		message = binary.BigEndian.AppendUint16(message, answer.recordType)
+		message = binary.BigEndian.AppendUint16(message, dnsClassINET)
+		message = binary.BigEndian.AppendUint32(message, 300)
+		message = binary.BigEndian.AppendUint16(message, uint16(len(answer.data)))
+		message = append(message, answer.data...)
+	}
+	return message
+}
+
+// Return the data of a CAA record.
+func caaData(flags byte, tag string, value string) []byte {
+	return append(append([]byte{flags, byte(len(tag))}, tag...), value...)
+}
+
+func TestParseCAAResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		answers []testAnswer
+		want    []string
+	}{
+		{name: "none"},
+		{name: "issue", answers: []testAnswer{{dnsTypeCAA, caaData(0, "issue", "letsencrypt.org")}},
+			want: []string{`0 issue "letsencrypt.org"`}},
+		{name: "several", answers: []testAnswer{
+			{dnsTypeCAA, caaData(128, "issuewild", ";")},
+			{dnsTypeCAA, caaData(0, "iodef", "mailto:security@example.com")},
+		}, want: []string{`128 issuewild ";"`, `0 iodef "mailto:security@example.com"`}},
+		{name: "other types skipped", answers: []testAnswer{
+			{5, []byte{0}},
+			{dnsTypeCAA, caaData(0, "issue", "pki.goog")},
+		}, want: []string{`0 issue "pki.goog"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			records, err := parseCAAResponse(testDNSResponse(7, "example.com", dnsTypeCAA, test.answers...), 7)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, test.want) {
+				t.Errorf("got %q, want %q", records, test.want)
+			}
+		})
+	}
+}
+
+func TestParseCAAResponseTruncatedTag(t *testing.T) {
+	message := testDNSResponse(7, "example.com", dnsTypeCAA, testAnswer{dnsTypeCAA, []byte{0, 9, 'i', 's'}})
+	if _, err := parseCAAResponse(message, 7); err != errShortDNSMessage {
+		t.Errorf("got %v, want %v", err, errShortDNSMessage)
+	}
+}
+
+// Return the name in the wire format of DNS messages, without compression.
+func encodeDNSName(labels ...string) []byte {
+	var name []byte
+	for _, label := range labels {
+		name = append(append(name, byte(len(label))), label...)
+	}
+	return append(name, 0)
+}
+
+// Return the data of a SOA record with the serial, whose administrator mailbox consists of the labels.
+func soaData(serial uint32, mailbox ...string) []byte {
+	data := append(encodeDNSName("ns1", "example", "com"), encodeDNSName(mailbox...)...)
+	for _, field := range []uint32{serial, 7200, 3600, 1209600, 300} {
+		data = binary.BigEndian.AppendUint32(data, field)
+	}
+	return data
+}
+
+func TestParseSOAResponse(t *testing.T) {
+	valid := testDNSResponse(7, "example.com", dnsTypeSOA,
+		testAnswer{dnsTypeSOA, soaData(2024010101, "hostmaster", "example", "com")})
+	refused := testDNSResponse(7, "example.com", dnsTypeSOA)
+	refused[3] |= 5
+
+	tests := []struct {
+		name    string
+		message []byte
+		id      uint16
+		want    SOARecord
+		err     string
+	}{
+		{name: "valid", message: valid, id: 7, want: SOARecord{PrimaryNS: "ns1.example.com",
+			AdminEmail: "hostmaster@example.com", Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600,
+			Minimum: 300}},
+		{name: "escaped mailbox", id: 7, message: testDNSResponse(7, "example.com", dnsTypeSOA,
+			testAnswer{dnsTypeSOA, soaData(1, "john.doe", "example", "com")}),
+			want: SOARecord{PrimaryNS: "ns1.example.com", AdminEmail: "john.doe@example.com", Serial: 1, Refresh: 7200,
+				Retry: 3600, Expire: 1209600, Minimum: 300}},
+		{name: "mismatched id", message: valid, id: 8, err: "DNS response does not match the query"},
+		{name: "response code", message: refused, id: 7, err: "nameserver answered with response code 5"},
+		{name: "no answer", message: testDNSResponse(7, "example.com", dnsTypeSOA), id: 7,
+			err: "nameserver returned no SOA record"},
+		{name: "other record types", id: 7, message: testDNSResponse(7, "example.com", dnsTypeSOA,
+			testAnswer{dnsTypeCAA, caaData(0, "issue", "pki.goog")}), err: "nameserver returned no SOA record"},
+		{name: "truncated header", message: valid[:11], id: 7, err: errShortDNSMessage.Error()},
+		{name: "truncated question", message: valid[:20], id: 7, err: errShortDNSMessage.Error()},
+		{name: "truncated answer header", message: valid[:len(testDNSResponse(7, "example.com", dnsTypeSOA))+6], id: 7,
+			err: errShortDNSMessage.Error()},
+		{name: "truncated answer data", message: valid[:len(valid)-1], id: 7, err: errShortDNSMessage.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var record SOARecord
+			err := parseSOAResponse(test.message, test.id, &record)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if record != test.want {
+				t.Errorf("got %+v, want %+v", record, test.want)
+			}
+		})
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	// The name at offset 2 is "www" followed by a pointer to "example.com" at offset 8.
+	compressed := append([]byte{0xff, 0xff, 3, 'w', 'w', 'w', 0xc0, 8}, encodeDNSName("example", "com")...)
+	tests := []struct {
+		name    string
+		message []byte
+		offset  int
+		want    string
+		next    int
+		err     string
+	}{
+		{name: "plain", message: encodeDNSName("example", "com"), want: "example.com", next: 13},
+		{name: "root", message: []byte{0}, want: "", next: 1},
+		{name: "compressed", message: compressed, offset: 2, want: "www.example.com", next: 8},
+		{name: "escaped dot", message: encodeDNSName("john.doe", "example"), want: `john\.doe.example`, next: 18},
+		{name: "offset past the end", message: []byte{0}, offset: 1, err: errShortDNSMessage.Error()},
+		{name: "truncated label", message: []byte{7, 'e', 'x'}, err: errShortDNSMessage.Error()},
+		{name: "missing terminator", message: []byte{3, 'c', 'o', 'm'}, err: errShortDNSMessage.Error()},
+		{name: "truncated pointer", message: []byte{0xc0}, err: errShortDNSMessage.Error()},
+		{name: "pointer loop", message: []byte{0xc0, 0}, err: "too many compression pointers in DNS response"},
+		{name: "pointer cycle", message: []byte{1, 'a', 0xc0, 0}, err: "too many compression pointers in DNS response"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name, next, err := readDNSName(test.message, test.offset)
+			if test.err != "" {
+				if err == nil || err.Error() != test.err {
+					t.Fatalf("got error %v, want %s", err, test.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name != test.want || next != test.next {
+				t.Errorf("got %q, %d, want %q, %d", name, next, test.want, test.next)
+			}
+		})
+	}
+}
+
+func TestDNSQueryValidatesName(t *testing.T) {
+	label := strings.Repeat("a", maxDNSLabel)
+	// Four labels of 63 bytes take 4 * 64 + 1 = 257 bytes once encoded, three of them and one of 61 bytes take 255.
+	longest := strings.Join([]string{label, label, label, label[:61]}, ".")
+	tests := []struct {
+		name string
+		err  string
+	}{
+		{name: "example.com."},
+		{name: "."},
+		{name: label + ".example.com"},
+		{name: longest},
+		{name: label + "a.example.com", err: "each label must have 1 to 63 bytes"},
+		{name: "www..example.com", err: "each label must have 1 to 63 bytes"},
+		{name: longest + "a", err: "256 bytes long once encoded, more than 255"},
+	}
+	for _, test := range tests {
+		message, err := dnsQuery(7, test.name, dnsTypeSOA)
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%q: %v", test.name, err)
+				continue
+			}
+			// The question ends with the name, its type and its class.
+			if name, next, err := readDNSName(message, 12); err != nil || name != strings.TrimSuffix(test.name, ".") ||
+				next != len(message)-4 {
+				t.Errorf("%q: encoded as %q, %d, %v", test.name, name, next, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestAdminEmail(t *testing.T) {
+	tests := map[string]string{
+		"hostmaster.example.com":       "hostmaster@example.com",
+		`john\.doe.example.com`:        "john.doe@example.com",
+		`first\.middle\.last.corp.com`: "first.middle.last@corp.com",
+		"localhost":                    "localhost",
+	}
+	for mailbox, want := range tests {
+		if got := adminEmail(mailbox); got != want {
+			t.Errorf("adminEmail(%q) = %q, want %q", mailbox, got, want)
+		}
+	}
+}
+
+// Start a nameserver on a local port, answering queries over UDP with a datagram of another query and then a
+// truncated response, and over TCP with the SOA record of the zone. Returns the port it listens on.
+func startTruncatingNameserver(t *testing.T) string {
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = tcp.Close() })
+	_, port, _ := net.SplitHostPort(tcp.Addr().String())
+	udp, err := net.ListenPacket("udp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Skip("cannot listen on the UDP port of the TCP listener:", err)
+	}
+	t.Cleanup(func() { _ = udp.Close() })
+
+	go func() {
+		query := make([]byte, 512)
+		for {
+			_, addr, err := udp.ReadFrom(query)
+			if err != nil {
+				return
+			}
+			id := binary.BigEndian.Uint16(query)
+			_, _ = udp.WriteTo(testDNSResponse(id+1, "example.com", dnsTypeSOA), addr)
+			truncated := testDNSResponse(id, "example.com", dnsTypeSOA)
+			truncated[2] |= dnsFlagTruncated
+			_, _ = udp.WriteTo(truncated, addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err == nil {
+					response := testDNSResponse(binary.BigEndian.Uint16(query), "example.com", dnsTypeSOA,
+						testAnswer{dnsTypeSOA, soaData(2024010101, "hostmaster", "example", "com")})
+					_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(response))), response...))
+				}
+			}
+			_ = conn.Close()
+		}
+	}()
+	return port
+}
+
+func TestQuerySOARetriesTruncatedResponsesOverTCP(t *testing.T) {
+	port := startTruncatingNameserver(t)
+	// The first address of the nameserver does not answer, the second one does.
+	resolver := &fakeResolver{answers: map[string][]net.IP{"ns1.example.com": {net.IPv4(127, 0, 0, 2),
+		net.IPv4(127, 0, 0, 1)}}}
+	record := querySOA(context.Background(), nameserverOpts{resolver: resolver, port: port}, "example.com",
+		"ns1.example.com")
+	if record.Error != "" || record.Serial != 2024010101 {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Timeout for establishing the connections to DNS servers.
+const dialTimeout = 5 * time.Second
+
+// Return the local address outgoing traffic is bound to, given either as an IP address or as the name of a network
+// interface whose first address is used. The address must be assigned to this host. If both are empty, nil is
+// returned and the operating system picks the address.
+func sourceAddress(ip string, iface string) (net.IP, error) {
+	switch {
+	case ip != "" && iface != "":
+		return nil, fmt.Errorf("only one of a source IP and an interface can be given")
+	case iface != "":
+		return interfaceAddress(iface)
+	case ip == "":
+		return nil, nil
+	}
+
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid source IP %q", ip)
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(parsed) {
+			return parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("source IP %s is not assigned to any local interface", ip)
+}
+
+// Return the first address of the network interface, preferring IPv4.
+func interfaceAddress(name string) (net.IP, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", name, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	var first net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return ipNet.IP, nil
+		}
+		if first == nil {
+			first = ipNet.IP
+		}
+	}
+	if first == nil {
+		return nil, fmt.Errorf("interface %s has no IP address", name)
+	}
+	return first, nil
+}
+
+// Return a dial function binding every connection to the local IP address. If the address is nil, the operating
+// system picks it.
+func dialFrom(localIP net.IP, timeout time.Duration) func(ctx context.Context, network,
+	address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialer := net.Dialer{Timeout: timeout}
+		if localIP != nil {
+			switch {
+			case strings.HasPrefix(network, "udp"):
+				dialer.LocalAddr = &net.UDPAddr{IP: localIP}
+			case strings.HasPrefix(network, "tcp"):
+				dialer.LocalAddr = &net.TCPAddr{IP: localIP}
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
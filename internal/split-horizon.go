@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ResolverAnswer struct used to store the answer of one of the DNS servers compared for split-horizon detection.
+type ResolverAnswer struct {
+	Resolver string   `json:"resolver"`
+	Ips      []net.IP `json:"ips"`
+	// Error of the lookup, other than the name not existing. Such answers are not compared.
+	Error string `json:"error,omitempty"`
+}
+
+// Query every server for the domain in parallel. Returns the answers in the order of the servers, and whether the
+// servers which answered disagree about the addresses of the domain. A server saying that the name does not exist
+// disagrees with one returning addresses.
+func compareServers(ctx context.Context, servers []Resolver, domain string) ([]ResolverAnswer, bool) {
+	answers := make([]ResolverAnswer, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server Resolver) {
+			defer wg.Done()
+			answers[i].Resolver = server.String()
+			ips, err := server.LookupIP(ctx, domain)
+			if err != nil && classifyLookupError(err) != lookupErrNXDomain {
+				answers[i].Error = classifyLookupError(err)
+				return
+			}
+			answers[i].Ips = ips
+		}(i, server)
+	}
+	wg.Wait()
+
+	var first *string
+	for _, answer := range answers {
+		if answer.Error != "" {
+			continue
+		}
+		key := ipSetKey(answer.Ips)
+		if first == nil {
+			first = &key
+		} else if key != *first {
+			return answers, true
+		}
+	}
+	return answers, false
+}
+
+// Return a key identifying the set of addresses, regardless of their order.
+func ipSetKey(ips []net.IP) string {
+	keys := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		keys = append(keys, ip.String())
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+// Format the answers of the servers as "domain: server->addresses, ...", marking a split horizon.
+func formatSplitHorizon(r DNSLookupResult) string {
+	parts := make([]string, 0, len(r.ResolverAnswers))
+	for _, answer := range r.ResolverAnswers {
+		value := answer.Error
+		if value == "" {
+			value = strings.Join(r.withIPs(answer.Ips).displayIPs(), " ")
+		}
+		if value == "" {
+			value = lookupErrNXDomain
+		}
+		parts = append(parts, answer.Resolver+"->"+value)
+	}
+	line := fmt.Sprintf("%s: %s", r.Domain, strings.Join(parts, ", "))
+	if r.HasTag(TagSplitHorizon) {
+		line += " [SPLIT-HORIZON]"
+	}
+	return line
+}
+
+// Return a copy of the result with other addresses, keeping how they are displayed.
+func (r DNSLookupResult) withIPs(ips []net.IP) DNSLookupResult {
+	r.Ips = ips
+	return r
+}
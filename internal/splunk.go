@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Settings of the batches sent to the Splunk HTTP Event Collector.
+const (
+	splunkSourceType   = "domain_recon"
+	splunkBatchSize    = 100
+	splunkRetries      = 3
+	splunkRetryBackoff = 2 * time.Second
+)
+
+// splunkEvent struct used to wrap a finding in the envelope expected by the HTTP Event Collector.
+type splunkEvent struct {
+	Time       int64           `json:"time"`
+	SourceType string          `json:"sourcetype"`
+	Event      elasticDocument `json:"event"`
+}
+
+// Send every result as an event to the Splunk HTTP Event Collector at flags.SplunkURL, in batches. Failed batches are
+// retried on server errors and summarized in a single warning at the end, so they do not interleave with the results.
+func sendSplunkEvents(flags *Config, httpOpts HTTPOpts, logger *slog.Logger, results ...[]DNSLookupResult) {
+	// Only the proxy and trust settings are shared with the crt.sh client, its credentials must not reach Splunk.
+	client, err := NewHTTPClient(HTTPOpts{
+		TrustStoreFile: httpOpts.TrustStoreFile,
+		CACertFile:     httpOpts.CACertFile,
+		Insecure:       httpOpts.Insecure,
+		SourceIP:       httpOpts.SourceIP,
+		Timeout:        httpOpts.Timeout,
+	})
+	if err != nil {
+		logger.Warn("failed to send findings to Splunk", logKeyError, err)
+		return
+	}
+
+	var events []splunkEvent
+	for _, list := range results {
+		for _, result := range list {
+			events = append(events, splunkEvent{
+				Time:       result.ObservedAt.Unix(),
+				SourceType: splunkSourceType,
+				Event:      elasticDocument{Target: flags.target(), DNSLookupResult: result},
+			})
+		}
+	}
+
+	failed := 0
+	var lastErr error
+	for start := 0; start < len(events); start += splunkBatchSize {
+		batch := events[start:min(start+splunkBatchSize, len(events))]
+		if err := postSplunkBatch(client, flags.SplunkURL, flags.SplunkToken, batch); err != nil {
+			failed += len(batch)
+			lastErr = err
+		}
+	}
+	if failed > 0 {
+		logger.Warn(fmt.Sprintf("failed to send %d of %d findings to Splunk", failed, len(events)),
+			logKeyError, lastErr)
+	}
+}
+
+// Post a batch of events, retrying after server errors. The token is sent only in the Authorization header, never
+// as part of the URL, so it cannot leak into error messages.
+func postSplunkBatch(client *http.Client, baseURL string, token string, batch []splunkEvent) error {
+	var payload bytes.Buffer
+	encoder := json.NewEncoder(&payload)
+	for _, event := range batch {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	u := strings.TrimSuffix(baseURL, "/") + "/services/collector/event"
+	var err error
+	for attempt := 0; attempt <= splunkRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * splunkRetryBackoff)
+		}
+		var req *http.Request
+		if req, err = http.NewRequestWithContext(context.Background(), http.MethodPost, u,
+			bytes.NewReader(payload.Bytes())); err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Splunk "+token)
+		req.Header.Set("Content-Type", "application/json")
+
+		var resp *http.Response
+		if resp, err = client.Do(req); err != nil {
+			continue
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		err = fmt.Errorf("HTTP Event Collector answered %s: %s", resp.Status, bytes.TrimSpace(body))
+		if resp.StatusCode < 500 {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+)
+
+// Prefix lengths of the subnets the addresses are grouped by: a /24 for IPv4, the usual size of an allocation, and a
+// /64 for IPv6, the size of a single network.
+const (
+	subnetPrefixIPv4 = 24
+	subnetPrefixIPv6 = 64
+)
+
+// subnetGroup struct used to store the domains with addresses in a subnet.
+type subnetGroup struct {
+	subnet *net.IPNet
+	// Addresses of each domain within the subnet.
+	domains map[string][]net.IP
+	// Distinct addresses of the subnet.
+	ips map[string]bool
+}
+
+// Return the subnet the address belongs to.
+func subnetOf(ip net.IP) *net.IPNet {
+	if ip4 := ip.To4(); ip4 != nil {
+		mask := net.CIDRMask(subnetPrefixIPv4, 8*net.IPv4len)
+		return &net.IPNet{IP: ip4.Mask(mask), Mask: mask}
+	}
+	mask := net.CIDRMask(subnetPrefixIPv6, 8*net.IPv6len)
+	return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+}
+
+// Group the resolved domains by the subnets of their addresses, IPv4 subnets first, then in address order. A domain
+// with addresses in several subnets is listed in each of them.
+func groupBySubnet(results ...[]DNSLookupResult) []*subnetGroup {
+	groups := make(map[string]*subnetGroup)
+	for _, list := range results {
+		for _, result := range list {
+			for _, ip := range result.Ips {
+				subnet := subnetOf(ip)
+				group, ok := groups[subnet.String()]
+				if !ok {
+					group = &subnetGroup{subnet: subnet, domains: make(map[string][]net.IP), ips: make(map[string]bool)}
+					groups[subnet.String()] = group
+				}
+				if !containsIP(group.domains[result.Domain], ip) {
+					group.domains[result.Domain] = append(group.domains[result.Domain], ip)
+				}
+				group.ips[ip.String()] = true
+			}
+		}
+	}
+
+	sorted := make([]*subnetGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i].subnet.IP, sorted[j].subnet.IP
+		if len(a) != len(b) {
+			return len(a) < len(b)
+		}
+		return bytes.Compare(a, b) < 0
+	})
+	return sorted
+}
+
+// Print the domains grouped by subnet, each subnet under a header in CIDR notation with the number of distinct
+// addresses of the subnet in use, such as "192.0.2.0/24: 3 unique IPs".
+func printSubnetGroups(w io.Writer, results ...[]DNSLookupResult) {
+	for i, group := range groupBySubnet(results...) {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		noun := "IPs"
+		if len(group.ips) == 1 {
+			noun = "IP"
+		}
+		fmt.Fprintf(w, "%s: %d unique %s\n", group.subnet, len(group.ips), noun)
+		domains := make([]string, 0, len(group.domains))
+		for domain := range group.domains {
+			domains = append(domains, domain)
+		}
+		sort.Strings(domains)
+		for _, domain := range domains {
+			ips := make([]string, 0, len(group.domains[domain]))
+			for _, ip := range group.domains[domain] {
+				ips = append(ips, ip.String())
+			}
+			fmt.Fprintf(w, "    %s - IPs: [%s]\n", domain, strings.Join(ips, " "))
+		}
+	}
+}
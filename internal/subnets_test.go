@@ -0,0 +1,30 @@
+package internal
+
+import (
+	"bytes"
+	"net"
+	"testing"
+)
+
+func TestPrintSubnetGroups(t *testing.T) {
+	results := []DNSLookupResult{
+		{Domain: "www.example.com", Ips: []net.IP{net.ParseIP("192.0.2.10"), net.ParseIP("2001:db8::1")}},
+		{Domain: "api.example.com", Ips: []net.IP{net.ParseIP("192.0.2.20"), net.ParseIP("192.0.2.10")}},
+		{Domain: "mail.example.com", Ips: []net.IP{net.ParseIP("198.51.100.7")}},
+	}
+	extended := []DNSLookupResult{{Domain: "dev.example.com", Ips: []net.IP{net.ParseIP("192.0.2.10")}}}
+	var out bytes.Buffer
+	printSubnetGroups(&out, results, extended)
+
+	want := "192.0.2.0/24: 2 unique IPs\n" +
+		"    api.example.com - IPs: [192.0.2.20 192.0.2.10]\n" +
+		"    dev.example.com - IPs: [192.0.2.10]\n" +
+		"    www.example.com - IPs: [192.0.2.10]\n" +
+		"\n198.51.100.0/24: 1 unique IP\n" +
+		"    mail.example.com - IPs: [198.51.100.7]\n" +
+		"\n2001:db8::/64: 1 unique IP\n" +
+		"    www.example.com - IPs: [2001:db8::1]\n"
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
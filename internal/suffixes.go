@@ -0,0 +1,56 @@
+package internal
+
+import "strings"
+
+// Public suffixes of more than one label, under which names are registered by unrelated owners. This is a small
+// excerpt of the Public Suffix List: the second-level domains of the common country code TLDs, and the shared hosting,
+// CDN and cloud platforms whose customers each get their own subdomain. Single-label TLDs are always suffixes. A rule
+// starting with "*." makes every label under the rest of it a suffix, as for the regions of a cloud provider.
+var multiLabelSuffixes = map[string]bool{
+	// Country code second-level domains.
+	"co.uk": true, "org.uk": true, "me.uk": true, "ltd.uk": true, "plc.uk": true, "net.uk": true, "ac.uk": true,
+	"gov.uk": true, "nhs.uk": true, "sch.uk": true,
+	"com.au": true, "net.au": true, "org.au": true, "edu.au": true, "gov.au": true, "id.au": true, "asn.au": true,
+	"co.nz": true, "net.nz": true, "org.nz": true, "govt.nz": true, "ac.nz": true,
+	"co.jp": true, "ne.jp": true, "or.jp": true, "ac.jp": true, "go.jp": true, "gr.jp": true,
+	"co.kr": true, "or.kr": true, "ac.kr": true, "go.kr": true,
+	"com.cn": true, "net.cn": true, "org.cn": true, "gov.cn": true, "edu.cn": true,
+	"com.hk": true, "org.hk": true, "com.tw": true, "org.tw": true, "com.sg": true, "edu.sg": true,
+	"co.in": true, "net.in": true, "org.in": true, "gov.in": true, "ac.in": true, "co.id": true, "or.id": true,
+	"com.my": true, "com.ph": true, "co.th": true, "in.th": true, "com.vn": true, "com.pk": true,
+	"co.za": true, "org.za": true, "gov.za": true, "ac.za": true, "co.ke": true, "com.ng": true, "com.eg": true,
+	"com.br": true, "net.br": true, "org.br": true, "gov.br": true, "com.ar": true, "gob.ar": true,
+	"com.mx": true, "gob.mx": true, "org.mx": true, "com.co": true, "com.pe": true, "gob.pe": true,
+	"com.tr": true, "gov.tr": true, "co.il": true, "org.il": true, "ac.il": true, "com.sa": true, "gov.sa": true,
+	"co.ae": true, "gov.ae": true, "com.ua": true, "gov.ua": true, "com.pl": true, "net.pl": true,
+	// Shared platforms.
+	"cloudfront.net": true, "azurewebsites.net": true, "azureedge.net": true, "cloudapp.net": true,
+	"trafficmanager.net": true, "blob.core.windows.net": true, "azurefd.net": true,
+	"*.amazonaws.com": true, "*.elb.amazonaws.com": true, "*.compute.amazonaws.com": true,
+	"*.elasticbeanstalk.com": true, "awsapps.com": true,
+	"github.io": true, "githubusercontent.com": true, "gitlab.io": true, "herokuapp.com": true, "herokudns.com": true,
+	"appspot.com": true, "firebaseapp.com": true, "web.app": true, "run.app": true, "cloudfunctions.net": true,
+	"netlify.app": true, "vercel.app": true, "now.sh": true, "pages.dev": true, "workers.dev": true,
+	"fastly.net": true, "global.ssl.fastly.net": true, "akamaized.net": true, "edgekey.net": true,
+	"edgesuite.net": true, "blogspot.com": true, "wordpress.com": true, "myshopify.com": true,
+	"zendesk.com": true, "freshdesk.com": true, "readthedocs.io": true, "fly.dev": true, "onrender.com": true,
+}
+
+// Return the registrable domain of the hostname: the public suffix it ends with and the label in front of it, in
+// lowercase. Returns an empty string if the hostname is a public suffix itself.
+func registrableDomain(hostname string) string {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(hostname, ".")), ".")
+	// The longest matching suffix wins, such as us-east-1.elb.amazonaws.com over elb.amazonaws.com.
+	suffix := len(labels) - 1
+	for i := 0; i < len(labels)-1; i++ {
+		parent := strings.Join(labels[i+1:], ".")
+		if multiLabelSuffixes[labels[i]+"."+parent] || multiLabelSuffixes["*."+parent] {
+			suffix = i
+			break
+		}
+	}
+	if suffix == 0 {
+		return ""
+	}
+	return strings.Join(labels[suffix-1:], ".")
+}
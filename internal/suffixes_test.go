@@ -0,0 +1,30 @@
+package internal
+
+import "testing"
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"www.example.com", "example.com"},
+		{"example.com", "example.com"},
+		{"Example.COM.", "example.com"},
+		{"x.host.co.uk", "host.co.uk"},
+		{"co.uk", ""},
+		{"com", ""},
+		{"cdn-1234.somecdn.net", "somecdn.net"},
+		{"d111abcdef8.cloudfront.net", "d111abcdef8.cloudfront.net"},
+		{"cloudfront.net", ""},
+		{"user.github.io", "user.github.io"},
+		{"app.azurewebsites.net", "app.azurewebsites.net"},
+		{"bucket.s3.amazonaws.com", "bucket.s3.amazonaws.com"},
+		{"my-lb-1.us-east-1.elb.amazonaws.com", "my-lb-1.us-east-1.elb.amazonaws.com"},
+		{"us-east-1.elb.amazonaws.com", ""},
+	}
+	for _, test := range tests {
+		if got := registrableDomain(test.hostname); got != test.want {
+			t.Errorf("registrableDomain(%q) = %q, want %q", test.hostname, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Top-level domains tried when looking for names close to a misspelled domain.
+var suggestTLDs = []string{"com", "net", "org", "io"}
+
+// Generate names close to the domain: every single-character deletion and adjacent transposition of its first label,
+// and the same name under a few popular top-level domains.
+func closeMatches(domain string) []string {
+	label, rest, found := strings.Cut(domain, ".")
+	if !found {
+		return nil
+	}
+
+	candidates := make(map[string]bool)
+	for i := range label {
+		if deleted := label[:i] + label[i+1:]; deleted != "" {
+			candidates[deleted+"."+rest] = true
+		}
+		if i+1 < len(label) {
+			swapped := []byte(label)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			candidates[string(swapped)+"."+rest] = true
+		}
+	}
+
+	if tld := rest[strings.LastIndex(rest, ".")+1:]; tld != "" {
+		base := strings.TrimSuffix(domain, tld)
+		for _, other := range suggestTLDs {
+			candidates[base+other] = true
+		}
+	}
+
+	delete(candidates, domain)
+	var names []string
+	for name := range candidates {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Return the names close to the domain which can be resolved to an IP address, sorted alphabetically.
+func suggestDomains(ctx context.Context, resolver Resolver, domain string) []string {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var suggestions []string
+	for _, candidate := range closeMatches(domain) {
+		wg.Add(1)
+		go func(candidate string) {
+			defer wg.Done()
+			if _, err := resolver.LookupIP(ctx, candidate); err == nil {
+				mu.Lock()
+				suggestions = append(suggestions, candidate)
+				mu.Unlock()
+			}
+		}(candidate)
+	}
+	wg.Wait()
+
+	sort.Strings(suggestions)
+	return suggestions
+}
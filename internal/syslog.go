@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Settings of the syslog messages sent for each finding.
+const (
+	syslogAppName = "domain-recon"
+	syslogMsgID   = "finding"
+	// Facility user (1) and severity informational (6).
+	syslogPriority = 1*8 + 6
+	// Length above which a message is truncated, the minimum every receiver must accept (RFC 5424, section 6.1).
+	syslogMaxLength   = 2048
+	syslogTruncated   = "...[truncated]"
+	syslogDialTimeout = 2 * time.Second
+)
+
+// Sockets on which the local syslog daemon usually listens.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Connect to the syslog receiver at the address, given as "tcp://host:port" or "udp://host:port", from the source IP
+// address, or to the local syslog socket if the address is empty.
+func dialSyslog(address string, sourceIP net.IP) (net.Conn, error) {
+	if address == "" {
+		var err error
+		for _, socket := range localSyslogSockets {
+			var conn net.Conn
+			if conn, err = net.DialTimeout("unixgram", socket, syslogDialTimeout); err == nil {
+				return conn, nil
+			}
+		}
+		return nil, fmt.Errorf("no local syslog socket: %w", err)
+	}
+
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "tcp" && u.Scheme != "udp" {
+		return nil, fmt.Errorf("invalid syslog address %q, expected tcp://host:port or udp://host:port", address)
+	}
+	return dialFrom(sourceIP, syslogDialTimeout)(context.Background(), u.Scheme, u.Host)
+}
+
+// Format a finding as an RFC 5424 message whose text consists of key=value pairs.
+func formatSyslogMessage(target string, result DNSLookupResult, hostname string) string {
+	ips := make([]string, 0, len(result.Ips))
+	for _, ip := range result.Ips {
+		ips = append(ips, ip.String())
+	}
+	msg := fmt.Sprintf("domain=%s host=%s ips=%s tags=%s", strconv.Quote(target), result.Domain,
+		strings.Join(ips, ","), strings.Join(result.Tags, ","))
+
+	line := fmt.Sprintf("<%d>1 %s %s %s %d %s - %s", syslogPriority, result.ObservedAt.Format(time.RFC3339),
+		hostname, syslogAppName, os.Getpid(), syslogMsgID, msg)
+	if len(line) > syslogMaxLength {
+		line = line[:syslogMaxLength-len(syslogTruncated)] + syslogTruncated
+	}
+	return line
+}
+
+// Send a syslog message for every result. Problems with the connection are reported in a single warning and stop the
+// sending, without failing the run.
+func sendSyslogMessages(flags *Config, sourceIP net.IP, logger *slog.Logger, results ...[]DNSLookupResult) {
+	conn, err := dialSyslog(flags.SyslogAddr, sourceIP)
+	if err != nil {
+		logger.Warn("failed to send findings to syslog", logKeyError, err)
+		return
+	}
+	defer conn.Close()
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	// Stream transports need framing, octet counting is used (RFC 6587, section 3.4.1).
+	_, stream := conn.(*net.TCPConn)
+
+	for _, list := range results {
+		for _, result := range list {
+			msg := formatSyslogMessage(flags.target(), result, hostname)
+			if stream {
+				msg = fmt.Sprintf("%d %s", len(msg), msg)
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(syslogDialTimeout))
+			if _, err := conn.Write([]byte(msg)); err != nil {
+				logger.Warn("failed to send findings to syslog", logKeyError, err)
+				return
+			}
+		}
+	}
+}
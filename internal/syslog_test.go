@@ -0,0 +1,29 @@
+package internal
+
+import (
+	"net"
+	"testing"
+)
+
+func TestDialSyslogBindsSourceIP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := dialSyslog("tcp://"+listener.Addr().String(), net.IPv4(127, 0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if local := conn.LocalAddr().(*net.TCPAddr).IP; !local.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("connected from %s, want 127.0.0.1", local)
+	}
+
+	// An address which is not assigned to the host cannot be bound.
+	if conn, err := dialSyslog("tcp://"+listener.Addr().String(), net.IPv4(192, 0, 2, 1)); err == nil {
+		conn.Close()
+		t.Error("expected the unassigned source address to be rejected")
+	}
+}
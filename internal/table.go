@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// Columns of the table format, unless other fields are selected.
+var defaultTableFields = []string{"host", "ips", "cname", "tags"}
+
+// Width above which the cells of the table are truncated, unless the table is wide.
+const tableCellWidth = 40
+
+// resultTable struct used to render results as an aligned table. Rows are buffered until the table is flushed, so the
+// columns fit every row. The header is written with the first row, so an empty table is not printed at all.
+type resultTable struct {
+	writer *tabwriter.Writer
+	fields []outputField
+	wide   bool
+	// Whether a header row and a divider line are written above the rows.
+	headers bool
+	rows    int
+}
+
+// Create a table with a column for each field.
+func newResultTable(w io.Writer, fields []outputField, wide bool, headers bool) *resultTable {
+	return &resultTable{writer: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0), fields: fields, wide: wide, headers: headers}
+}
+
+// Add a row with the fields of the result.
+func (t *resultTable) add(r DNSLookupResult) {
+	if t.rows == 0 && t.headers {
+		headers := make([]string, 0, len(t.fields))
+		dividers := make([]string, 0, len(t.fields))
+		for _, field := range t.fields {
+			headers = append(headers, strings.ToUpper(field.name))
+			dividers = append(dividers, strings.Repeat("-", len(field.name)))
+		}
+		fmt.Fprintln(t.writer, strings.Join(headers, "\t"))
+		fmt.Fprintln(t.writer, strings.Join(dividers, "\t"))
+	}
+	t.rows++
+	cells := make([]string, 0, len(t.fields))
+	for _, field := range t.fields {
+		value := field.value(r)
+		if value == "" {
+			value = emptyField
+		}
+		if !t.wide {
+			value = truncateCell(value, tableCellWidth)
+		}
+		cells = append(cells, value)
+	}
+	fmt.Fprintln(t.writer, strings.Join(cells, "\t"))
+}
+
+// Write the buffered rows.
+func (t *resultTable) flush() error {
+	return t.writer.Flush()
+}
+
+// Shorten the value to the width, marking the truncation with an ellipsis.
+func truncateCell(value string, width int) string {
+	if utf8.RuneCountInString(value) <= width {
+		return value
+	}
+	return string([]rune(value)[:width-1]) + "…"
+}
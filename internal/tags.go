@@ -0,0 +1,129 @@
+package internal
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Tags attached to resolved domains by the enrichment steps. Filters accept only these names, so a misspelled tag is
+// reported instead of silently matching nothing.
+const (
+	// The domain resolves only to sinkhole addresses.
+	TagSinkholed = "sinkholed"
+	// The domain resolves only to addresses of parking services.
+	TagParked = "parked"
+	// The domain resolves only to private or loopback addresses.
+	TagPrivate = "private"
+	// A TLS handshake on port 443 succeeds.
+	TagTLS = "tls"
+	// Port 80 accepts TCP connections.
+	TagHTTP = "http"
+	// The certificate served over TLS does not cover the domain.
+	TagSNIMismatch = "sni-mismatch"
+	// The domain was guessed from a wildcard or the wordlist rather than found in a certificate.
+	TagExtended = "extended"
+	// The domain is a typo variant of a discovered subdomain.
+	TagTyposquat = "typosquat"
+	// At least one of the ports given with Config.Ports accepts TCP connections.
+	TagOpenPort = "open-port"
+	// The domain was found as the host of an MX record of a resolved domain.
+	TagMXTarget = "mx-target"
+	// The domain was found as the host of an NS record of a resolved domain.
+	TagNSTarget = "ns-target"
+	// The addresses of the domain come from the hosts file given with Config.HostsFile, not from DNS.
+	TagHostsOverride = "hosts-override"
+	// DNS servers compared with Config.DNSServers return different addresses for the domain.
+	TagSplitHorizon = "split-horizon"
+	// The domain is an internationalized name mixing scripts or looking like one of the ASCII names.
+	TagHomograph = "homograph"
+	// The resolver answered without any address and without an error, even after Config.ResolveRetries retries.
+	TagEmptyAnswer = "empty-answer"
+	// The domain was found in a certificate of an out-of-scope domain a CNAME record points into.
+	TagCNAMEDomain = "cname-domain"
+)
+
+// Every known tag.
+var knownTags = []string{TagSinkholed, TagParked, TagPrivate, TagTLS, TagHTTP, TagSNIMismatch, TagExtended,
+	TagTyposquat, TagMXTarget, TagNSTarget, TagHostsOverride, TagSplitHorizon, TagHomograph, TagEmptyAnswer,
+	TagCNAMEDomain, TagOpenPort}
+
+// HasTag checks whether the result carries the tag.
+func (r DNSLookupResult) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the results with the tag, keeping their order.
+func withTag(tag string, results ...[]DNSLookupResult) []DNSLookupResult {
+	var tagged []DNSLookupResult
+	for _, list := range results {
+		for _, result := range list {
+			if result.HasTag(tag) {
+				tagged = append(tagged, result)
+			}
+		}
+	}
+	return tagged
+}
+
+// Check that every tag is known.
+func validateTags(tags []string) error {
+	for _, tag := range tags {
+		known := false
+		for _, k := range knownTags {
+			known = known || tag == k
+		}
+		if !known {
+			return fmt.Errorf("unknown tag %q, expected one of: %s", tag, strings.Join(knownTags, ", "))
+		}
+	}
+	return nil
+}
+
+// tagFilter struct used to select results by their tags.
+type tagFilter struct {
+	// If not empty, only results with at least one of these tags are kept.
+	include []string
+	// Results with any of these tags are dropped.
+	exclude []string
+	// Only results with all of these tags are kept.
+	require []string
+}
+
+// Check whether the result passes the filter.
+func (f tagFilter) keep(result DNSLookupResult) bool {
+	for _, tag := range f.exclude {
+		if result.HasTag(tag) {
+			return false
+		}
+	}
+	for _, tag := range f.require {
+		if !result.HasTag(tag) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, tag := range f.include {
+		if result.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// Return true if every IP address is private or loopback.
+func allPrivate(ips []net.IP) bool {
+	for _, ip := range ips {
+		if !ip.IsPrivate() && !ip.IsLoopback() {
+			return false
+		}
+	}
+	return len(ips) > 0
+}
@@ -0,0 +1,180 @@
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// TargetInput struct used to store a target domain read from a JSONL line, with the other fields of the line.
+type TargetInput struct {
+	Domain string
+	Fields map[string]any
+}
+
+// ReadDomains reads target domains from r, one per line. Blank lines and comment lines starting with "#" are skipped.
+// Lines which are not a domain name, such as URLs or lines with spaces, are reported as warnings naming the source and
+// the line number, and skipped. Repeated domains are kept once.
+func ReadDomains(r io.Reader, source string, handler slog.Handler) ([]string, error) {
+	logger := newLogger(handler)
+	var domains []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !isDomainName(line) {
+			logger.Warn(fmt.Sprintf("%s:%d: skipped '%s', expected a domain name", source, lineNumber, line))
+			continue
+		}
+		domain := strings.ToLower(strings.TrimSuffix(line, "."))
+		if !seen[domain] {
+			seen[domain] = true
+			domains = append(domains, domain)
+		}
+	}
+	return domains, scanner.Err()
+}
+
+// ReadJSONLTargets reads target domains from r, one JSON object per line with the domain under the "domain" key, or
+// under "host" as written by subfinder. The other fields of the line are kept with the domain. Blank lines are
+// skipped, and lines which cannot be parsed or have no valid domain are reported as warnings and skipped. If a domain
+// is repeated, the fields of its first line are kept.
+func ReadJSONLTargets(r io.Reader, source string, handler slog.Handler) ([]TargetInput, error) {
+	logger := newLogger(handler)
+	var targets []TargetInput
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var fields map[string]any
+		if err := json.Unmarshal([]byte(line), &fields); err != nil {
+			logger.Warn(fmt.Sprintf("%s:%d: skipped a line which is not a JSON object", source, lineNumber),
+				logKeyError, err)
+			continue
+		}
+		key := "domain"
+		if _, ok := fields[key]; !ok {
+			key = "host"
+		}
+		name, _ := fields[key].(string)
+		if !isDomainName(name) {
+			logger.Warn(fmt.Sprintf("%s:%d: skipped a line without a valid domain", source, lineNumber))
+			continue
+		}
+		delete(fields, key)
+		if len(fields) == 0 {
+			fields = nil
+		}
+		domain := strings.ToLower(strings.TrimSuffix(name, "."))
+		if !seen[domain] {
+			seen[domain] = true
+			targets = append(targets, TargetInput{Domain: domain, Fields: fields})
+		}
+	}
+	return targets, scanner.Err()
+}
+
+// Check whether the text can be a domain name, ruling out URLs, email addresses and text with spaces.
+func isDomainName(text string) bool {
+	return text != "" && !strings.ContainsAny(text, " \t/:@")
+}
+
+// Return the target domain the domain belongs to, the most specific one if several match. Returns an empty string if
+// the domain is below none of the targets.
+func targetOf(targets []string, domain string) string {
+	domain = strings.ToLower(domain)
+	var match string
+	for _, target := range targets {
+		target = strings.ToLower(target)
+		if (domain == target || strings.HasSuffix(domain, "."+target)) && len(target) > len(match) {
+			match = target
+		}
+	}
+	return match
+}
+
+// Return the part of the domain before the target domain, such as api for api.example.com and example.com. Returns an
+// empty string for the target itself and the domain unchanged if it is not below the target.
+func relativeName(domain string, target string) string {
+	if target == "" {
+		return domain
+	}
+	if strings.EqualFold(domain, target) {
+		return ""
+	}
+	suffix := "." + target
+	if len(domain) > len(suffix) && strings.EqualFold(domain[len(domain)-len(suffix):], suffix) {
+		return domain[:len(domain)-len(suffix)]
+	}
+	return domain
+}
+
+// Split the report of a run into one report per target domain, in the order of the targets. Each result goes to the
+// report of its target, and typo variants to the report of the subdomain they are a variant of. Results below none
+// of the targets, such as the names found behind CNAME records, are kept in the report of the first target. A report
+// for a single target is returned unchanged.
+func splitReport(report Report, targets []string) []Report {
+	if len(targets) < 2 {
+		return []Report{report}
+	}
+	reports := make([]Report, len(targets))
+	index := make(map[string]int, len(targets))
+	for i, target := range targets {
+		reports[i] = Report{Domain: target, Endpoint: report.Endpoint, StartedAt: report.StartedAt,
+			FinishedAt: report.FinishedAt}
+		index[strings.ToLower(target)] = i
+	}
+	reportOf := func(domain string) *Report {
+		return &reports[index[targetOf(targets, domain)]]
+	}
+
+	for _, certificate := range report.Certificates {
+		added := make(map[int]bool)
+		for _, name := range append(strings.Split(certificate.NameValue, "\n"), certificate.CommonName) {
+			if i, ok := index[targetOf(targets, strings.TrimPrefix(name, "*."))]; ok && !added[i] {
+				added[i] = true
+				reports[i].Certificates = append(reports[i].Certificates, certificate)
+			}
+		}
+	}
+	for _, result := range report.Domains {
+		r := reportOf(result.Domain)
+		r.Domains = append(r.Domains, result)
+	}
+	for _, result := range report.ExtendedDomains {
+		r := reportOf(result.Domain)
+		r.ExtendedDomains = append(r.ExtendedDomains, result)
+	}
+	for _, result := range report.TyposquatCandidates {
+		r := reportOf(result.TyposquatOf)
+		r.TyposquatCandidates = append(r.TyposquatCandidates, result)
+	}
+	for _, result := range report.RecordTargets {
+		r := reportOf(result.Domain)
+		r.RecordTargets = append(r.RecordTargets, result)
+	}
+	for _, result := range report.CNAMEDomains {
+		r := reportOf(result.Domain)
+		r.CNAMEDomains = append(r.CNAMEDomains, result)
+	}
+	reports[0].RelatedExternalDomains = report.RelatedExternalDomains
+	for _, record := range report.SOA {
+		r := reportOf(record.Zone)
+		r.SOA = append(r.SOA, record)
+	}
+	for i := range reports {
+		reports[i].ContentHash = contentHash(reports[i].Domains, reports[i].ExtendedDomains)
+		reports[i].summarize()
+	}
+	return reports
+}
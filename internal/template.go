@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Report struct used to store the results of a run. This is the data model of report templates and of the YAML and
+// JSON outputs.
+type Report struct {
+	// Target domains of the run, separated by commas.
+	Domain string `json:"domain"`
+	// Base URL of the endpoint which served the certificates. Empty if they were read from a file.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Times at which the run started and at which the last domain was resolved, in UTC.
+	StartedAt       time.Time         `json:"started_at"`
+	FinishedAt      time.Time         `json:"finished_at"`
+	Certificates    []Certificate     `json:"certificates"`
+	Domains         []DNSLookupResult `json:"domains"`
+	ExtendedDomains []DNSLookupResult `json:"extended"`
+	// Resolvable names one typo away from a discovered subdomain, if the check was enabled.
+	TyposquatCandidates []DNSLookupResult `json:"typosquat_candidates,omitempty"`
+	// In-scope hosts of the MX and NS records of the resolved domains, and the out-of-scope ones, if all records were
+	// looked up.
+	RecordTargets          []DNSLookupResult `json:"record_targets,omitempty"`
+	RelatedExternalDomains []string          `json:"related_external_domains,omitempty"`
+	// Names listed in the certificates of the out-of-scope domains CNAME records point into, if they were followed.
+	CNAMEDomains []DNSLookupResult `json:"cname_domains,omitempty"`
+	// SOA record of the zone as served by each of its nameservers, if the SOA check was enabled.
+	SOA []SOARecord `json:"soa,omitempty"`
+	// SHA-256 hash of the resolved domains and their IP addresses, identical for runs with identical findings.
+	ContentHash string `json:"content_hash"`
+	// Number of entries of each list of the report.
+	Counts ReportCounts `json:"counts"`
+	// Latency of the DNS lookups and outcome of the resolver fallback.
+	Stats ReportStats `json:"stats"`
+}
+
+// ReportCounts struct used to store the number of entries of each list of a Report.
+type ReportCounts struct {
+	Certificates           int `json:"certificates"`
+	Domains                int `json:"domains"`
+	ExtendedDomains        int `json:"extended"`
+	TyposquatCandidates    int `json:"typosquat_candidates"`
+	RecordTargets          int `json:"record_targets"`
+	RelatedExternalDomains int `json:"related_external_domains"`
+	CNAMEDomains           int `json:"cname_domains"`
+}
+
+// ReportStats struct used to store the statistics of the run behind a Report. They are zero for the parts of the run
+// which were not measured.
+type ReportStats struct {
+	// Latency of every DNS lookup, recorded with a verbosity of 2 or more.
+	Latency LatencyStats `json:"latency"`
+	// Latency of the lookups sent to each resolver, by resolver, if more than one resolver was used.
+	ResolverLatency map[string]LatencyStats `json:"resolver_latency,omitempty"`
+	// Check of the system resolver with a canary name, done when its lookups kept failing.
+	Fallback FallbackStats `json:"fallback"`
+}
+
+// LatencyStats struct used to store the number of DNS lookups and the percentiles of their latencies, in
+// milliseconds.
+type LatencyStats struct {
+	Lookups int     `json:"lookups"`
+	P50     float64 `json:"p50_ms"`
+	P90     float64 `json:"p90_ms"`
+	P99     float64 `json:"p99_ms"`
+}
+
+// FallbackStats struct used to store the outcome of the check deciding whether to fall back to the public resolvers.
+type FallbackStats struct {
+	// Canary name resolved with the system resolver and the outcome of the check, empty if it was not needed.
+	CanaryName string `json:"canary_name"`
+	Canary     string `json:"canary_result"`
+	// Whether the lookups were switched to the public resolvers.
+	Switched bool `json:"switched"`
+}
+
+// Return every list of resolved domains of the report.
+func (r Report) results() [][]DNSLookupResult {
+	return [][]DNSLookupResult{r.Domains, r.ExtendedDomains, r.TyposquatCandidates, r.RecordTargets,
+		r.CNAMEDomains}
+}
+
+// Sort every list of the report, the results by domain and the addresses of each result, so the report does not
+// depend on the order the lookups completed in. Replaying a recorded run gives the same report, byte for byte.
+func (r *Report) sort() {
+	sort.SliceStable(r.Certificates, func(i, j int) bool { return r.Certificates[i].Id < r.Certificates[j].Id })
+	for _, list := range r.results() {
+		sortResults(list)
+	}
+	sort.Strings(r.RelatedExternalDomains)
+}
+
+// Attach to each result the IDs of the certificates listing it, or the wildcard it was guessed from, and count the
+// entries of each list of the report.
+func (r *Report) summarize() {
+	index := indexCertificates(r.Certificates)
+	for _, list := range r.results() {
+		for i := range list {
+			list[i].CertificateIds = certificateIds(index, list[i].Domain)
+		}
+	}
+	r.Counts = ReportCounts{Certificates: len(r.Certificates), Domains: len(r.Domains),
+		ExtendedDomains: len(r.ExtendedDomains), TyposquatCandidates: len(r.TyposquatCandidates),
+		RecordTargets: len(r.RecordTargets), RelatedExternalDomains: len(r.RelatedExternalDomains),
+		CNAMEDomains: len(r.CNAMEDomains)}
+}
+
+// Name returns the domain name. It is provided for templates.
+func (r DNSLookupResult) Name() string {
+	return r.Domain
+}
+
+// IPv4 returns the IPv4 addresses of the domain.
+func (r DNSLookupResult) IPv4() []string {
+	var ips []string
+	for _, ip := range r.Ips {
+		if ip.To4() != nil {
+			ips = append(ips, r.displayIP(ip))
+		}
+	}
+	return ips
+}
+
+// IPv6 returns the IPv6 addresses of the domain.
+func (r DNSLookupResult) IPv6() []string {
+	var ips []string
+	for _, ip := range r.Ips {
+		if ip.To4() == nil {
+			ips = append(ips, r.displayIP(ip))
+		}
+	}
+	return ips
+}
+
+// Functions available in templates, in addition to the text/template builtins.
+var templateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	// Return the value, or the default if the value is empty: {{default "none" .SNI}}.
+	"default": func(def any, value any) any {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return def
+		}
+		if v := reflect.ValueOf(value); (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+			return def
+		}
+		return value
+	},
+}
+
+// Parse a template rendering a single DNSLookupResult per line.
+func parseHostTemplate(text string) (*template.Template, error) {
+	return template.New("template").Funcs(templateFuncs).Parse(text)
+}
+
+// Render a sample result through the host template, so references to fields which do not exist, such as {{.Nope}},
+// fail before any lookup instead of once per resolved domain.
+func checkHostTemplate(tmpl *template.Template) error {
+	sample := DNSLookupResult{Domain: "www.example.com",
+		Ips: []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}}
+	return executeHostTemplate(io.Discard, tmpl, sample)
+}
+
+// Parse a template from a file rendering a whole Report.
+func parseReportTemplate(path string) (*template.Template, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return template.New(path).Funcs(templateFuncs).Parse(string(content))
+}
+
+// Render a DNSLookupResult through the template, terminating the output with a newline if the template does not. The
+// addresses of an anonymized result have their host part cleared, so {{.Ips}} does not reveal them either.
+func executeHostTemplate(w io.Writer, tmpl *template.Template, result DNSLookupResult) error {
+	if result.anonymized {
+		ips := make([]net.IP, 0, len(result.Ips))
+		for _, ip := range result.Ips {
+			ips = append(ips, maskIP(ip))
+		}
+		result.Ips = ips
+	}
+	var line strings.Builder
+	if err := tmpl.Execute(&line, result); err != nil {
+		return err
+	}
+	if !strings.HasSuffix(line.String(), "\n") {
+		line.WriteString("\n")
+	}
+	_, err := io.WriteString(w, line.String())
+	return err
+}
@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Characters used for substitutions and insertions when generating typo variants of a label.
+const typoAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789-"
+
+// typosquatCandidate struct used to pair a name one typo away from a discovered subdomain with that subdomain.
+type typosquatCandidate struct {
+	name     string
+	original string
+}
+
+// Generate every variant of a label one edit away from it: substitutions, insertions and deletions of a character and
+// transpositions of adjacent characters. Variants which are not valid labels are left out.
+func typoVariants(label string) []string {
+	variants := make(map[string]bool)
+	for i := 0; i <= len(label); i++ {
+		for _, c := range typoAlphabet {
+			variants[label[:i]+string(c)+label[i:]] = true
+			if i < len(label) {
+				variants[label[:i]+string(c)+label[i+1:]] = true
+			}
+		}
+		if i < len(label) {
+			variants[label[:i]+label[i+1:]] = true
+		}
+		if i+1 < len(label) {
+			swapped := []byte(label)
+			swapped[i], swapped[i+1] = swapped[i+1], swapped[i]
+			variants[string(swapped)] = true
+		}
+	}
+
+	var valid []string
+	for variant := range variants {
+		if variant != label && variant != "" && !strings.HasPrefix(variant, "-") && !strings.HasSuffix(variant, "-") {
+			valid = append(valid, variant)
+		}
+	}
+	return valid
+}
+
+// Generate the typo variants of the first label of every subdomain. Variants which are themselves among the known
+// domains are left out, since they are assets rather than typosquats.
+func typosquatCandidates(domains []string, known []string) []typosquatCandidate {
+	exists := make(map[string]bool)
+	for _, domain := range known {
+		exists[domain] = true
+	}
+
+	seen := make(map[string]bool)
+	var candidates []typosquatCandidate
+	for _, domain := range domains {
+		label, rest, _ := strings.Cut(domain, ".")
+		if strings.Count(rest, ".") < 1 {
+			continue
+		}
+		for _, variant := range typoVariants(label) {
+			name := variant + "." + rest
+			if !exists[name] && !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, typosquatCandidate{name: name, original: domain})
+			}
+		}
+	}
+	return candidates
+}
+
+// Compute the Levenshtein distance between two strings: the minimum number of single-character insertions, deletions
+// and substitutions turning a into b.
+func levenshtein(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+// Resolve the typosquat candidates and pass each one which can be resolved to the handler, with TyposquatOf set to
+// the subdomain it imitates.
+func resolveTyposquats(resolver Resolver, candidates []typosquatCandidate, opts printOpts,
+	handle func(DNSLookupResult)) {
+	originals := make(map[string]string)
+	names := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		originals[candidate.name] = candidate.original
+		names = append(names, candidate.name)
+	}
+	resolveDomains(resolver, names, opts.withTags(TagTyposquat), func(result DNSLookupResult) {
+		result.TyposquatOf = originals[result.Domain]
+		handle(result)
+	})
+}
+
+// Format the marker printed after a typosquat candidate, with the edit distance between the two names.
+func typosquatMarker(result DNSLookupResult) string {
+	return fmt.Sprintf("[TYPOSQUAT-CANDIDATE of %s, distance %d]", result.TyposquatOf,
+		levenshtein(result.Domain, result.TyposquatOf))
+}
@@ -0,0 +1,184 @@
+package internal
+
+import (
+	"encoding"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Write the value as a YAML document starting with the "---" separator, so the output of several runs can be
+// concatenated into a stream of documents. Struct fields are written in declaration order under the name from their
+// json tag, which keeps the output stable across runs.
+func writeYAML(w io.Writer, value any) error {
+	var b strings.Builder
+	b.WriteString("---\n")
+	encodeYAML(&b, reflect.ValueOf(value), 0, false)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Encode a struct or slice as a block node indented by indent spaces. If inline is set, the first line continues a
+// sequence entry ("- ") which is already written.
+func encodeYAML(b *strings.Builder, v reflect.Value, indent int, inline bool) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	pad := strings.Repeat(" ", indent)
+
+	switch v.Kind() {
+	case reflect.Struct:
+		keys, values := yamlFields(v)
+		if len(keys) == 0 {
+			b.WriteString("{}\n")
+			return
+		}
+		for i := range keys {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString(keys[i] + ":")
+			encodeYAMLField(b, values[i], indent)
+		}
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+		})
+		for i, key := range keys {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString(strconv.Quote(fmt.Sprint(key.Interface())) + ":")
+			encodeYAMLField(b, v.MapIndex(key), indent)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString("- ")
+			elem := unwrapYAMLInterface(v.Index(i))
+			switch {
+			case isYAMLScalar(elem):
+				b.WriteString(yamlScalar(elem) + "\n")
+			case isYAMLEmpty(elem):
+				b.WriteString(yamlEmpty(elem) + "\n")
+			default:
+				encodeYAML(b, elem, indent+2, true)
+			}
+		}
+	default:
+		b.WriteString(pad + yamlScalar(v) + "\n")
+	}
+}
+
+// Return the value held by an interface, such as the values of a map[string]any, so it is written as that value. Nil
+// interfaces are returned as is, and written as null.
+func unwrapYAMLInterface(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return v
+}
+
+// Encode the value of a mapping entry whose key is already written.
+func encodeYAMLField(b *strings.Builder, v reflect.Value, indent int) {
+	v = unwrapYAMLInterface(v)
+	switch {
+	case isYAMLScalar(v):
+		b.WriteString(" " + yamlScalar(v) + "\n")
+	case isYAMLEmpty(v):
+		b.WriteString(" " + yamlEmpty(v) + "\n")
+	default:
+		b.WriteString("\n")
+		encodeYAML(b, v, indent+2, false)
+	}
+}
+
+// Return the keys and values of the exported fields of a struct. Fields tagged with `json:"-"` and zero fields
+// tagged with omitempty are left out.
+func yamlFields(v reflect.Value) ([]string, []reflect.Value) {
+	var keys []string
+	var values []reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.Contains(options, "omitempty") && v.Field(i).IsZero() {
+			continue
+		}
+		keys = append(keys, name)
+		values = append(values, v.Field(i))
+	}
+	return keys, values
+}
+
+// Check whether the value is written as a single scalar. Types marshaling themselves to text, such as net.IP, are
+// scalars.
+func isYAMLScalar(v reflect.Value) bool {
+	if _, ok := v.Interface().(encoding.TextMarshaler); ok {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct, reflect.Slice, reflect.Array, reflect.Map, reflect.Pointer:
+		return false
+	}
+	return true
+}
+
+// Check whether the value is an empty collection, written in flow style.
+func isYAMLEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		return v.Len() == 0
+	case reflect.Map:
+		return v.Len() == 0
+	case reflect.Struct:
+		keys, _ := yamlFields(v)
+		return len(keys) == 0
+	}
+	return false
+}
+
+// Return the flow style form of an empty collection.
+func yamlEmpty(v reflect.Value) string {
+	if v.Kind() == reflect.Struct || v.Kind() == reflect.Map {
+		return "{}"
+	}
+	return "[]"
+}
+
+// Format a scalar. Strings are always double-quoted, so values like "no", "1e3" or "*.example.com" keep their type.
+func yamlScalar(v reflect.Value) string {
+	if marshaler, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := marshaler.MarshalText()
+		if err != nil {
+			return `""`
+		}
+		return strconv.Quote(string(text))
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		return "null"
+	case reflect.String:
+		return strconv.Quote(v.String())
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+	return strconv.Quote(fmt.Sprint(v.Interface()))
+}